@@ -0,0 +1,285 @@
+// Command mistral-cache inspects and maintains the responses cache of the mistral client.
+//
+// Usage:
+//
+//	mistral-cache [-dir DIR] <command> [arguments]
+//
+// The commands are:
+//
+//	list                    list the cache entries with their kind, model, creation time and first user message
+//	show KEY                print the decoded cache entry
+//	prune [flags]           remove the entries created before -older-than, for -model, larger than -larger-than,
+//	                        or which cannot be decrypted with -undecryptable
+//	export [-decrypt] FILE  write all the entries to a .tar.gz archive
+//	import FILE             store all the entries of a .tar.gz archive
+//	migrate                 move the entries of the former flat layout to the sharded one
+//	rotate-keys             re-encrypt with the active key the entries encrypted with a previous one
+//
+// The -compression flag (none, gzip or zstd) sets the compression of the entries written by import and migrate.
+// The -key-env flag names the environment variable holding the encryption keys of an encrypted cache
+// (see mistral.ParseCacheKeys); entries are then decrypted when read and encrypted when written.
+// Since export would then write the entries in clear, it requires the -decrypt flag.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+const maxMessageWidth = 60
+
+func main() {
+	fs := flag.NewFlagSet("mistral-cache", flag.ExitOnError)
+	dir := fs.String("dir", mistral.DefaultCacheDir, "cache directory")
+	compression := fs.String("compression", "none", "compression of the written entries: none, gzip or zstd")
+	keyEnv := fs.String("key-env", "", "environment variable holding the encryption keys, for an encrypted cache")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mistral-cache [-dir DIR] [-compression none|gzip|zstd] [-key-env VAR] <list|show|prune|export|import|migrate|rotate-keys> [arguments]\n") //nolint:errcheck
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+
+	var opts []mistral.LocalCacheOption
+	if *compression != "none" {
+		opts = append(opts, mistral.WithLocalCacheCompression(mistral.CacheCompression(*compression)))
+	}
+
+	ctx := context.Background()
+	var err error
+	if fs.Arg(0) == "migrate" {
+		err = migrate(ctx, *dir, opts, os.Stdout)
+	} else {
+		var engine mistral.CacheLister
+		if engine, err = mistral.NewLocalFsCacheEngine(*dir, opts...); err == nil && *keyEnv != "" {
+			engine, err = mistral.NewEncryptedCacheEngineFromEnv(engine, *keyEnv)
+		}
+		if err == nil {
+			err = run(ctx, engine, fs.Args(), os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err) //nolint:errcheck
+		os.Exit(1)
+	}
+}
+
+// run executes a command against any cache engine supporting listing.
+func run(ctx context.Context, engine mistral.CacheLister, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("missing command, expected one of: list, show, prune, export, import, migrate, rotate-keys")
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "list":
+		return list(ctx, engine, out)
+	case "show":
+		if len(args) != 1 {
+			return errors.New("usage: show KEY")
+		}
+		return show(ctx, engine, args[0], out)
+	case "prune":
+		return prune(ctx, engine, args, out)
+	case "export":
+		return export(ctx, engine, args, out)
+	case "import":
+		if len(args) != 1 {
+			return errors.New("usage: import FILE")
+		}
+		return importArchive(ctx, engine, args[0], out)
+	case "rotate-keys":
+		return rotateKeys(ctx, engine, out)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func list(ctx context.Context, engine mistral.CacheLister, out io.Writer) error {
+	entries, err := mistral.ListCacheEntries(ctx, engine)
+	if err != nil {
+		return err
+	}
+	return printEntries(entries, out)
+}
+
+func show(ctx context.Context, engine mistral.CacheLister, key string, out io.Writer) error {
+	data, err := mistral.ReadCachedData(ctx, engine, key)
+	if err != nil {
+		if errors.Is(err, mistral.ErrCacheMiss) {
+			return fmt.Errorf("no cache entry with key %s", key)
+		}
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func prune(ctx context.Context, engine mistral.CacheLister, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.SetOutput(out)
+	olderThan := fs.Duration("older-than", 0, "remove the entries created for more than this duration (e.g. 72h)")
+	model := fs.String("model", "", "remove the entries of this model")
+	largerThan := fs.String("larger-than", "", "remove the entries larger than this size (e.g. 512K, 10M)")
+	undecryptable := fs.Bool("undecryptable", false, "remove the entries which cannot be decrypted with the keys of -key-env")
+	dryRun := fs.Bool("dry-run", false, "only list the entries that would be removed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	size, err := parseSize(*largerThan)
+	if err != nil {
+		return err
+	}
+
+	pruned, err := mistral.PruneCache(ctx, engine, mistral.CachePruneFilter{
+		OlderThan:     *olderThan,
+		Model:         *model,
+		LargerThan:    size,
+		Undecryptable: *undecryptable,
+	}, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if err := printEntries(pruned, out); err != nil {
+		return err
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	_, err = fmt.Fprintf(out, "%s %d entries\n", verb, len(pruned))
+	return err
+}
+
+func export(ctx context.Context, engine mistral.CacheLister, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(out)
+	decrypt := fs.Bool("decrypt", false, "write the entries of an encrypted cache in clear")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: export [-decrypt] FILE")
+	}
+	file := fs.Arg(0)
+
+	if _, encrypted := engine.(*mistral.EncryptedCacheEngine); encrypted && !*decrypt {
+		return errors.New("export would write the entries in clear: pass -decrypt to confirm, " +
+			"or omit -key-env to archive them encrypted")
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	n, err := mistral.ExportCache(ctx, engine, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write archive: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Exported %d entries to %s\n", n, file)
+	return err
+}
+
+func importArchive(ctx context.Context, engine mistral.CacheLister, file string, out io.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	n, err := mistral.ImportCache(ctx, engine, f)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Imported %d entries from %s\n", n, file)
+	return err
+}
+
+func rotateKeys(ctx context.Context, engine mistral.CacheLister, out io.Writer) error {
+	encrypted, ok := engine.(*mistral.EncryptedCacheEngine)
+	if !ok {
+		return errors.New("rotate-keys requires the -key-env flag")
+	}
+	n, err := encrypted.RotateKeys(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Re-encrypted %d entries\n", n)
+	return err
+}
+
+func migrate(ctx context.Context, dir string, opts []mistral.LocalCacheOption, out io.Writer) error {
+	n, err := mistral.MigrateLocalFsCache(ctx, dir, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Migrated %d entries\n", n)
+	return err
+}
+
+func printEntries(entries []mistral.CacheEntryInfo, out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tKIND\tMODEL\tCREATED\tSIZE\tFIRST USER MESSAGE") //nolint:errcheck
+	for _, e := range entries {
+		created := ""
+		if !e.CreatedAt.IsZero() {
+			created = e.CreatedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", //nolint:errcheck
+			e.Key, e.Kind, e.Model, created, e.Size, truncate(e.FirstUserMessage, maxMessageWidth))
+	}
+	return tw.Flush()
+}
+
+func truncate(s string, width int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// parseSize parses a number of bytes with an optional K, M or G suffix.
+func parseSize(size string) (int, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	if s == "" {
+		return 0, nil
+	}
+
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n * mult, nil
+}
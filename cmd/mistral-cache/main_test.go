@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+func newTestEngine(t *testing.T) mistral.CacheLister {
+	t.Helper()
+
+	engine, err := mistral.NewLocalFsCacheEngine(t.TempDir())
+	assert.NoError(t, err)
+
+	ctx := context.TODO()
+	entries := map[string]mistral.CachedData{
+		"old": {
+			Key:       "old",
+			CreatedAt: time.Now().Add(-48 * time.Hour),
+			ChatCompletionRequest: mistral.NewChatCompletionRequest("mistral-small-latest",
+				[]mistral.ChatMessage{mistral.NewUserMessageFromString("What is the capital of France?")}),
+			ChatCompletionResponse: &mistral.ChatCompletionResponse{
+				Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Paris")}},
+			},
+		},
+		"new": {
+			Key:              "new",
+			CreatedAt:        time.Now(),
+			EmbeddingRequest: mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}),
+		},
+	}
+	for key, entry := range entries {
+		data, err := json.Marshal(entry)
+		assert.NoError(t, err)
+		assert.NoError(t, engine.Set(ctx, key, data))
+	}
+	return engine
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.TODO()
+	archive := filepath.Join(t.TempDir(), "cache.tar.gz")
+
+	testCases := []struct {
+		name string
+		args []string
+
+		// engine is the engine the command runs against, the test engine if nil.
+		engine func(t *testing.T) mistral.CacheLister
+
+		expectedErr    string
+		expectedOutput []string
+		expectedKeys   []string
+	}{
+		{
+			name:           "should list the entries",
+			args:           []string{"list"},
+			expectedOutput: []string{"KEY", "old", "chat_completion", "What is the capital of France?", "new", "embedding"},
+			expectedKeys:   []string{"old", "new"},
+		},
+		{
+			name:           "should show an entry",
+			args:           []string{"show", "old"},
+			expectedOutput: []string{`"model": "mistral-small-latest"`, "Paris"},
+		},
+		{
+			name:        "should fail to show an unknown entry",
+			args:        []string{"show", "unknown"},
+			expectedErr: "no cache entry with key unknown",
+		},
+		{
+			name:        "should require the key to show",
+			args:        []string{"show"},
+			expectedErr: "usage: show KEY",
+		},
+		{
+			name:           "should prune the old entries",
+			args:           []string{"prune", "-older-than", "24h"},
+			expectedOutput: []string{"old", "Removed 1 entries"},
+			expectedKeys:   []string{"new"},
+		},
+		{
+			name:           "should only list the entries to prune on dry run",
+			args:           []string{"prune", "-model", "mistral-embed", "-dry-run"},
+			expectedOutput: []string{"new", "Would remove 1 entries"},
+			expectedKeys:   []string{"old", "new"},
+		},
+		{
+			name: "should prune the entries which cannot be decrypted",
+			args: []string{"prune", "-undecryptable"},
+			engine: func(t *testing.T) mistral.CacheLister {
+				local := newTestEngine(t)
+				retired, err := mistral.NewEncryptedCacheEngine(local, bytes.Repeat([]byte{2}, 32))
+				assert.NoError(t, err)
+				assert.NoError(t, retired.Set(ctx, "retired", []byte("{}")))
+				engine, err := mistral.NewEncryptedCacheEngine(local, bytes.Repeat([]byte{1}, 32))
+				assert.NoError(t, err)
+				_, err = engine.RotateKeys(ctx)
+				assert.NoError(t, err)
+				return engine
+			},
+			expectedOutput: []string{"retired", "Removed 1 entries"},
+			expectedKeys:   []string{"old", "new"},
+		},
+		{
+			name:        "should reject an invalid size",
+			args:        []string{"prune", "-larger-than", "big"},
+			expectedErr: `invalid size "big"`,
+		},
+		{
+			name:        "should reject a prune without criterion",
+			args:        []string{"prune"},
+			expectedErr: "at least one prune criterion is required",
+		},
+		{
+			name:           "should export the entries",
+			args:           []string{"export", archive},
+			expectedOutput: []string{"Exported 2 entries to " + archive},
+		},
+		{
+			name: "should import the exported entries",
+			args: []string{"import", archive},
+			engine: func(t *testing.T) mistral.CacheLister {
+				engine, err := mistral.NewLocalFsCacheEngine(t.TempDir())
+				assert.NoError(t, err)
+				return engine
+			},
+			expectedOutput: []string{"Imported 2 entries from " + archive},
+			expectedKeys:   []string{"old", "new"},
+		},
+		{
+			name:        "should require the archive to export",
+			args:        []string{"export"},
+			expectedErr: "usage: export [-decrypt] FILE",
+		},
+		{
+			name: "should refuse to export an encrypted cache in clear",
+			args: []string{"export", filepath.Join(t.TempDir(), "clear.tar.gz")},
+			engine: func(t *testing.T) mistral.CacheLister {
+				engine, err := mistral.NewEncryptedCacheEngine(newTestEngine(t), bytes.Repeat([]byte{1}, 32))
+				assert.NoError(t, err)
+				return engine
+			},
+			expectedErr: "pass -decrypt to confirm",
+		},
+		{
+			name: "should export an encrypted cache in clear with -decrypt",
+			args: []string{"export", "-decrypt", filepath.Join(t.TempDir(), "clear.tar.gz")},
+			engine: func(t *testing.T) mistral.CacheLister {
+				local := newTestEngine(t)
+				engine, err := mistral.NewEncryptedCacheEngine(local, bytes.Repeat([]byte{1}, 32))
+				assert.NoError(t, err)
+				_, err = engine.RotateKeys(ctx)
+				assert.NoError(t, err)
+				return engine
+			},
+			expectedOutput: []string{"Exported 2 entries"},
+		},
+		{
+			name:        "should require the archive to import",
+			args:        []string{"import", "a.tar.gz", "b.tar.gz"},
+			expectedErr: "usage: import FILE",
+		},
+		{
+			name: "should re-encrypt the entries with the active key",
+			args: []string{"rotate-keys"},
+			engine: func(t *testing.T) mistral.CacheLister {
+				oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+				local := newTestEngine(t)
+				previous, err := mistral.NewEncryptedCacheEngine(local, oldKey)
+				assert.NoError(t, err)
+				_, err = previous.RotateKeys(ctx)
+				assert.NoError(t, err)
+				engine, err := mistral.NewEncryptedCacheEngine(local, newKey, oldKey)
+				assert.NoError(t, err)
+				return engine
+			},
+			expectedOutput: []string{"Re-encrypted 2 entries"},
+			expectedKeys:   []string{"old", "new"},
+		},
+		{
+			name:        "should require the keys to rotate them",
+			args:        []string{"rotate-keys"},
+			expectedErr: "rotate-keys requires the -key-env flag",
+		},
+		{
+			name:        "should reject an unknown command",
+			args:        []string{"clear"},
+			expectedErr: `unknown command "clear"`,
+		},
+		{
+			name:        "should require a command",
+			args:        nil,
+			expectedErr: "missing command",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			newEngine := tc.engine
+			if newEngine == nil {
+				newEngine = newTestEngine
+			}
+			engine := newEngine(t)
+			var out bytes.Buffer
+
+			// When
+			err := run(ctx, engine, tc.args, &out)
+
+			// Then
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			for _, expected := range tc.expectedOutput {
+				assert.Contains(t, out.String(), expected)
+			}
+			if tc.expectedKeys != nil {
+				keys, err := engine.Keys(ctx)
+				assert.NoError(t, err)
+				assert.ElementsMatch(t, tc.expectedKeys, keys)
+			}
+		})
+	}
+}
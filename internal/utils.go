@@ -57,6 +57,12 @@ func init() {
 // The returned text will start with a capital letter and end with a period.
 // It can generate text longer than the source lorem ipsum text.
 func FakeText(wordCount int) (string, error) {
+	return FakeTextFrom(rand.Intn(max(len(loremIpsumWords), 1)), wordCount)
+}
+
+// FakeTextFrom generates the same fake text as FakeText, deterministically starting
+// at the given word of the lorem ipsum text (modulo its length).
+func FakeTextFrom(start, wordCount int) (string, error) {
 	if wordCount < 0 {
 		return "", fmt.Errorf("word count cannot be negative")
 	}
@@ -72,7 +78,7 @@ func FakeText(wordCount int) (string, error) {
 	}
 
 	var resultWords []string
-	startIndex := rand.Intn(numWords)
+	startIndex := ((start % numWords) + numWords) % numWords
 
 	for i := 0; i < wordCount; i++ {
 		resultWords = append(resultWords, loremIpsumWords[(startIndex+i)%numWords])
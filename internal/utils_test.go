@@ -54,6 +54,27 @@ func Test_FakeText(t *testing.T) {
 	}
 }
 
+func Test_FakeTextFrom_IsDeterministic(t *testing.T) {
+	// Given
+	start, otherStart, negativeStart := 42, 43, -1
+	wordCount := 10
+
+	// When
+	first, errFirst := internal.FakeTextFrom(start, wordCount)
+	second, errSecond := internal.FakeTextFrom(start, wordCount)
+	other, errOther := internal.FakeTextFrom(otherStart, wordCount)
+	negative, errNegative := internal.FakeTextFrom(negativeStart, wordCount)
+
+	// Then
+	assert.NoError(t, errFirst)
+	assert.NoError(t, errSecond)
+	assert.NoError(t, errOther)
+	assert.NoError(t, errNegative)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+	assert.Len(t, strings.Fields(strings.TrimSuffix(negative, ".")), wordCount)
+}
+
 func Test_GetOrZero_ReturnsValueWhenKeyExists(t *testing.T) {
 	// Given
 	testMap := map[string]interface{}{
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/thomas-marquis/mistral-client/mistral/internal/cache"
@@ -22,8 +23,31 @@ var (
 )
 
 type cacheConfig struct {
-	enabled  bool
-	cacheDir string
+	enabled      bool
+	cacheDir     string
+	options      []CacheOption
+	localOptions []LocalCacheOption
+
+	encryptionKeys [][]byte
+	encryptionEnv  string
+}
+
+// CacheCompression is the algorithm used to compress the entries of the local file system cache.
+type CacheCompression = cache.Compression
+
+const (
+	CacheCompressionNone = cache.CompressionNone
+	CacheCompressionGzip = cache.CompressionGzip
+	CacheCompressionZstd = cache.CompressionZstd
+)
+
+// LocalCacheOption configures the local file system cache engine.
+type LocalCacheOption = cache.LocalFsOption
+
+// WithLocalCacheCompression compresses the entries written by the local file system cache engine.
+// Entries written with another compression remain readable.
+func WithLocalCacheCompression(c CacheCompression) LocalCacheOption {
+	return cache.WithCompression(c)
 }
 
 type CachedData struct {
@@ -34,6 +58,10 @@ type CachedData struct {
 	EmbeddingRequest       *EmbeddingRequest
 	EmbeddingResponse      *EmbeddingResponse
 	CompletionChunks       []*CompletionChunk
+
+	// ChunkLatencies holds, for each of the CompletionChunks, the time elapsed since the previous one
+	// (or since the stream was requested for the first one).
+	ChunkLatencies []time.Duration `json:",omitempty"`
 }
 
 type CacheEngine interface {
@@ -41,13 +69,69 @@ type CacheEngine interface {
 	Set(ctx context.Context, key string, data []byte) error
 }
 
+// CacheLister is a CacheEngine also able to enumerate and remove its entries.
+// It is required by the cache maintenance functions (ListCacheEntries, PruneCache, ExportCache).
+type CacheLister interface {
+	CacheEngine
+
+	// Keys returns the keys of all the stored entries.
+	Keys(ctx context.Context) ([]string, error)
+
+	// Delete removes the entry stored with the given key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewLocalFsCacheEngine creates the cache engine used by WithLocalCache and WithCacheDir,
+// storing each entry as a JSON file in a directory sharded according to the entry key.
+// Entries are written atomically, and writes from several processes are serialized with a lock file.
+func NewLocalFsCacheEngine(cacheDir string, opts ...LocalCacheOption) (CacheLister, error) {
+	return cache.NewLocalFsEngine(cacheDir, opts...)
+}
+
+// MigrateLocalFsCache moves the entries written by the previous flat layout of the local file system cache
+// (<cacheDir>/<key>.json) to the sharded one, and returns the number of migrated entries.
+// Entries of the flat layout remain readable without migration.
+func MigrateLocalFsCache(ctx context.Context, cacheDir string, opts ...LocalCacheOption) (int, error) {
+	engine, err := cache.NewLocalFsEngine(cacheDir, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return engine.(cache.Migrator).Migrate(ctx)
+}
+
+// cachedClientDecorator caches the responses of the decorated client.
+// Concurrent identical requests on a cold cache are coalesced: only one upstream call is made
+// and the other callers receive a copy of its result.
 type cachedClientDecorator struct {
 	client Client
 	engine CacheEngine
+
+	completionCalls flightGroup[*ChatCompletionResponse]
+	embeddingCalls  flightGroup[*EmbeddingResponse]
+	streamCalls     flightGroup[*chunkFanOut]
+
+	streamsMu sync.Mutex
+	streams   map[string]*chunkFanOut
+
+	models *modelCache
+
+	streamReplaySpeed float64
 }
 
-func newCachedClient(client Client, engine CacheEngine) (Client, error) {
-	return &cachedClientDecorator{client: client, engine: engine}, nil
+// CacheOption configures the cache decorator created by NewCached.
+type CacheOption func(c *cachedClientDecorator)
+
+func newCachedClient(client Client, engine CacheEngine, opts ...CacheOption) (Client, error) {
+	c := &cachedClientDecorator{
+		client:  client,
+		engine:  engine,
+		streams: make(map[string]*chunkFanOut),
+		models:  newModelCache(DefaultModelsCacheTTL),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 func (c *cachedClientDecorator) ChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
@@ -56,6 +140,16 @@ func (c *cachedClientDecorator) ChatCompletion(ctx context.Context, request *Cha
 		return nil, err
 	}
 
+	res, err := c.completionCalls.Do(ctx, cacheKey, func(ctx context.Context) (*ChatCompletionResponse, error) {
+		return c.chatCompletion(ctx, cacheKey, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyChatCompletionResponse(res), nil
+}
+
+func (c *cachedClientDecorator) chatCompletion(ctx context.Context, cacheKey string, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	data, err := c.engine.Get(ctx, cacheKey)
 	if err != nil {
 		if errors.Is(err, ErrCacheMiss) {
@@ -85,56 +179,106 @@ func (c *cachedClientDecorator) ChatCompletion(ctx context.Context, request *Cha
 		return nil, errors.Join(ErrCacheFailure, err)
 	}
 
+	if cachedData.ChatCompletionResponse != nil {
+		cachedData.ChatCompletionResponse.Metadata = ResponseMetadata{FromCache: true}
+	}
 	return cachedData.ChatCompletionResponse, nil
 }
 
+// ChatCompletionStream returns the cached chunks if any.
+// Otherwise, a single upstream stream is opened per request and its chunks are fanned out to every
+// concurrent caller, late subscribers receiving the chunks already emitted first.
 func (c *cachedClientDecorator) ChatCompletionStream(ctx context.Context, request *ChatCompletionRequest) (<-chan *CompletionChunk, error) {
 	cacheKey, err := computeHashKey(request)
 	if err != nil {
 		return nil, err
 	}
 
+	fanOut, err := c.streamCalls.Do(ctx, cacheKey, func(ctx context.Context) (*chunkFanOut, error) {
+		c.streamsMu.Lock()
+		live, ok := c.streams[cacheKey]
+		c.streamsMu.Unlock()
+		if ok {
+			return live, nil
+		}
+		return c.chatCompletionStream(ctx, cacheKey, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fanOut.subscribe(ctx, c.streamReplaySpeed), nil
+}
+
+func (c *cachedClientDecorator) chatCompletionStream(ctx context.Context, cacheKey string, request *ChatCompletionRequest) (*chunkFanOut, error) {
 	data, err := c.engine.Get(ctx, cacheKey)
 	if err != nil {
 		if errors.Is(err, ErrCacheMiss) {
+			requestedAt := time.Now()
 			res, err := c.client.ChatCompletionStream(ctx, request)
 			if err != nil {
 				return nil, err
 			}
 
-			proxyChan := make(chan *CompletionChunk)
+			fanOut := newChunkFanOut()
+			c.streamsMu.Lock()
+			c.streams[cacheKey] = fanOut
+			c.streamsMu.Unlock()
 
 			go func() {
-				defer close(proxyChan)
+				defer func() {
+					c.streamsMu.Lock()
+					delete(c.streams, cacheKey)
+					c.streamsMu.Unlock()
+					fanOut.close()
+				}()
+
 				cachedData := CachedData{
 					Key:                   cacheKey,
 					CreatedAt:             time.Now(),
 					ChatCompletionRequest: request,
 					CompletionChunks:      make([]*CompletionChunk, 0),
+					ChunkLatencies:        make([]time.Duration, 0),
 				}
+				completed, failed := false, false
+				last := requestedAt
 				for chunk := range res {
+					now := time.Now()
 					cachedData.CompletionChunks = append(cachedData.CompletionChunks, chunk)
-					proxyChan <- chunk
+					cachedData.ChunkLatencies = append(cachedData.ChunkLatencies, now.Sub(last))
+					last = now
+					if chunk.Error != nil {
+						failed = true
+					} else if isLastChunk(chunk) {
+						completed = true
+					}
+					fanOut.publish(chunk)
 				}
+
+				// Do not cache an interrupted stream as if it had completed
+				if failed || !completed {
+					return
+				}
+
 				cacheData, err := json.Marshal(cachedData)
 				if err != nil {
-					proxyChan <- &CompletionChunk{
+					fanOut.publish(&CompletionChunk{
 						Error: errors.Join(ErrCacheFailure, err),
 						Choices: []CompletionResponseStreamChoice{
 							{Delta: NewAssistantMessageFromString("")},
 						},
-					}
+					})
 				}
 				if err := c.engine.Set(ctx, cacheKey, cacheData); err != nil {
-					proxyChan <- &CompletionChunk{
+					fanOut.publish(&CompletionChunk{
 						Error: errors.Join(ErrCacheFailure, err),
 						Choices: []CompletionResponseStreamChoice{
 							{Delta: NewAssistantMessageFromString("")},
 						},
-					}
+					})
 				}
 			}()
-			return proxyChan, nil
+			return fanOut, nil
 		}
 		return nil, errors.Join(ErrCacheFailure, err)
 	}
@@ -144,66 +288,44 @@ func (c *cachedClientDecorator) ChatCompletionStream(ctx context.Context, reques
 		return nil, errors.Join(ErrCacheFailure, err)
 	}
 
-	resChan := make(chan *CompletionChunk)
-
-	go func() {
-		defer close(resChan)
-		for _, chunk := range cachedData.CompletionChunks {
-			resChan <- chunk
-		}
-	}()
-
-	return resChan, nil
+	restoreChunkLatencies(cachedData.CompletionChunks, cachedData.ChunkLatencies)
+	fanOut := newClosedChunkFanOut(cachedData.CompletionChunks)
+	fanOut.delays = cachedData.ChunkLatencies
+	return fanOut, nil
 }
 
-func (c *cachedClientDecorator) Embeddings(ctx context.Context, request *EmbeddingRequest) (*EmbeddingResponse, error) {
-	cacheKey, err := computeHashKey(request)
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := c.engine.Get(ctx, cacheKey)
-	if err != nil {
-		if errors.Is(err, ErrCacheMiss) {
-			res, err := c.client.Embeddings(ctx, request)
-			if err != nil {
-				return nil, err
-			}
-			cacheData, err := json.Marshal(CachedData{
-				Key:               cacheKey,
-				CreatedAt:         time.Now(),
-				EmbeddingRequest:  request,
-				EmbeddingResponse: res,
-			})
-			if err != nil {
-				return nil, errors.Join(ErrCacheFailure, err)
-			}
-			if err := c.engine.Set(ctx, cacheKey, cacheData); err != nil {
-				return nil, errors.Join(ErrCacheFailure, err)
-			}
-			return res, nil
+// WithStreamReplaySpeed replays cached streams with their recorded pacing, accelerated by the given factor
+// (1 for the original pacing, 2 for twice as fast...).
+// By default, or with a zero factor, cached chunks are replayed instantly.
+func WithStreamReplaySpeed(factor float64) CacheOption {
+	return func(c *cachedClientDecorator) {
+		if factor < 0 {
+			factor = 0
 		}
-		return nil, errors.Join(ErrCacheFailure, err)
-	}
-
-	var cachedData CachedData
-	if err := json.Unmarshal(data, &cachedData); err != nil {
-		return nil, errors.Join(ErrCacheFailure, err)
+		c.streamReplaySpeed = factor
 	}
-
-	return cachedData.EmbeddingResponse, nil
-}
-
-func (c *cachedClientDecorator) ListModels(ctx context.Context) ([]*BaseModelCard, error) {
-	return c.client.ListModels(ctx)
 }
 
-func (c *cachedClientDecorator) SearchModels(ctx context.Context, capabilities *ModelCapabilities) ([]*BaseModelCard, error) {
-	return c.client.SearchModels(ctx, capabilities)
+func isLastChunk(chunk *CompletionChunk) bool {
+	return chunk.IsLastChunk || (len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "")
 }
 
-func (c *cachedClientDecorator) GetModel(ctx context.Context, modelId string) (*BaseModelCard, error) {
-	return c.client.GetModel(ctx, modelId)
+// restoreChunkLatencies sets back the fields of the cached chunks which are not serialized.
+func restoreChunkLatencies(chunks []*CompletionChunk, latencies []time.Duration) {
+	var total time.Duration
+	for i, chunk := range chunks {
+		chunk.Metadata = ResponseMetadata{FromCache: true}
+		if i < len(latencies) {
+			chunk.ChunkLatency = latencies[i]
+			total += latencies[i]
+		}
+		if isLastChunk(chunk) {
+			chunk.IsLastChunk = true
+			if len(latencies) > 0 {
+				chunk.TotalLatency = total
+			}
+		}
+	}
 }
 
 func computeHashKey(in any) (string, error) {
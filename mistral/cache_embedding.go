@@ -0,0 +1,242 @@
+package mistral
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// embeddingCacheKey identifies a single embedded text.
+// Every field which changes the resulting vector must be part of it.
+type embeddingCacheKey struct {
+	Model           string                  `json:"model"`
+	OutputDimension int                     `json:"output_dimension,omitempty"`
+	OutputDtype     EmbeddingOutputDtype    `json:"output_dtype,omitempty"`
+	EncodingFormat  EmbeddingEncodingFormat `json:"encoding_format,omitempty"`
+	Input           string                  `json:"input"`
+}
+
+// Embeddings caches each input text separately, so that only the texts that have never been embedded
+// are sent to the API.
+// The returned response keeps the order of the request inputs.
+// When some inputs are sent to the API, its usage is the one of the upstream call, which only counts them,
+// and ResponseMetadata.PartiallyCached tells whether the others were served by the cache.
+// When all of them are cached, its usage is the sum of the usage attributed to each input when it was embedded:
+// for the texts embedded in the same upstream call, the call usage is prorated according to their length.
+func (c *cachedClientDecorator) Embeddings(ctx context.Context, request *EmbeddingRequest) (*EmbeddingResponse, error) {
+	requestKey, err := computeHashKey(request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.embeddingCalls.Do(ctx, requestKey, func(ctx context.Context) (*EmbeddingResponse, error) {
+		return c.embeddings(ctx, request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyEmbeddingResponse(res), nil
+}
+
+func (c *cachedClientDecorator) embeddings(ctx context.Context, request *EmbeddingRequest) (*EmbeddingResponse, error) {
+	keys := make([]string, len(request.Input))
+	entries := make(map[string]*EmbeddingResponse, len(request.Input))
+	var missingKeys []string
+	var missingInputs []string
+
+	for i, input := range request.Input {
+		key, err := computeHashKey(embeddingCacheKey{
+			Model:           request.Model,
+			OutputDimension: request.OutputDimension,
+			OutputDtype:     request.OutputDtype,
+			EncodingFormat:  request.EncodingFormat,
+			Input:           input,
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+
+		if _, seen := entries[key]; seen {
+			continue
+		}
+
+		data, err := c.engine.Get(ctx, key)
+		if err != nil {
+			if !errors.Is(err, ErrCacheMiss) {
+				return nil, errors.Join(ErrCacheFailure, err)
+			}
+			entries[key] = nil
+			missingKeys = append(missingKeys, key)
+			missingInputs = append(missingInputs, input)
+			continue
+		}
+
+		var cachedData CachedData
+		if err := json.Unmarshal(data, &cachedData); err != nil {
+			return nil, errors.Join(ErrCacheFailure, err)
+		}
+		if cachedData.EmbeddingResponse == nil || len(cachedData.EmbeddingResponse.Data) != 1 {
+			return nil, errors.Join(ErrCacheFailure, fmt.Errorf("invalid cached embedding for key %s", key))
+		}
+		entries[key] = cachedData.EmbeddingResponse
+	}
+
+	var upstream *EmbeddingResponse
+	if len(missingInputs) > 0 {
+		upstreamReq := *request
+		upstreamReq.Input = missingInputs
+
+		res, err := c.client.Embeddings(ctx, &upstreamReq)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Data) != len(missingInputs) {
+			return nil, fmt.Errorf("expected %d embeddings in response, got %d", len(missingInputs), len(res.Data))
+		}
+		upstream = res
+
+		data := make([]EmbeddingData, len(res.Data))
+		copy(data, res.Data)
+		sort.SliceStable(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+
+		weights := make([]int, len(missingInputs))
+		for i, input := range missingInputs {
+			weights[i] = utf8.RuneCountInString(input)
+		}
+		usages := prorateUsage(res.Usage, weights)
+
+		var cacheErrs []error
+		for i, key := range missingKeys {
+			entry := &EmbeddingResponse{
+				ID:     res.ID,
+				Object: res.Object,
+				Model:  res.Model,
+				Usage:  usages[i],
+				Data: []EmbeddingData{
+					{Object: data[i].Object, Embedding: data[i].Embedding, Index: 0},
+				},
+			}
+			entries[key] = entry
+
+			cacheData, err := json.Marshal(CachedData{
+				Key:       key,
+				CreatedAt: time.Now(),
+				EmbeddingRequest: &EmbeddingRequest{
+					Model:           request.Model,
+					Input:           []string{missingInputs[i]},
+					OutputDimension: request.OutputDimension,
+					OutputDtype:     request.OutputDtype,
+					EncodingFormat:  request.EncodingFormat,
+				},
+				EmbeddingResponse: entry,
+			})
+			if err != nil {
+				cacheErrs = append(cacheErrs, err)
+				continue
+			}
+			if err := c.engine.Set(ctx, key, cacheData); err != nil {
+				cacheErrs = append(cacheErrs, err)
+			}
+		}
+		if len(cacheErrs) > 0 {
+			return nil, errors.Join(append([]error{ErrCacheFailure}, cacheErrs...)...)
+		}
+	}
+
+	return assembleEmbeddingResponse(keys, entries, upstream), nil
+}
+
+// assembleEmbeddingResponse builds the response of the original request from the per input cache entries.
+func assembleEmbeddingResponse(keys []string, entries map[string]*EmbeddingResponse, upstream *EmbeddingResponse) *EmbeddingResponse {
+	res := &EmbeddingResponse{
+		Data: make([]EmbeddingData, len(keys)),
+	}
+	if upstream != nil {
+		res.ID = upstream.ID
+		res.Object = upstream.Object
+		res.Model = upstream.Model
+		res.Latency = upstream.Latency
+		res.Metadata = upstream.Metadata
+		// Only the fetched inputs are billed
+		res.Usage = upstream.Usage
+		res.Metadata.PartiallyCached = len(upstream.Data) < len(entries)
+	} else if len(keys) > 0 {
+		res.Metadata = ResponseMetadata{FromCache: true}
+		first := entries[keys[0]]
+		res.ID = first.ID
+		res.Object = first.Object
+		res.Model = first.Model
+	}
+
+	for i, key := range keys {
+		entry := entries[key]
+		res.Data[i] = EmbeddingData{
+			Object:    entry.Data[0].Object,
+			Embedding: entry.Data[0].Embedding,
+			Index:     i,
+		}
+		if upstream == nil {
+			res.Usage.PromptTokens += entry.Usage.PromptTokens
+			res.Usage.CompletionTokens += entry.Usage.CompletionTokens
+			res.Usage.TotalTokens += entry.Usage.TotalTokens
+			res.Usage.PromptAudioSeconds += entry.Usage.PromptAudioSeconds
+		}
+	}
+
+	return res
+}
+
+// prorateUsage splits the usage between several items according to their weights.
+// The split usages always sum up to the original one.
+func prorateUsage(usage UsageInfo, weights []int) []UsageInfo {
+	promptTokens := prorate(usage.PromptTokens, weights)
+	completionTokens := prorate(usage.CompletionTokens, weights)
+	totalTokens := prorate(usage.TotalTokens, weights)
+	audioSeconds := prorate(usage.PromptAudioSeconds, weights)
+
+	res := make([]UsageInfo, len(weights))
+	for i := range weights {
+		res[i] = UsageInfo{
+			PromptTokens:       promptTokens[i],
+			CompletionTokens:   completionTokens[i],
+			TotalTokens:        totalTokens[i],
+			PromptAudioSeconds: audioSeconds[i],
+		}
+	}
+	return res
+}
+
+func prorate(total int, weights []int) []int {
+	res := make([]int, len(weights))
+	if len(weights) == 0 {
+		return res
+	}
+
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		weights = make([]int, len(weights))
+		for i := range weights {
+			weights[i] = 1
+		}
+		sum = len(weights)
+	}
+
+	distributed := 0
+	for i, w := range weights {
+		res[i] = total * w / sum
+		distributed += res[i]
+	}
+	for i := 0; distributed < total; i = (i + 1) % len(res) {
+		res[i]++
+		distributed++
+	}
+	return res
+}
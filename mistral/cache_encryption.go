@@ -0,0 +1,279 @@
+package mistral
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// DefaultCacheKeyEnv is the environment variable read by WithCacheEncryptionFromEnv when no other name is given.
+	DefaultCacheKeyEnv = "MISTRAL_CACHE_KEY"
+
+	encryptedEntryMagic = "MCE1"
+	cacheKeyIdLength    = 8
+)
+
+var (
+	ErrCacheNotListable = errors.New("the underlying cache engine does not support listing")
+
+	// ErrCacheUndecryptable matches the errors of the entries which cannot be decrypted
+	// (see UndecryptableCacheEntryError).
+	ErrCacheUndecryptable = errors.New("cache entry cannot be decrypted")
+)
+
+// UndecryptableCacheEntryError is returned by EncryptedCacheEngine.Get for an entry which cannot be decrypted:
+// written in clear, encrypted with a key which is not in the keyring anymore, truncated or tampered with.
+// It matches ErrCacheUndecryptable, and ErrCacheMiss so that the cache decorator fetches the response again
+// and overwrites the entry. The maintenance functions list such entries with the CacheEntryUndecryptable kind.
+type UndecryptableCacheEntryError struct {
+	Key    string
+	Reason string
+}
+
+func (e *UndecryptableCacheEntryError) Error() string {
+	return fmt.Sprintf("cache entry %s cannot be decrypted: %s", e.Key, e.Reason)
+}
+
+func (e *UndecryptableCacheEntryError) Is(target error) bool {
+	return target == ErrCacheUndecryptable || target == ErrCacheMiss
+}
+
+type cacheCipher struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// EncryptedCacheEngine wraps any CacheEngine to encrypt the entries at rest with AES-GCM.
+//
+// Entries are encrypted with the active key, and can be decrypted with any key of the keyring,
+// so keys can be rotated without losing the cache: see RotateKeys.
+// Each entry is bound to its cache key, an entry moved under another key fails to decrypt.
+// Plaintext entries, entries encrypted with a key no longer in the keyring, and entries which fail to decrypt
+// (truncated or tampered with) are reported as cache misses, so that they are written again.
+type EncryptedCacheEngine struct {
+	engine  CacheEngine
+	active  *cacheCipher
+	ciphers map[string]*cacheCipher
+}
+
+var _ CacheLister = (*EncryptedCacheEngine)(nil)
+
+// NewEncryptedCacheEngine wraps the engine to encrypt its entries with key.
+// The previous keys are only used to decrypt the entries written before a key rotation.
+// Keys must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256.
+func NewEncryptedCacheEngine(engine CacheEngine, key []byte, previousKeys ...[]byte) (*EncryptedCacheEngine, error) {
+	e := &EncryptedCacheEngine{
+		engine:  engine,
+		ciphers: make(map[string]*cacheCipher),
+	}
+
+	for i, k := range append([][]byte{key}, previousKeys...) {
+		c, err := newCacheCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			e.active = c
+		}
+		e.ciphers[c.id] = c
+	}
+
+	return e, nil
+}
+
+// NewEncryptedCacheEngineFromEnv wraps the engine to encrypt its entries with the keys read from
+// the given environment variable (see ParseCacheKeys for the expected format).
+func NewEncryptedCacheEngineFromEnv(engine CacheEngine, envVar string) (*EncryptedCacheEngine, error) {
+	value, ok := os.LookupEnv(envVar)
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, fmt.Errorf("cache encryption key environment variable %s is not set", envVar)
+	}
+	keys, err := ParseCacheKeys(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache encryption keys in %s: %w", envVar, err)
+	}
+	return NewEncryptedCacheEngine(engine, keys[0], keys[1:]...)
+}
+
+// ParseCacheKeys decodes a comma separated list of base64 encoded keys.
+// The first key is the active one, the following ones are the previous keys.
+func ParseCacheKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("key is not valid base64: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no key found")
+	}
+	return keys, nil
+}
+
+// GenerateCacheKey returns a new random AES-256 key, base64 encoded.
+func GenerateCacheKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func (e *EncryptedCacheEngine) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := e.engine.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(key, data)
+}
+
+func (e *EncryptedCacheEngine) Set(ctx context.Context, key string, data []byte) error {
+	encrypted, err := e.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+	return e.engine.Set(ctx, key, encrypted)
+}
+
+func (e *EncryptedCacheEngine) Keys(ctx context.Context) ([]string, error) {
+	lister, ok := e.engine.(CacheLister)
+	if !ok {
+		return nil, ErrCacheNotListable
+	}
+	return lister.Keys(ctx)
+}
+
+func (e *EncryptedCacheEngine) Delete(ctx context.Context, key string) error {
+	lister, ok := e.engine.(CacheLister)
+	if !ok {
+		return ErrCacheNotListable
+	}
+	return lister.Delete(ctx, key)
+}
+
+// RotateKeys re-encrypts with the active key every entry encrypted with a previous key.
+// Plaintext JSON entries are encrypted too. Entries that cannot be decrypted are left untouched.
+// It requires the underlying engine to support listing, and returns the number of rewritten entries.
+func (e *EncryptedCacheEngine) RotateKeys(ctx context.Context) (int, error) {
+	lister, ok := e.engine.(CacheLister)
+	if !ok {
+		return 0, ErrCacheNotListable
+	}
+
+	keys, err := lister.Keys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, key := range keys {
+		data, err := lister.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrCacheMiss) {
+				continue
+			}
+			return count, err
+		}
+
+		var plaintext []byte
+		if keyId, ok := encryptedEntryKeyId(data); ok {
+			if keyId == e.active.id {
+				continue
+			}
+			if plaintext, err = e.decrypt(key, data); err != nil {
+				continue
+			}
+		} else if json.Valid(data) {
+			plaintext = data
+		} else {
+			continue
+		}
+
+		if err := e.Set(ctx, key, plaintext); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// encrypt returns: magic | key ID | nonce | ciphertext
+func (e *EncryptedCacheEngine) encrypt(key string, data []byte) ([]byte, error) {
+	nonce := make([]byte, e.active.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	keyId, _ := hex.DecodeString(e.active.id)
+	out := make([]byte, 0, len(encryptedEntryMagic)+len(keyId)+len(nonce)+len(data)+e.active.aead.Overhead())
+	out = append(out, encryptedEntryMagic...)
+	out = append(out, keyId...)
+	out = append(out, nonce...)
+	return e.active.aead.Seal(out, nonce, data, []byte(key)), nil
+}
+
+// decrypt returns an UndecryptableCacheEntryError, which is also a miss, for the entries it can't decrypt,
+// so that they are written again rather than failing every request.
+func (e *EncryptedCacheEngine) decrypt(key string, data []byte) ([]byte, error) {
+	keyId, ok := encryptedEntryKeyId(data)
+	if !ok {
+		return nil, &UndecryptableCacheEntryError{Key: key, Reason: "not encrypted"}
+	}
+	c, ok := e.ciphers[keyId]
+	if !ok {
+		return nil, &UndecryptableCacheEntryError{Key: key, Reason: "unknown key ID " + keyId}
+	}
+
+	data = data[len(encryptedEntryMagic)+cacheKeyIdLength:]
+	if len(data) < c.aead.NonceSize() {
+		logger.Printf("Encrypted cache entry %s is truncated, ignoring it", key)
+		return nil, &UndecryptableCacheEntryError{Key: key, Reason: "truncated"}
+	}
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		logger.Printf("Failed to decrypt cache entry %s, ignoring it: %v", key, err)
+		return nil, &UndecryptableCacheEntryError{Key: key, Reason: "authentication failed"}
+	}
+	return plaintext, nil
+}
+
+func encryptedEntryKeyId(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte(encryptedEntryMagic)) || len(data) < len(encryptedEntryMagic)+cacheKeyIdLength {
+		return "", false
+	}
+	return hex.EncodeToString(data[len(encryptedEntryMagic) : len(encryptedEntryMagic)+cacheKeyIdLength]), true
+}
+
+func newCacheCipher(key []byte) (*cacheCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache encryption key: %w", err)
+	}
+
+	// The key ID is a hash of the key, so it can be stored along with the entries without revealing it
+	sum := sha256.Sum256(key)
+	return &cacheCipher{id: hex.EncodeToString(sum[:cacheKeyIdLength]), aead: aead}, nil
+}
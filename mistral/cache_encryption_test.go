@@ -0,0 +1,204 @@
+package mistral_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+var (
+	cacheKey1 = []byte("0123456789abcdef0123456789abcdef")
+	cacheKey2 = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestEncryptedCacheEngine(t *testing.T) {
+	ctx := context.TODO()
+	data := []byte(`{"Key": "abcdef"}`)
+
+	t.Run("should encrypt the entries at rest", func(t *testing.T) {
+		// Given
+		inner, err := mistral.NewLocalFsCacheEngine(t.TempDir())
+		assert.NoError(t, err)
+		engine, err := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+		assert.NoError(t, err)
+
+		// When
+		err = engine.Set(ctx, "abcdef", data)
+
+		// Then
+		assert.NoError(t, err)
+		raw, _ := inner.Get(ctx, "abcdef")
+		assert.NotContains(t, string(raw), "Key")
+
+		received, err := engine.Get(ctx, "abcdef")
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+	})
+
+	t.Run("should reject an entry moved under another key", func(t *testing.T) {
+		// Given
+		inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+		engine, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+		assert.NoError(t, engine.Set(ctx, "abcdef", data))
+		raw, _ := inner.Get(ctx, "abcdef")
+		assert.NoError(t, inner.Set(ctx, "123456", raw))
+
+		// When
+		received, err := engine.Get(ctx, "123456")
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrCacheMiss)
+		assert.Nil(t, received)
+	})
+
+	t.Run("should report a tampered entry as a cache miss until it is written again", func(t *testing.T) {
+		// Given
+		inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+		engine, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+		assert.NoError(t, engine.Set(ctx, "abcdef", data))
+		raw, _ := inner.Get(ctx, "abcdef")
+		raw[len(raw)-1] ^= 0xff
+		assert.NoError(t, inner.Set(ctx, "abcdef", raw))
+
+		// When
+		_, errTampered := engine.Get(ctx, "abcdef")
+		assert.NoError(t, engine.Set(ctx, "abcdef", data))
+		received, err := engine.Get(ctx, "abcdef")
+
+		// Then
+		assert.ErrorIs(t, errTampered, mistral.ErrCacheMiss)
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+	})
+
+	t.Run("should report plaintext and unknown key entries as cache misses", func(t *testing.T) {
+		// Given
+		inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+		assert.NoError(t, inner.Set(ctx, "plain", data))
+		other, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey2)
+		assert.NoError(t, other.Set(ctx, "other", data))
+
+		engine, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+
+		// When
+		_, errPlain := engine.Get(ctx, "plain")
+		_, errOther := engine.Get(ctx, "other")
+
+		// Then
+		assert.ErrorIs(t, errPlain, mistral.ErrCacheMiss)
+		assert.ErrorIs(t, errOther, mistral.ErrCacheMiss)
+	})
+
+	t.Run("should report the entries it cannot decrypt as undecryptable", func(t *testing.T) {
+		// Given
+		inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+		retired, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey2)
+		assert.NoError(t, retired.Set(ctx, "retired", data))
+		engine, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+		assert.NoError(t, engine.Set(ctx, "tampered", data))
+		raw, _ := inner.Get(ctx, "tampered")
+		raw[len(raw)-1] ^= 0xff
+		assert.NoError(t, inner.Set(ctx, "tampered", raw))
+
+		// When
+		_, errRetired := engine.Get(ctx, "retired")
+		_, errTampered := engine.Get(ctx, "tampered")
+		_, errMissing := engine.Get(ctx, "missing")
+
+		// Then
+		var undecryptable *mistral.UndecryptableCacheEntryError
+		assert.ErrorAs(t, errRetired, &undecryptable)
+		assert.Equal(t, "retired", undecryptable.Key)
+		assert.ErrorIs(t, errTampered, mistral.ErrCacheUndecryptable)
+		assert.ErrorIs(t, errMissing, mistral.ErrCacheMiss)
+		assert.NotErrorIs(t, errMissing, mistral.ErrCacheUndecryptable)
+	})
+
+	t.Run("should reject invalid keys", func(t *testing.T) {
+		inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+
+		_, err := mistral.NewEncryptedCacheEngine(inner, []byte("too short"))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should rotate keys", func(t *testing.T) {
+		// Given
+		inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+		old, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+		assert.NoError(t, old.Set(ctx, "old", data))
+		assert.NoError(t, inner.Set(ctx, "plain", data))
+
+		engine, err := mistral.NewEncryptedCacheEngine(inner, cacheKey2, cacheKey1)
+		assert.NoError(t, err)
+		assert.NoError(t, engine.Set(ctx, "new", data))
+
+		// Entries written with the previous key remain readable
+		received, err := engine.Get(ctx, "old")
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+
+		// When
+		n, err := engine.RotateKeys(ctx)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		rotated, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey2)
+		for _, key := range []string{"old", "new", "plain"} {
+			received, err := rotated.Get(ctx, key)
+			assert.NoError(t, err)
+			assert.Equal(t, data, received)
+		}
+	})
+}
+
+func TestNewEncryptedCacheEngineFromEnv(t *testing.T) {
+	ctx := context.TODO()
+	inner, _ := mistral.NewLocalFsCacheEngine(t.TempDir())
+	previous, _ := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+	assert.NoError(t, previous.Set(ctx, "abcdef", []byte("{}")))
+
+	t.Run("should read the active and previous keys", func(t *testing.T) {
+		t.Setenv("TEST_CACHE_KEY", strings.Join([]string{
+			base64.StdEncoding.EncodeToString(cacheKey2),
+			base64.StdEncoding.EncodeToString(cacheKey1),
+		}, ","))
+
+		engine, err := mistral.NewEncryptedCacheEngineFromEnv(inner, "TEST_CACHE_KEY")
+
+		assert.NoError(t, err)
+		received, err := engine.Get(ctx, "abcdef")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("{}"), received)
+	})
+
+	t.Run("should fail when the variable is not set", func(t *testing.T) {
+		_, err := mistral.NewEncryptedCacheEngineFromEnv(inner, "TEST_CACHE_KEY_MISSING")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should fail on invalid base64", func(t *testing.T) {
+		t.Setenv("TEST_CACHE_KEY", "not base64!")
+
+		_, err := mistral.NewEncryptedCacheEngineFromEnv(inner, "TEST_CACHE_KEY")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateCacheKey(t *testing.T) {
+	key, err := mistral.GenerateCacheKey()
+
+	assert.NoError(t, err)
+	keys, err := mistral.ParseCacheKeys(key)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Len(t, keys[0], 32)
+}
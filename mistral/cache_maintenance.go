@@ -0,0 +1,285 @@
+package mistral
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+type CacheEntryKind string
+
+const (
+	CacheEntryChatCompletion       CacheEntryKind = "chat_completion"
+	CacheEntryChatCompletionStream CacheEntryKind = "chat_completion_stream"
+	CacheEntryEmbedding            CacheEntryKind = "embedding"
+	CacheEntryUnknown              CacheEntryKind = "unknown"
+
+	// CacheEntryUndecryptable is the kind of the entries of an encrypted cache which cannot be decrypted,
+	// such as the ones written with a key removed from the keyring.
+	CacheEntryUndecryptable CacheEntryKind = "undecryptable"
+)
+
+// CacheEntryInfo summarizes a cache entry.
+type CacheEntryInfo struct {
+	Key       string
+	Kind      CacheEntryKind
+	Model     string
+	CreatedAt time.Time
+
+	// FirstUserMessage is the text of the first user message of a chat completion, or the first embedded text.
+	FirstUserMessage string
+
+	// Size is the number of bytes of the entry, as returned by the engine (i.e. once decompressed).
+	Size int
+}
+
+// CachePruneFilter selects the entries to remove with PruneCache.
+// An entry is selected when it matches all the non-zero criteria.
+type CachePruneFilter struct {
+	// OlderThan selects the entries created for more than this duration.
+	// The entries without creation time, such as the ones which cannot be decoded, are never selected by age.
+	OlderThan time.Duration
+
+	// Model selects the entries of this model.
+	Model string
+
+	// LargerThan selects the entries whose size exceeds this number of bytes.
+	LargerThan int
+
+	// Undecryptable selects the entries which cannot be decrypted (CacheEntryUndecryptable).
+	// Their creation time, model and size are unknown, so the other criteria never select them.
+	Undecryptable bool
+}
+
+func (f CachePruneFilter) isZero() bool {
+	return f == CachePruneFilter{}
+}
+
+func (f CachePruneFilter) match(entry CacheEntryInfo, now time.Time) bool {
+	if f.OlderThan > 0 && (entry.CreatedAt.IsZero() || now.Sub(entry.CreatedAt) <= f.OlderThan) {
+		return false
+	}
+	if f.Model != "" && entry.Model != f.Model {
+		return false
+	}
+	if f.LargerThan > 0 && entry.Size <= f.LargerThan {
+		return false
+	}
+	if f.Undecryptable && entry.Kind != CacheEntryUndecryptable {
+		return false
+	}
+	return true
+}
+
+// ReadCachedData returns the decoded entry stored with the given key.
+func ReadCachedData(ctx context.Context, engine CacheEngine, key string) (*CachedData, error) {
+	data, err := engine.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var cachedData CachedData
+	if err := json.Unmarshal(data, &cachedData); err != nil {
+		return nil, errors.Join(ErrCacheFailure, err)
+	}
+	return &cachedData, nil
+}
+
+// ListCacheEntries describes all the entries of the cache.
+// Entries which cannot be decoded are listed with the CacheEntryUnknown kind,
+// and the ones which cannot be decrypted with the CacheEntryUndecryptable kind.
+func ListCacheEntries(ctx context.Context, engine CacheLister) ([]CacheEntryInfo, error) {
+	keys, err := engine.Keys(ctx)
+	if err != nil {
+		return nil, errors.Join(ErrCacheFailure, err)
+	}
+
+	entries := make([]CacheEntryInfo, 0, len(keys))
+	for _, key := range keys {
+		data, err := engine.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrCacheUndecryptable) {
+				entries = append(entries, CacheEntryInfo{Key: key, Kind: CacheEntryUndecryptable})
+				continue
+			}
+			if errors.Is(err, ErrCacheMiss) {
+				// Removed in the meantime
+				continue
+			}
+			return nil, errors.Join(ErrCacheFailure, err)
+		}
+		entries = append(entries, describeCacheEntry(key, data))
+	}
+	return entries, nil
+}
+
+// PruneCache removes the entries matching the filter and returns them.
+// With dryRun, the matching entries are only returned.
+// An empty filter is rejected to avoid wiping the whole cache by mistake.
+func PruneCache(ctx context.Context, engine CacheLister, filter CachePruneFilter, dryRun bool) ([]CacheEntryInfo, error) {
+	if filter.isZero() {
+		return nil, errors.New("at least one prune criterion is required")
+	}
+
+	entries, err := ListCacheEntries(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var pruned []CacheEntryInfo
+	for _, entry := range entries {
+		if !filter.match(entry, now) {
+			continue
+		}
+		if !dryRun {
+			if err := engine.Delete(ctx, entry.Key); err != nil {
+				return pruned, errors.Join(ErrCacheFailure, err)
+			}
+		}
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
+
+// ExportCache writes all the entries of the cache into a gzipped tar archive, one <key>.json file per entry.
+// It returns the number of exported entries. The entries which cannot be decrypted are skipped and logged:
+// list them with ListCacheEntries, and remove them with PruneCache.
+func ExportCache(ctx context.Context, engine CacheLister, w io.Writer) (int, error) {
+	keys, err := engine.Keys(ctx)
+	if err != nil {
+		return 0, errors.Join(ErrCacheFailure, err)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	count := 0
+	for _, key := range keys {
+		data, err := engine.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrCacheUndecryptable) {
+				logger.Printf("Skipping the export of cache entry %s: %v", key, err)
+				continue
+			}
+			if errors.Is(err, ErrCacheMiss) {
+				continue
+			}
+			return count, errors.Join(ErrCacheFailure, err)
+		}
+
+		hdr := &tar.Header{
+			Name:    key + ".json",
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return count, fmt.Errorf("failed to write archive entry header: %w", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return count, fmt.Errorf("failed to write archive entry: %w", err)
+		}
+		count++
+	}
+
+	if err := tw.Close(); err != nil {
+		return count, fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return count, fmt.Errorf("failed to close archive: %w", err)
+	}
+	return count, nil
+}
+
+// ImportCache stores in the cache all the entries of a gzipped tar archive created by ExportCache.
+// Existing entries with the same keys are overwritten. It returns the number of imported entries.
+func ImportCache(ctx context.Context, engine CacheEngine, r io.Reader) (int, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gr.Close() //nolint:errcheck
+
+	tr := tar.NewReader(gr)
+	count := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Base(hdr.Name)
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		key := strings.TrimSuffix(name, ".json")
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return count, fmt.Errorf("failed to read archive entry %s: %w", hdr.Name, err)
+		}
+		if err := engine.Set(ctx, key, data); err != nil {
+			return count, errors.Join(ErrCacheFailure, err)
+		}
+		count++
+	}
+}
+
+func describeCacheEntry(key string, data []byte) CacheEntryInfo {
+	info := CacheEntryInfo{Key: key, Kind: CacheEntryUnknown, Size: len(data)}
+
+	var cachedData CachedData
+	if err := json.Unmarshal(data, &cachedData); err != nil {
+		return info
+	}
+	info.CreatedAt = cachedData.CreatedAt
+
+	switch {
+	case cachedData.ChatCompletionRequest != nil:
+		info.Kind = CacheEntryChatCompletion
+		if cachedData.CompletionChunks != nil {
+			info.Kind = CacheEntryChatCompletionStream
+		}
+		info.Model = cachedData.ChatCompletionRequest.Model
+		info.FirstUserMessage = firstUserMessageText(cachedData.ChatCompletionRequest.Messages)
+	case cachedData.EmbeddingRequest != nil:
+		info.Kind = CacheEntryEmbedding
+		info.Model = cachedData.EmbeddingRequest.Model
+		if len(cachedData.EmbeddingRequest.Input) > 0 {
+			info.FirstUserMessage = cachedData.EmbeddingRequest.Input[0]
+		}
+	}
+	return info
+}
+
+func firstUserMessageText(messages []ChatMessage) string {
+	for _, msg := range messages {
+		if msg.Role() != RoleUser || msg.Content() == nil {
+			continue
+		}
+		if text := msg.Content().String(); text != "" {
+			return text
+		}
+		for _, chunk := range msg.Content().Chunks() {
+			if tc, ok := chunk.(*TextChunk); ok {
+				return tc.Text
+			}
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package mistral_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+func newFilledCacheEngine(t *testing.T) mistral.CacheLister {
+	t.Helper()
+
+	engine, err := mistral.NewLocalFsCacheEngine(t.TempDir())
+	assert.NoError(t, err)
+
+	ctx := context.TODO()
+	entries := map[string]mistral.CachedData{
+		"chat": {
+			Key:       "chat",
+			CreatedAt: time.Now().Add(-48 * time.Hour),
+			ChatCompletionRequest: mistral.NewChatCompletionRequest("mistral-small-latest", []mistral.ChatMessage{
+				mistral.NewSystemMessageFromString("You are a helpful assistant"),
+				mistral.NewUserMessageFromString("What is the capital of France?"),
+			}),
+			ChatCompletionResponse: &mistral.ChatCompletionResponse{
+				Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Paris")}},
+			},
+		},
+		"stream": {
+			Key:       "stream",
+			CreatedAt: time.Now(),
+			ChatCompletionRequest: mistral.NewChatCompletionStreamRequest("mistral-large-latest", []mistral.ChatMessage{
+				mistral.NewUserMessage(mistral.ContentChunks{
+					mistral.NewImageUrlChunk("https://example.com/cat.png"),
+					mistral.NewTextChunk("Describe this image"),
+				}),
+			}),
+			CompletionChunks: []*mistral.CompletionChunk{},
+		},
+		"embed": {
+			Key:              "embed",
+			CreatedAt:        time.Now(),
+			EmbeddingRequest: mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}),
+			EmbeddingResponse: &mistral.EmbeddingResponse{
+				Data: []mistral.EmbeddingData{{Embedding: []float32{0.1, 0.2}}},
+			},
+		},
+	}
+	for key, entry := range entries {
+		data, err := json.Marshal(entry)
+		assert.NoError(t, err)
+		assert.NoError(t, engine.Set(ctx, key, data))
+	}
+	assert.NoError(t, engine.Set(ctx, "garbage", []byte("not json")))
+
+	return engine
+}
+
+func TestListCacheEntries(t *testing.T) {
+	// Given
+	engine := newFilledCacheEngine(t)
+
+	// When
+	entries, err := mistral.ListCacheEntries(context.TODO(), engine)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	byKey := make(map[string]mistral.CacheEntryInfo)
+	for _, e := range entries {
+		byKey[e.Key] = e
+	}
+
+	assert.Equal(t, mistral.CacheEntryChatCompletion, byKey["chat"].Kind)
+	assert.Equal(t, "mistral-small-latest", byKey["chat"].Model)
+	assert.Equal(t, "What is the capital of France?", byKey["chat"].FirstUserMessage)
+	assert.Positive(t, byKey["chat"].Size)
+
+	assert.Equal(t, mistral.CacheEntryChatCompletionStream, byKey["stream"].Kind)
+	assert.Equal(t, "mistral-large-latest", byKey["stream"].Model)
+	assert.Equal(t, "Describe this image", byKey["stream"].FirstUserMessage)
+
+	assert.Equal(t, mistral.CacheEntryEmbedding, byKey["embed"].Kind)
+	assert.Equal(t, "hello", byKey["embed"].FirstUserMessage)
+
+	assert.Equal(t, mistral.CacheEntryUnknown, byKey["garbage"].Kind)
+}
+
+func TestReadCachedData(t *testing.T) {
+	engine := newFilledCacheEngine(t)
+
+	t.Run("should decode an entry", func(t *testing.T) {
+		data, err := mistral.ReadCachedData(context.TODO(), engine, "chat")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Paris", data.ChatCompletionResponse.AssistantMessage().Content().String())
+	})
+
+	t.Run("should return a cache miss for unknown keys", func(t *testing.T) {
+		_, err := mistral.ReadCachedData(context.TODO(), engine, "unknown")
+
+		assert.ErrorIs(t, err, mistral.ErrCacheMiss)
+	})
+}
+
+func TestPruneCache(t *testing.T) {
+	t.Run("should remove entries older than the given duration", func(t *testing.T) {
+		// Given
+		engine := newFilledCacheEngine(t)
+		ctx := context.TODO()
+
+		// When
+		pruned, err := mistral.PruneCache(ctx, engine, mistral.CachePruneFilter{OlderThan: 24 * time.Hour}, false)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Len(t, pruned, 1)
+		keys, _ := engine.Keys(ctx)
+		assert.ElementsMatch(t, []string{"embed", "stream", "garbage"}, keys, "the age of garbage is unknown")
+	})
+
+	t.Run("should only list matching entries on dry run", func(t *testing.T) {
+		// Given
+		engine := newFilledCacheEngine(t)
+		ctx := context.TODO()
+
+		// When
+		pruned, err := mistral.PruneCache(ctx, engine, mistral.CachePruneFilter{Model: "mistral-embed"}, true)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Len(t, pruned, 1)
+		assert.Equal(t, "embed", pruned[0].Key)
+		keys, _ := engine.Keys(ctx)
+		assert.Len(t, keys, 4)
+	})
+
+	t.Run("should combine criteria", func(t *testing.T) {
+		// Given
+		engine := newFilledCacheEngine(t)
+		ctx := context.TODO()
+
+		// When
+		pruned, err := mistral.PruneCache(ctx, engine, mistral.CachePruneFilter{
+			Model:      "mistral-small-latest",
+			LargerThan: 1 << 20,
+		}, false)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Empty(t, pruned)
+	})
+
+	t.Run("should reject an empty filter", func(t *testing.T) {
+		engine := newFilledCacheEngine(t)
+
+		_, err := mistral.PruneCache(context.TODO(), engine, mistral.CachePruneFilter{}, false)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestUndecryptableCacheEntries(t *testing.T) {
+	ctx := context.TODO()
+
+	newEngine := func(t *testing.T) mistral.CacheLister {
+		inner := newFilledCacheEngine(t)
+		retired, err := mistral.NewEncryptedCacheEngine(inner, cacheKey2)
+		assert.NoError(t, err)
+		assert.NoError(t, retired.Set(ctx, "retired", []byte(`{"Key": "retired"}`)))
+		assert.NoError(t, inner.Delete(ctx, "garbage"))
+
+		engine, err := mistral.NewEncryptedCacheEngine(inner, cacheKey1)
+		assert.NoError(t, err)
+		_, err = engine.RotateKeys(ctx)
+		assert.NoError(t, err)
+		return engine
+	}
+
+	t.Run("should list the entries which cannot be decrypted", func(t *testing.T) {
+		// Given
+		engine := newEngine(t)
+
+		// When
+		entries, err := mistral.ListCacheEntries(ctx, engine)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Len(t, entries, 4)
+		for _, e := range entries {
+			if e.Key == "retired" {
+				assert.Equal(t, mistral.CacheEntryUndecryptable, e.Kind)
+			} else {
+				assert.NotEqual(t, mistral.CacheEntryUndecryptable, e.Kind)
+			}
+		}
+	})
+
+	t.Run("should prune the entries which cannot be decrypted", func(t *testing.T) {
+		// Given
+		engine := newEngine(t)
+
+		// When
+		pruned, err := mistral.PruneCache(ctx, engine, mistral.CachePruneFilter{Undecryptable: true}, false)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Len(t, pruned, 1)
+		assert.Equal(t, "retired", pruned[0].Key)
+		keys, _ := engine.Keys(ctx)
+		assert.ElementsMatch(t, []string{"chat", "stream", "embed"}, keys)
+	})
+
+	t.Run("should skip the entries which cannot be decrypted on export", func(t *testing.T) {
+		// Given
+		engine := newEngine(t)
+
+		// When
+		var archive bytes.Buffer
+		exported, err := mistral.ExportCache(ctx, engine, &archive)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 3, exported)
+	})
+}
+
+func TestExportImportCache(t *testing.T) {
+	// Given
+	src := newFilledCacheEngine(t)
+	dst, err := mistral.NewLocalFsCacheEngine(t.TempDir())
+	assert.NoError(t, err)
+	ctx := context.TODO()
+
+	// When
+	var archive bytes.Buffer
+	exported, errExport := mistral.ExportCache(ctx, src, &archive)
+	imported, errImport := mistral.ImportCache(ctx, dst, &archive)
+
+	// Then
+	assert.NoError(t, errExport)
+	assert.NoError(t, errImport)
+	assert.Equal(t, 4, exported)
+	assert.Equal(t, 4, imported)
+
+	keys, _ := dst.Keys(ctx)
+	assert.Len(t, keys, 4)
+	for _, key := range keys {
+		expected, _ := src.Get(ctx, key)
+		actual, _ := dst.Get(ctx, key)
+		assert.Equal(t, expected, actual)
+	}
+}
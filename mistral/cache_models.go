@@ -0,0 +1,267 @@
+package mistral
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultModelsCacheTTL is the default duration models metadata are kept in the cache decorator.
+	DefaultModelsCacheTTL = time.Hour
+)
+
+// WithModelsCacheTTL sets how long the models list and model cards are kept in memory
+// before being fetched again. A zero or negative TTL disables models caching.
+func WithModelsCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *cachedClientDecorator) {
+		c.models.ttl = ttl
+	}
+}
+
+// WithModelsBackgroundRefresh makes the cache decorator keep serving expired models metadata
+// while refreshing them in the background, instead of blocking the caller until they are fetched again.
+func WithModelsBackgroundRefresh() CacheOption {
+	return func(c *cachedClientDecorator) {
+		c.models.backgroundRefresh = true
+	}
+}
+
+type modelCardEntry struct {
+	card      *BaseModelCard
+	fetchedAt time.Time
+}
+
+// modelCache keeps models metadata in memory for a limited time.
+type modelCache struct {
+	ttl               time.Duration
+	backgroundRefresh bool
+
+	mu         sync.RWMutex
+	models     []*BaseModelCard
+	listedAt   time.Time
+	cards      map[string]modelCardEntry
+	refreshing bool
+
+	listCalls flightGroup[[]*BaseModelCard]
+	cardCalls flightGroup[*BaseModelCard]
+}
+
+func newModelCache(ttl time.Duration) *modelCache {
+	return &modelCache{
+		ttl:   ttl,
+		cards: make(map[string]modelCardEntry),
+	}
+}
+
+func (m *modelCache) enabled() bool {
+	return m.ttl > 0
+}
+
+// list returns the cached models list, whether it is still fresh and whether there was one.
+func (m *modelCache) list() ([]*BaseModelCard, bool, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.listedAt.IsZero() {
+		return nil, false, false
+	}
+	return m.models, time.Since(m.listedAt) < m.ttl, true
+}
+
+func (m *modelCache) storeList(models []*BaseModelCard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.models = models
+	m.listedAt = time.Now()
+}
+
+// card returns the cached model card fetched for the given ID, whether it is still fresh and whether there was one.
+func (m *modelCache) card(modelId string) (*BaseModelCard, bool, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.cards[modelId]
+	if !ok {
+		return nil, false, false
+	}
+	return entry.card, time.Since(entry.fetchedAt) < m.ttl, true
+}
+
+func (m *modelCache) storeCard(modelId string, card *BaseModelCard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cards[modelId] = modelCardEntry{card: card, fetchedAt: time.Now()}
+}
+
+// startRefresh returns true if no background refresh is already running.
+func (m *modelCache) startRefresh() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refreshing {
+		return false
+	}
+	m.refreshing = true
+	return true
+}
+
+func (m *modelCache) endRefresh() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshing = false
+}
+
+// ListModels returns the cached models list while it is fresh, fetching it again once expired.
+func (c *cachedClientDecorator) ListModels(ctx context.Context) ([]*BaseModelCard, error) {
+	if !c.models.enabled() {
+		return c.client.ListModels(ctx)
+	}
+
+	models, fromCache, err := c.listModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return copyModelCards(models, fromCache), nil
+}
+
+// SearchModels filters the cached models list instead of downloading it on every call.
+func (c *cachedClientDecorator) SearchModels(ctx context.Context, capabilities *ModelCapabilities) ([]*BaseModelCard, error) {
+	if !c.models.enabled() {
+		return c.client.SearchModels(ctx, capabilities)
+	}
+
+	models, fromCache, err := c.listModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*BaseModelCard
+	for _, model := range models {
+		if model.Match(capabilities) {
+			filtered = append(filtered, model)
+		}
+	}
+	return copyModelCards(filtered, fromCache), nil
+}
+
+// GetModel answers from the cached models list when there is one, resolving the model aliases too.
+// Otherwise, the model card is fetched and cached on its own.
+// When the model is missing from an expired list, the API is asked directly so that recently
+// added models are found; ErrModelNotFound is returned if it does not know the model either.
+func (c *cachedClientDecorator) GetModel(ctx context.Context, modelId string) (*BaseModelCard, error) {
+	if !c.models.enabled() {
+		return c.client.GetModel(ctx, modelId)
+	}
+
+	if models, fresh, ok := c.models.list(); ok && (fresh || c.models.backgroundRefresh) {
+		if !fresh {
+			c.refreshModelsInBackground(ctx)
+		}
+		if card := findModelCard(models, modelId); card != nil {
+			return copyModelCard(card, true), nil
+		}
+		if fresh {
+			return nil, ErrModelNotFound
+		}
+	}
+
+	if card, fresh, ok := c.models.card(modelId); ok && fresh {
+		return copyModelCard(card, true), nil
+	}
+
+	card, err := c.models.cardCalls.Do(ctx, modelId, func(ctx context.Context) (*BaseModelCard, error) {
+		card, err := c.client.GetModel(ctx, modelId)
+		if err != nil {
+			return nil, err
+		}
+		c.models.storeCard(modelId, card)
+		return card, nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrModelNotFound) {
+			return nil, ErrModelNotFound
+		}
+		return nil, err
+	}
+	return copyModelCard(card, false), nil
+}
+
+// listModels returns the models list, and whether it was served by the cache rather than fetched.
+func (c *cachedClientDecorator) listModels(ctx context.Context) ([]*BaseModelCard, bool, error) {
+	models, fresh, ok := c.models.list()
+	if ok && fresh {
+		return models, true, nil
+	}
+	if ok && c.models.backgroundRefresh {
+		c.refreshModelsInBackground(ctx)
+		return models, true, nil
+	}
+	models, err := c.fetchModels(ctx)
+	return models, false, err
+}
+
+func (c *cachedClientDecorator) fetchModels(ctx context.Context) ([]*BaseModelCard, error) {
+	return c.models.listCalls.Do(ctx, "", func(ctx context.Context) ([]*BaseModelCard, error) {
+		models, err := c.client.ListModels(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.models.storeList(models)
+		return models, nil
+	})
+}
+
+func (c *cachedClientDecorator) refreshModelsInBackground(ctx context.Context) {
+	if !c.models.startRefresh() {
+		return
+	}
+
+	go func() {
+		defer c.models.endRefresh()
+		if _, err := c.fetchModels(context.WithoutCancel(ctx)); err != nil {
+			logger.Printf("Failed to refresh models cache: %v", err)
+		}
+	}()
+}
+
+// findModelCard looks for a model by its ID first, then by its aliases.
+func findModelCard(models []*BaseModelCard, modelId string) *BaseModelCard {
+	for _, model := range models {
+		if model.Id == modelId {
+			return model
+		}
+	}
+	for _, model := range models {
+		for _, alias := range model.Aliases {
+			if alias == modelId {
+				return model
+			}
+		}
+	}
+	return nil
+}
+
+// copyModelCard copies the card, replacing the metadata of the call which fetched it when served by the cache.
+func copyModelCard(card *BaseModelCard, fromCache bool) *BaseModelCard {
+	if card == nil {
+		return nil
+	}
+	cp := *card
+	if card.Aliases != nil {
+		cp.Aliases = append([]string(nil), card.Aliases...)
+	}
+	if fromCache {
+		cp.Metadata = ResponseMetadata{FromCache: true}
+	}
+	return &cp
+}
+
+func copyModelCards(models []*BaseModelCard, fromCache bool) []*BaseModelCard {
+	if models == nil {
+		return nil
+	}
+	res := make([]*BaseModelCard, len(models))
+	for i, model := range models {
+		res[i] = copyModelCard(model, fromCache)
+	}
+	return res
+}
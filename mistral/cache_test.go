@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -130,6 +131,7 @@ func TestCachedClientDecorator_ChatCompletion(t *testing.T) {
 
 		// Then
 		assert.NoError(t, err)
+		expectedResp.Metadata.FromCache = true
 		assert.Equal(t, expectedResp, res)
 	})
 
@@ -325,9 +327,140 @@ func TestCachedClientDecorator_ChatCompletion(t *testing.T) {
 		assert.ErrorIs(t, err, expectedErr)
 		assert.ErrorIs(t, err, mistral.ErrCacheFailure)
 	})
+	t.Run("should call API only once for concurrent identical requests", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		ctx := context.TODO()
+
+		expectedResp := &mistral.ChatCompletionResponse{
+			Choices: []mistral.ChatCompletionChoice{
+				{Message: mistral.NewAssistantMessageFromString("Hello")},
+			},
+		}
+
+		req := mistral.NewChatCompletionRequest("mistral-tiny",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Eq(req)).
+			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+				time.Sleep(100 * time.Millisecond)
+				return expectedResp, nil
+			}).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil).
+			Times(1)
+
+		// When
+		const n = 5
+		var wg sync.WaitGroup
+		results := make([]*mistral.ChatCompletionResponse, n)
+		errs := make([]error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], errs[i] = c.ChatCompletion(ctx, req)
+			}(i)
+		}
+		wg.Wait()
+
+		// Then
+		for i := 0; i < n; i++ {
+			assert.NoError(t, errs[i])
+			assert.Equal(t, expectedResp, results[i])
+		}
+
+		// Each caller gets its own copy of the shared response
+		results[0].Metadata.ServedBy = "mistral-small"
+		results[0].Choices[0].Message.Prefix = true
+		assert.Empty(t, results[1].Metadata.ServedBy)
+		assert.False(t, results[1].Choices[0].Message.Prefix)
+		assert.False(t, expectedResp.Choices[0].Message.Prefix)
+	})
+
+	t.Run("should still serve the waiting callers when the first caller cancels", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		expectedResp := &mistral.ChatCompletionResponse{
+			Choices: []mistral.ChatCompletionChoice{
+				{Message: mistral.NewAssistantMessageFromString("Hello")},
+			},
+		}
+
+		req := mistral.NewChatCompletionRequest("mistral-tiny",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
+
+		started := make(chan struct{})
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Eq(req)).
+			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+				close(started)
+				time.Sleep(100 * time.Millisecond)
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return expectedResp, nil
+			}).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, _ string, _ []byte) error {
+				return ctx.Err()
+			}).
+			Times(1)
+
+		leaderCtx, cancel := context.WithCancel(context.TODO())
+
+		// When
+		var leaderErr error
+		leaderDone := make(chan struct{})
+		go func() {
+			defer close(leaderDone)
+			_, leaderErr = c.ChatCompletion(leaderCtx, req)
+		}()
+		<-started
+		cancel()
+		res, err := c.ChatCompletion(context.TODO(), req)
+		<-leaderDone
+
+		// Then
+		assert.ErrorIs(t, leaderErr, context.Canceled)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedResp, res)
+	})
 }
 
 func TestCachedClientDecorator_Embeddings(t *testing.T) {
+	const (
+		helloCacheKey = "3a562c43e98d52f12328384b8c6c1a66cab30cb41c7790eeccf4fbea26963229"
+		worldCacheKey = "24e58bb1c21949c66a17a43c4d9f37c0145dbebfbf438692c6b4709d7fd78df6"
+	)
+
 	t.Run("should return cached request and never call the API", func(t *testing.T) {
 		// Given
 		ctrl := gomock.NewController(t)
@@ -338,8 +471,10 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 
 		ctx := context.TODO()
 
-		cacheKey := "f85ff9609db6e0a65d1cff1b05188bca6de5e7dcb3e9f3c02a2579765fc4b063"
-		expectedResp := &mistral.EmbeddingResponse{
+		cachedResp := &mistral.EmbeddingResponse{
+			ID:    "embd-1",
+			Model: "mistral-embed",
+			Usage: mistral.UsageInfo{PromptTokens: 2, TotalTokens: 2},
 			Data: []mistral.EmbeddingData{
 				{Embedding: []float32{0.1, 0.2, 0.3}},
 			},
@@ -348,15 +483,15 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 		req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
 
 		expectedCachedData := mistral.CachedData{
-			Key:               cacheKey,
+			Key:               helloCacheKey,
 			CreatedAt:         time.Now(),
-			EmbeddingResponse: expectedResp,
+			EmbeddingResponse: cachedResp,
 			EmbeddingRequest:  req,
 		}
 		cachedJson, _ := json.Marshal(expectedCachedData)
 
 		mockEngine.EXPECT().
-			Get(gomock.AssignableToTypeOf(ctxType), gomock.Eq(cacheKey)).
+			Get(gomock.AssignableToTypeOf(ctxType), gomock.Eq(helloCacheKey)).
 			Return(cachedJson, nil).
 			Times(1)
 
@@ -369,7 +504,8 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 
 		// Then
 		assert.NoError(t, err)
-		assert.Equal(t, expectedResp, res)
+		cachedResp.Metadata.FromCache = true
+		assert.Equal(t, cachedResp, res)
 	})
 
 	t.Run("should call API when cache miss then save it", func(t *testing.T) {
@@ -390,16 +526,15 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 
 		req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
 
-		cacheKey := "f85ff9609db6e0a65d1cff1b05188bca6de5e7dcb3e9f3c02a2579765fc4b063"
 		expectedCacheData := mistral.CachedData{
-			Key:               cacheKey,
+			Key:               helloCacheKey,
 			CreatedAt:         time.Now(),
 			EmbeddingRequest:  req,
 			EmbeddingResponse: expectedResp,
 		}
 
 		mockEngine.EXPECT().
-			Get(gomock.AssignableToTypeOf(ctxType), gomock.Any()).
+			Get(gomock.AssignableToTypeOf(ctxType), gomock.Eq(helloCacheKey)).
 			Return(nil, mistral.ErrCacheMiss).
 			Times(1)
 
@@ -409,7 +544,7 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 			Times(1)
 
 		mockEngine.EXPECT().
-			Set(gomock.AssignableToTypeOf(ctxType), gomock.Eq(cacheKey), newCachedDataEq(t, expectedCacheData)).
+			Set(gomock.AssignableToTypeOf(ctxType), gomock.Eq(helloCacheKey), newCachedDataEq(t, expectedCacheData)).
 			Return(nil).
 			Times(1)
 
@@ -421,6 +556,169 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 		assert.Equal(t, expectedResp, res)
 	})
 
+	t.Run("should only send uncached inputs to the API and reassemble the response", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		ctx := context.TODO()
+
+		cachedJson, _ := json.Marshal(mistral.CachedData{
+			Key:              worldCacheKey,
+			EmbeddingRequest: mistral.NewEmbeddingRequest("mistral-embed", []string{"world"}),
+			EmbeddingResponse: &mistral.EmbeddingResponse{
+				ID:     "embd-old",
+				Object: "list",
+				Model:  "mistral-embed",
+				Usage:  mistral.UsageInfo{PromptTokens: 3, TotalTokens: 3},
+				Data: []mistral.EmbeddingData{
+					{Object: "embedding", Embedding: []float32{0.4, 0.5}},
+				},
+			},
+		})
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Eq(helloCacheKey)).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Eq(worldCacheKey)).
+			Return(cachedJson, nil).
+			Times(1)
+
+		mockClient.EXPECT().
+			Embeddings(gomock.Any(), gomock.Eq(mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))).
+			Return(&mistral.EmbeddingResponse{
+				ID:     "embd-new",
+				Object: "list",
+				Model:  "mistral-embed",
+				Usage:  mistral.UsageInfo{PromptTokens: 2, TotalTokens: 2},
+				Data: []mistral.EmbeddingData{
+					{Object: "embedding", Embedding: []float32{0.1, 0.2}, Index: 0},
+				},
+			}, nil).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Eq(helloCacheKey), gomock.Any()).
+			Return(nil).
+			Times(1)
+
+		req := mistral.NewEmbeddingRequest("mistral-embed", []string{"world", "hello", "world"})
+
+		// When
+		res, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, &mistral.EmbeddingResponse{
+			ID:     "embd-new",
+			Object: "list",
+			Model:  "mistral-embed",
+			Usage:  mistral.UsageInfo{PromptTokens: 2, TotalTokens: 2},
+			Data: []mistral.EmbeddingData{
+				{Object: "embedding", Embedding: []float32{0.4, 0.5}, Index: 0},
+				{Object: "embedding", Embedding: []float32{0.1, 0.2}, Index: 1},
+				{Object: "embedding", Embedding: []float32{0.4, 0.5}, Index: 2},
+			},
+			Metadata: mistral.ResponseMetadata{PartiallyCached: true},
+		}, res)
+	})
+
+	t.Run("should not share the cache entries between encoding formats", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"},
+			mistral.WithEmbeddingEncodingFormat(mistral.EmbeddingEncodingBase64))
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Not(gomock.Eq(helloCacheKey))).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		mockClient.EXPECT().
+			Embeddings(gomock.Any(), gomock.Eq(req)).
+			Return(&mistral.EmbeddingResponse{Data: []mistral.EmbeddingData{{Embedding: []float32{0.1}}}}, nil).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Not(gomock.Eq(helloCacheKey)), gomock.Any()).
+			Return(nil).
+			Times(1)
+
+		// When
+		_, err := c.Embeddings(context.TODO(), req)
+
+		// Then
+		assert.NoError(t, err)
+	})
+
+	t.Run("should prorate the upstream usage between the cached inputs", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		ctx := context.TODO()
+		req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello", "world"})
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(2)
+
+		mockClient.EXPECT().
+			Embeddings(gomock.Any(), gomock.Eq(req)).
+			Return(&mistral.EmbeddingResponse{
+				Usage: mistral.UsageInfo{PromptTokens: 5, TotalTokens: 5},
+				Data: []mistral.EmbeddingData{
+					{Embedding: []float32{0.3}, Index: 1},
+					{Embedding: []float32{0.1}, Index: 0},
+				},
+			}, nil).
+			Times(1)
+
+		var saved []mistral.CachedData
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, data []byte) error {
+				var d mistral.CachedData
+				if err := json.Unmarshal(data, &d); err != nil {
+					return err
+				}
+				saved = append(saved, d)
+				return nil
+			}).
+			Times(2)
+
+		// When
+		res, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.EmbeddingVector{{0.1}, {0.3}}, res.Embeddings())
+		assert.Equal(t, mistral.UsageInfo{PromptTokens: 5, TotalTokens: 5}, res.Usage)
+
+		assert.Len(t, saved, 2)
+		assert.Equal(t, helloCacheKey, saved[0].Key)
+		assert.Equal(t, []string{"hello"}, saved[0].EmbeddingRequest.Input)
+		assert.Equal(t, mistral.UsageInfo{PromptTokens: 3, TotalTokens: 3}, saved[0].EmbeddingResponse.Usage)
+		assert.Equal(t, worldCacheKey, saved[1].Key)
+		assert.Equal(t, []string{"world"}, saved[1].EmbeddingRequest.Input)
+		assert.Equal(t, mistral.UsageInfo{PromptTokens: 2, TotalTokens: 2}, saved[1].EmbeddingResponse.Usage)
+	})
+
 	t.Run("should return an error when input request is nil", func(t *testing.T) {
 		// Given
 		ctrl := gomock.NewController(t)
@@ -452,7 +750,7 @@ func TestCachedClientDecorator_Embeddings(t *testing.T) {
 		assert.Nil(t, res)
 	})
 
-	t.Run("should return error on client ChatCompletion failure", func(t *testing.T) {
+	t.Run("should return error on client Embeddings failure", func(t *testing.T) {
 		// Given
 		ctrl := gomock.NewController(t)
 		mockClient := mocks.NewMockClient(ctrl)
@@ -608,12 +906,18 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 		}
 		jsonData, _ := json.Marshal(cachedData)
 
+		// The last chunk flag and the metadata are not serialized but restored when replayed
+		chunks[3].IsLastChunk = true
+		for _, chunk := range chunks {
+			chunk.Metadata.FromCache = true
+		}
+
 		mockClient.EXPECT().
 			ChatCompletionStream(gomock.Any(), gomock.Any()).
 			Times(0)
 
 		mockEngine.EXPECT().
-			Get(gomock.Eq(ctx), gomock.Eq(cacheKey)).
+			Get(gomock.AssignableToTypeOf(ctxType), gomock.Eq(cacheKey)).
 			Return(jsonData, nil).
 			Times(1)
 
@@ -677,7 +981,7 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
 
 		mockClient.EXPECT().
-			ChatCompletionStream(gomock.Eq(ctx), gomock.Eq(req)).
+			ChatCompletionStream(gomock.AssignableToTypeOf(ctxType), gomock.Eq(req)).
 			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
 				res := make(chan *mistral.CompletionChunk)
 				go func() {
@@ -700,12 +1004,12 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 		}
 
 		mockEngine.EXPECT().
-			Get(gomock.Eq(ctx), gomock.Eq(cacheKey)).
+			Get(gomock.AssignableToTypeOf(ctxType), gomock.Eq(cacheKey)).
 			Return(nil, mistral.ErrCacheMiss).
 			Times(1)
 
 		mockEngine.EXPECT().
-			Set(gomock.Eq(ctx), gomock.Eq(cacheKey), newCachedDataEq(t, cachedData)).
+			Set(gomock.AssignableToTypeOf(ctxType), gomock.Eq(cacheKey), newCachedDataEq(t, cachedData)).
 			Return(nil).
 			Times(1)
 
@@ -770,7 +1074,7 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 		engSetErr := errors.New("some cache set error")
 
 		mockClient.EXPECT().
-			ChatCompletionStream(gomock.Eq(ctx), gomock.Eq(req)).
+			ChatCompletionStream(gomock.AssignableToTypeOf(ctxType), gomock.Eq(req)).
 			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
 				res := make(chan *mistral.CompletionChunk)
 				go func() {
@@ -791,12 +1095,12 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 		}
 
 		mockEngine.EXPECT().
-			Get(gomock.Eq(ctx), gomock.Any()).
+			Get(gomock.AssignableToTypeOf(ctxType), gomock.Any()).
 			Return(nil, mistral.ErrCacheMiss).
 			Times(1)
 
 		mockEngine.EXPECT().
-			Set(gomock.Eq(ctx), gomock.Any(), newCachedDataEq(t, cachedData)).
+			Set(gomock.AssignableToTypeOf(ctxType), gomock.Any(), newCachedDataEq(t, cachedData)).
 			Return(engSetErr).
 			Times(1)
 
@@ -841,7 +1145,7 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 		expectedErr := errors.New("some error")
 
 		mockClient.EXPECT().
-			ChatCompletionStream(gomock.Eq(ctx), gomock.Eq(req)).
+			ChatCompletionStream(gomock.AssignableToTypeOf(ctxType), gomock.Eq(req)).
 			Return(nil, expectedErr).
 			Times(1)
 
@@ -860,34 +1164,384 @@ func TestCachedClientDecorator_ChatCompletionStream(t *testing.T) {
 		// Then
 		assert.ErrorIs(t, err, expectedErr)
 	})
+	t.Run("should fan out a single upstream stream to concurrent subscribers", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		chunks := []*mistral.CompletionChunk{
+			{
+				Choices: []mistral.CompletionResponseStreamChoice{
+					{Delta: mistral.NewAssistantMessageFromString("Hello ")},
+				},
+			},
+			{
+				Choices: []mistral.CompletionResponseStreamChoice{
+					{Delta: mistral.NewAssistantMessageFromString("world!"), FinishReason: mistral.FinishReasonStop},
+				},
+			},
+		}
+
+		ctx := context.TODO()
+		req := mistral.NewChatCompletionStreamRequest("mistral-tiny",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
+
+		mockClient.EXPECT().
+			ChatCompletionStream(gomock.Any(), gomock.Eq(req)).
+			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+				res := make(chan *mistral.CompletionChunk)
+				go func() {
+					for _, chunk := range chunks {
+						time.Sleep(50 * time.Millisecond)
+						res <- chunk
+					}
+					close(res)
+				}()
+				return res, nil
+			}).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil).
+			Times(1)
+
+		// When
+		const n = 3
+		var wg sync.WaitGroup
+		received := make([][]*mistral.CompletionChunk, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i > 0 {
+					// Late subscribers must also receive the chunks already emitted
+					time.Sleep(70 * time.Millisecond)
+				}
+				chunkChan, err := c.ChatCompletionStream(ctx, req)
+				if !assert.NoError(t, err) {
+					return
+				}
+				for chunk := range chunkChan {
+					received[i] = append(received[i], chunk)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Then
+		for i := 0; i < n; i++ {
+			assert.Equal(t, chunks, received[i])
+		}
+
+		// Each subscriber gets its own copy of the shared chunks
+		received[0][0].Metadata.ServedBy = "mistral-small"
+		assert.Empty(t, received[1][0].Metadata.ServedBy)
+		assert.Empty(t, chunks[0].Metadata.ServedBy)
+	})
+	t.Run("should not cache a stream which ended with an error chunk", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		streamErr := errors.New("connection reset")
+		chunks := []*mistral.CompletionChunk{
+			{
+				Choices: []mistral.CompletionResponseStreamChoice{
+					{Delta: mistral.NewAssistantMessageFromString("Hello ")},
+				},
+			},
+			{Error: streamErr},
+		}
+
+		ctx := context.TODO()
+		req := mistral.NewChatCompletionStreamRequest("mistral-tiny",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
+
+		mockClient.EXPECT().
+			ChatCompletionStream(gomock.Any(), gomock.Eq(req)).
+			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+				res := make(chan *mistral.CompletionChunk)
+				go func() {
+					for _, chunk := range chunks {
+						res <- chunk
+					}
+					close(res)
+				}()
+				return res, nil
+			}).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(0)
+
+		// When
+		chunkChan, err := c.ChatCompletionStream(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		var received []*mistral.CompletionChunk
+		for chunk := range chunkChan {
+			received = append(received, chunk)
+		}
+		assert.Equal(t, chunks, received)
+	})
+
+	t.Run("should record chunk timings and replay them with the original pacing", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine, mistral.WithStreamReplaySpeed(2))
+
+		ctx := context.TODO()
+		req := mistral.NewChatCompletionStreamRequest("mistral-tiny",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
+
+		cachedJson, _ := json.Marshal(mistral.CachedData{
+			ChatCompletionRequest: req,
+			CompletionChunks: []*mistral.CompletionChunk{
+				{
+					Choices: []mistral.CompletionResponseStreamChoice{
+						{Delta: mistral.NewAssistantMessageFromString("Hello ")},
+					},
+				},
+				{
+					Choices: []mistral.CompletionResponseStreamChoice{
+						{Delta: mistral.NewAssistantMessageFromString("world!"), FinishReason: mistral.FinishReasonStop},
+					},
+				},
+			},
+			ChunkLatencies: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		})
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(cachedJson, nil).
+			Times(1)
+
+		// When
+		start := time.Now()
+		chunkChan, err := c.ChatCompletionStream(ctx, req)
+		assert.NoError(t, err)
+		var received []*mistral.CompletionChunk
+		for chunk := range chunkChan {
+			received = append(received, chunk)
+		}
+		elapsed := time.Since(start)
+
+		// Then
+		assert.Len(t, received, 2)
+		assert.GreaterOrEqual(t, elapsed, 150*time.Millisecond)
+		assert.Less(t, elapsed, 300*time.Millisecond)
+		assert.Equal(t, 100*time.Millisecond, received[0].ChunkLatency)
+		assert.Equal(t, 200*time.Millisecond, received[1].ChunkLatency)
+		assert.True(t, received[1].IsLastChunk)
+		assert.Equal(t, 300*time.Millisecond, received[1].TotalLatency)
+	})
+
+	t.Run("should save the chunk timings measured while streaming", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		ctx := context.TODO()
+		req := mistral.NewChatCompletionStreamRequest("mistral-tiny",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Say hello")})
+
+		mockClient.EXPECT().
+			ChatCompletionStream(gomock.Any(), gomock.Eq(req)).
+			DoAndReturn(func(ctx context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+				res := make(chan *mistral.CompletionChunk)
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					res <- &mistral.CompletionChunk{
+						Choices: []mistral.CompletionResponseStreamChoice{
+							{Delta: mistral.NewAssistantMessageFromString("Hello"), FinishReason: mistral.FinishReasonStop},
+						},
+					}
+					close(res)
+				}()
+				return res, nil
+			}).
+			Times(1)
+
+		mockEngine.EXPECT().
+			Get(gomock.Any(), gomock.Any()).
+			Return(nil, mistral.ErrCacheMiss).
+			Times(1)
+
+		saved := make(chan mistral.CachedData, 1)
+		mockEngine.EXPECT().
+			Set(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, data []byte) error {
+				var d mistral.CachedData
+				err := json.Unmarshal(data, &d)
+				saved <- d
+				return err
+			}).
+			Times(1)
+
+		// When
+		chunkChan, err := c.ChatCompletionStream(ctx, req)
+		assert.NoError(t, err)
+		for range chunkChan {
+		}
+
+		// Then
+		d := <-saved
+		assert.Len(t, d.ChunkLatencies, 1)
+		assert.GreaterOrEqual(t, d.ChunkLatencies[0], 50*time.Millisecond)
+	})
 }
 
 func TestCachedClientDecorator_ListModels(t *testing.T) {
-	// Given
-	ctrl := gomock.NewController(t)
-	mockClient := mocks.NewMockClient(ctrl)
-	mockEngine := mocks.NewMockEngine(ctrl)
+	t.Run("should call the API only once while the cache is fresh", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
 
-	c := mistral.NewCached(mockClient, mockEngine)
+		c := mistral.NewCached(mockClient, mockEngine)
 
-	models := []*mistral.BaseModelCard{
-		{Name: "mistral-small-latest"},
-		{Name: "mistral-large-latest"},
-	}
+		models := []*mistral.BaseModelCard{
+			{Name: "mistral-small-latest"},
+			{Name: "mistral-large-latest"},
+		}
 
-	ctx := context.TODO()
+		ctx := context.TODO()
 
-	mockClient.EXPECT().
-		ListModels(gomock.Eq(ctx)).
-		Return(models, nil).
-		Times(1)
+		mockClient.EXPECT().
+			ListModels(gomock.AssignableToTypeOf(ctxType)).
+			Return(models, nil).
+			Times(1)
 
-	// When
-	models, err := c.ListModels(ctx)
+		// When
+		res1, err1 := c.ListModels(ctx)
+		res2, err2 := c.ListModels(ctx)
 
-	// Then
-	assert.NoError(t, err)
-	assert.Len(t, models, 2)
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Equal(t, models, res1)
+		assert.Equal(t, []*mistral.BaseModelCard{
+			{Name: "mistral-small-latest", Metadata: mistral.ResponseMetadata{FromCache: true}},
+			{Name: "mistral-large-latest", Metadata: mistral.ResponseMetadata{FromCache: true}},
+		}, res2)
+	})
+
+	t.Run("should fetch models again once the TTL expired", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine, mistral.WithModelsCacheTTL(50*time.Millisecond))
+
+		ctx := context.TODO()
+
+		mockClient.EXPECT().
+			ListModels(gomock.Any()).
+			Return([]*mistral.BaseModelCard{{Id: "mistral-small-latest"}}, nil).
+			Times(2)
+
+		// When
+		_, err1 := c.ListModels(ctx)
+		time.Sleep(60 * time.Millisecond)
+		_, err2 := c.ListModels(ctx)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+	})
+
+	t.Run("should serve expired models while refreshing them in background", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine,
+			mistral.WithModelsCacheTTL(50*time.Millisecond),
+			mistral.WithModelsBackgroundRefresh())
+
+		ctx := context.TODO()
+
+		refreshed := make(chan struct{})
+		gomock.InOrder(
+			mockClient.EXPECT().
+				ListModels(gomock.Any()).
+				Return([]*mistral.BaseModelCard{{Id: "old-model"}}, nil).
+				Times(1),
+			mockClient.EXPECT().
+				ListModels(gomock.Any()).
+				DoAndReturn(func(ctx context.Context) ([]*mistral.BaseModelCard, error) {
+					defer close(refreshed)
+					return []*mistral.BaseModelCard{{Id: "new-model"}}, nil
+				}).
+				Times(1),
+		)
+
+		// When
+		_, err := c.ListModels(ctx)
+		assert.NoError(t, err)
+		time.Sleep(60 * time.Millisecond)
+		stale, err := c.ListModels(ctx)
+		assert.NoError(t, err)
+		<-refreshed
+
+		// Then
+		assert.Equal(t, "old-model", stale[0].Id)
+		assert.Eventually(t, func() bool {
+			res, err := c.ListModels(ctx)
+			return err == nil && res[0].Id == "new-model"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should always call the API when models caching is disabled", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine, mistral.WithModelsCacheTTL(0))
+
+		ctx := context.TODO()
+
+		mockClient.EXPECT().
+			ListModels(gomock.AssignableToTypeOf(ctxType)).
+			Return([]*mistral.BaseModelCard{}, nil).
+			Times(2)
+
+		// When
+		_, err1 := c.ListModels(ctx)
+		_, err2 := c.ListModels(ctx)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+	})
 }
 
 func TestCachedClientDecorator_SearchModels(t *testing.T) {
@@ -899,7 +1553,8 @@ func TestCachedClientDecorator_SearchModels(t *testing.T) {
 	c := mistral.NewCached(mockClient, mockEngine)
 
 	models := []*mistral.BaseModelCard{
-		{Name: "mistral-small-latest"},
+		{Name: "mistral-small-latest", Capabilities: mistral.ModelCapabilities{CompletionChat: true}},
+		{Name: "mistral-embed"},
 	}
 
 	ctx := context.TODO()
@@ -907,39 +1562,128 @@ func TestCachedClientDecorator_SearchModels(t *testing.T) {
 	in := &mistral.ModelCapabilities{CompletionChat: true}
 
 	mockClient.EXPECT().
-		SearchModels(gomock.Eq(ctx), gomock.Eq(in)).
+		ListModels(gomock.AssignableToTypeOf(ctxType)).
 		Return(models, nil).
 		Times(1)
 
+	mockClient.EXPECT().
+		SearchModels(gomock.Any(), gomock.Any()).
+		Times(0)
+
 	// When
-	models, err := c.SearchModels(ctx, in)
+	res1, err1 := c.SearchModels(ctx, in)
+	res2, err2 := c.SearchModels(ctx, in)
 
 	// Then
-	assert.NoError(t, err)
-	assert.Len(t, models, 1)
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Len(t, res1, 1)
+	assert.Equal(t, "mistral-small-latest", res1[0].Name)
+	assert.Len(t, res2, 1)
+	assert.Equal(t, "mistral-small-latest", res2[0].Name)
+	assert.True(t, res2[0].Metadata.FromCache)
 }
 
 func TestCachedClientDecorator_GetModel(t *testing.T) {
-	// Given
-	ctrl := gomock.NewController(t)
-	mockClient := mocks.NewMockClient(ctrl)
-	mockEngine := mocks.NewMockEngine(ctrl)
+	t.Run("should call the API and cache the model card when no models list is cached", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
 
-	c := mistral.NewCached(mockClient, mockEngine)
+		c := mistral.NewCached(mockClient, mockEngine)
 
-	ctx := context.TODO()
+		ctx := context.TODO()
 
-	model := &mistral.BaseModelCard{Name: "mistral-small-latest"}
+		model := &mistral.BaseModelCard{Name: "mistral-small-latest"}
 
-	mockClient.EXPECT().
-		GetModel(gomock.Eq(ctx), gomock.Eq("mistral-small-latest")).
-		Return(model, nil).
-		Times(1)
+		mockClient.EXPECT().
+			GetModel(gomock.AssignableToTypeOf(ctxType), gomock.Eq("mistral-small-latest")).
+			Return(model, nil).
+			Times(1)
 
-	// When
-	res, err := c.GetModel(ctx, "mistral-small-latest")
+		// When
+		res1, err1 := c.GetModel(ctx, "mistral-small-latest")
+		res2, err2 := c.GetModel(ctx, "mistral-small-latest")
 
-	// Then
-	assert.NoError(t, err)
-	assert.Equal(t, model, res)
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Equal(t, model, res1)
+		assert.False(t, res1.Metadata.FromCache)
+		assert.Equal(t, "mistral-small-latest", res2.Name)
+		assert.True(t, res2.Metadata.FromCache)
+	})
+
+	t.Run("should answer from the cached models list, resolving aliases", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine)
+
+		ctx := context.TODO()
+
+		model := &mistral.BaseModelCard{Id: "mistral-medium-2508", Aliases: []string{"mistral-medium-latest"}}
+
+		mockClient.EXPECT().
+			ListModels(gomock.Any()).
+			Return([]*mistral.BaseModelCard{model}, nil).
+			Times(1)
+
+		mockClient.EXPECT().
+			GetModel(gomock.Any(), gomock.Any()).
+			Times(0)
+
+		_, err := c.ListModels(ctx)
+		assert.NoError(t, err)
+
+		// When
+		byId, err1 := c.GetModel(ctx, "mistral-medium-2508")
+		byAlias, err2 := c.GetModel(ctx, "mistral-medium-latest")
+		_, err3 := c.GetModel(ctx, "unknown-model")
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		model.Metadata.FromCache = true
+		assert.Equal(t, model, byId)
+		assert.Equal(t, model, byAlias)
+		assert.ErrorIs(t, err3, mistral.ErrModelNotFound)
+	})
+
+	t.Run("should ask the API and return ErrModelNotFound on a miss in an expired models list", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockEngine := mocks.NewMockEngine(ctrl)
+
+		c := mistral.NewCached(mockClient, mockEngine,
+			mistral.WithModelsCacheTTL(50*time.Millisecond),
+			mistral.WithModelsBackgroundRefresh())
+
+		ctx := context.TODO()
+
+		mockClient.EXPECT().
+			ListModels(gomock.Any()).
+			Return([]*mistral.BaseModelCard{{Id: "mistral-small-latest"}}, nil).
+			MinTimes(1)
+
+		mockClient.EXPECT().
+			GetModel(gomock.Any(), gomock.Eq("unknown-model")).
+			Return(nil, mistral.ErrModelNotFound).
+			Times(1)
+
+		_, err := c.ListModels(ctx)
+		assert.NoError(t, err)
+		time.Sleep(60 * time.Millisecond)
+
+		// When
+		res, err := c.GetModel(ctx, "unknown-model")
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrModelNotFound)
+		assert.Nil(t, res)
+	})
 }
@@ -0,0 +1,367 @@
+package mistral
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CassetteMode defines how a CassetteTransport uses its cassette file.
+type CassetteMode int
+
+const (
+	// CassetteRecordOnce replays the cassette if the file exists, records it otherwise.
+	CassetteRecordOnce CassetteMode = iota
+
+	// CassetteReplay only replays the recorded interactions and never reaches the network.
+	CassetteReplay
+
+	// CassetteRecord always reaches the network and records all the interactions, replacing the previous ones.
+	CassetteRecord
+
+	// CassetteReplayOrRecord replays the matching interactions, and records the requests not recorded yet.
+	CassetteReplayOrRecord
+)
+
+const redactedHeaderValue = "REDACTED"
+
+var (
+	ErrCassetteNoMatch = errors.New("no recorded interaction matches the request")
+
+	defaultRedactedHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"X-Api-Key",
+		"Api-Key",
+		"Ocp-Apim-Subscription-Key",
+	}
+)
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// CassetteInteraction is a recorded request and its response.
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// CassetteResponse is a recorded response. Streaming (SSE) responses are stored with their whole body,
+// and only once it has been read to its end: an interrupted stream is not recorded.
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// CassetteTransport is an http.RoundTripper recording the API interactions to a cassette file,
+// and replaying them, typically in tests. Use it with WithClientTransport.
+//
+// Requests are matched on their method, path, query and normalized body (query parameters and JSON bodies are
+// compared regardless of their order and formatting). Identical requests are replayed in the recorded order,
+// the last matching interaction being replayed again once all of them are used.
+// Sensitive headers, such as Authorization, are redacted before being recorded.
+type CassetteTransport struct {
+	path            string
+	mode            CassetteMode
+	transport       http.RoundTripper
+	redactedHeaders []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// CassetteOption configures a CassetteTransport.
+type CassetteOption func(t *CassetteTransport)
+
+// WithCassetteMode sets the recording mode (CassetteRecordOnce by default).
+func WithCassetteMode(mode CassetteMode) CassetteOption {
+	return func(t *CassetteTransport) {
+		t.mode = mode
+	}
+}
+
+// WithCassetteRedactedHeaders adds headers to redact, in addition to Authorization and the other default ones.
+func WithCassetteRedactedHeaders(headers ...string) CassetteOption {
+	return func(t *CassetteTransport) {
+		t.redactedHeaders = append(t.redactedHeaders, headers...)
+	}
+}
+
+// WithCassetteRecordingTransport sets the transport used to reach the network when recording
+// (http.DefaultTransport by default).
+func WithCassetteRecordingTransport(transport http.RoundTripper) CassetteOption {
+	return func(t *CassetteTransport) {
+		t.transport = transport
+	}
+}
+
+// NewCassetteTransport creates a transport recording to, or replaying from, the given cassette file.
+func NewCassetteTransport(path string, opts ...CassetteOption) (*CassetteTransport, error) {
+	t := &CassetteTransport{
+		path:            path,
+		mode:            CassetteRecordOnce,
+		transport:       http.DefaultTransport,
+		redactedHeaders: append([]string{}, defaultRedactedHeaders...),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if t.mode == CassetteRecordOnce {
+			t.mode = CassetteReplay
+		}
+		if t.mode != CassetteRecord {
+			if err := json.Unmarshal(data, &t.cassette); err != nil {
+				return nil, fmt.Errorf("invalid cassette file %s: %w", path, err)
+			}
+		}
+	case os.IsNotExist(err):
+		if t.mode == CassetteReplay {
+			return nil, fmt.Errorf("cassette file %s not found", path)
+		}
+		if t.mode == CassetteRecordOnce {
+			t.mode = CassetteRecord
+		}
+	default:
+		return nil, fmt.Errorf("failed to read cassette file: %w", err)
+	}
+
+	t.used = make([]bool, len(t.cassette.Interactions))
+	return t, nil
+}
+
+// Cassette returns a copy of the interactions recorded or loaded so far.
+func (t *CassetteTransport) Cassette() Cassette {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Cassette{Interactions: append([]CassetteInteraction{}, t.cassette.Interactions...)}
+}
+
+func (t *CassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close() //nolint:errcheck
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.mode != CassetteRecord {
+		if interaction, ok := t.match(req, body); ok {
+			return interaction.Response.toHttpResponse(req), nil
+		}
+		if t.mode == CassetteReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrCassetteNoMatch, req.Method, req.URL.RequestURI())
+		}
+	}
+
+	return t.record(req, body)
+}
+
+func (t *CassetteTransport) match(req *http.Request, body []byte) (CassetteInteraction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	normalized := normalizeCassetteBody(body)
+	query := normalizeCassetteQuery(req.URL.RawQuery)
+	last := -1
+	for i, interaction := range t.cassette.Interactions {
+		r := interaction.Request
+		if r.Method != req.Method || r.Path != req.URL.Path || normalizeCassetteQuery(r.Query) != query ||
+			normalizeCassetteBody([]byte(r.Body)) != normalized {
+			continue
+		}
+		if !t.used[i] {
+			t.used[i] = true
+			return interaction, true
+		}
+		last = i
+	}
+	if last >= 0 {
+		return t.cassette.Interactions[last], true
+	}
+	return CassetteInteraction{}, false
+}
+
+func (t *CassetteTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := CassetteInteraction{
+		Request: CassetteRequest{
+			Method:  req.Method,
+			Path:    req.URL.Path,
+			Query:   req.URL.RawQuery,
+			Headers: t.redact(req.Header),
+			Body:    string(body),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    t.redact(resp.Header),
+		},
+	}
+
+	// Streaming bodies are recorded as they are read, so the caller receives the events without delay
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &recordingBody{
+			body: resp.Body,
+			onDone: func(data []byte) error {
+				interaction.Response.Body = string(data)
+				return t.save(interaction)
+			},
+		}
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close() //nolint:errcheck
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction.Response.Body = string(respBody)
+	if err := t.save(interaction); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save appends the interaction to the cassette and writes the cassette file.
+func (t *CassetteTransport) save(interaction CassetteInteraction) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	t.used = append(t.used, true)
+
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create cassette dir: %w", err)
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette file: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("failed to write cassette file: %w", err)
+	}
+	return nil
+}
+
+func (t *CassetteTransport) redact(headers http.Header) http.Header {
+	res := headers.Clone()
+	for _, name := range t.redactedHeaders {
+		if _, ok := res[http.CanonicalHeaderKey(name)]; ok {
+			res.Set(name, redactedHeaderValue)
+		}
+	}
+	return res
+}
+
+func (r CassetteResponse) toHttpResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode:    r.StatusCode,
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Headers.Clone(),
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// normalizeCassetteBody re-encodes JSON bodies so that formatting and keys order are ignored.
+func normalizeCassetteBody(body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	return string(normalized)
+}
+
+// normalizeCassetteQuery sorts the query parameters so that their order is ignored.
+func normalizeCassetteQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	return values.Encode()
+}
+
+// recordingBody copies the body being read, and hands it over once fully read,
+// or when closed after the end of the events ([DONE]). A body closed before its end is not handed over.
+type recordingBody struct {
+	body   io.ReadCloser
+	buf    bytes.Buffer
+	once   sync.Once
+	onDone func(data []byte) error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		if doneErr := b.done(true); doneErr != nil {
+			return n, doneErr
+		}
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.body.Close()
+	if doneErr := b.done(bytes.Contains(b.buf.Bytes(), []byte("data: [DONE]"))); doneErr != nil {
+		return doneErr
+	}
+	return err
+}
+
+func (b *recordingBody) done(complete bool) error {
+	var err error
+	b.once.Do(func() {
+		if complete {
+			err = b.onDone(b.buf.Bytes())
+		}
+	})
+	return err
+}
@@ -0,0 +1,225 @@
+package mistral_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+const cassetteChatResponse = `{"id":"aa","object":"chat.completion","created":1768084548,"model":"mistral-small-latest","choices":[{"index":0,"message":{"role":"assistant","content":"Hello world!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"total_tokens":5,"completion_tokens":2}}`
+
+var cassetteStreamEvents = []string{
+	`data: {"id":"aa","object":"chat.completion.chunk","created":1768084548,"model":"mistral-small-latest","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello "},"finish_reason":null}]}`,
+	`data: {"id":"aa","object":"chat.completion.chunk","created":1768084548,"model":"mistral-small-latest","choices":[{"index":0,"delta":{"content":"world!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"total_tokens":5,"completion_tokens":2}}`,
+	`data: [DONE]`,
+}
+
+func newCassetteServer(t *testing.T, calls *int) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Set-Cookie", "session=secret")
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, evt := range cassetteStreamEvents {
+				fmt.Fprintf(w, "%s\n\n", evt) //nolint:errcheck
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(cassetteChatResponse))
+	}))
+}
+
+func TestCassetteTransport(t *testing.T) {
+	ctx := context.TODO()
+	msgs := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hello!")}
+
+	t.Run("should record then replay chat completions and streams", func(t *testing.T) {
+		// Given
+		calls := 0
+		server := newCassetteServer(t, &calls)
+		path := filepath.Join(t.TempDir(), "fixtures", "chat.json")
+
+		recorder, err := mistral.NewCassetteTransport(path)
+		assert.NoError(t, err)
+		c := mistral.New("secretApiKey",
+			mistral.WithBaseApiUrl(server.URL),
+			mistral.WithClientTransport(recorder))
+
+		res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", msgs))
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello world!", res.AssistantMessage().Content().String())
+
+		stream, err := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-small-latest", msgs))
+		assert.NoError(t, err)
+		for range stream {
+		}
+		server.Close()
+		assert.Equal(t, 2, calls)
+
+		// When
+		player, err := mistral.NewCassetteTransport(path)
+		assert.NoError(t, err)
+		c = mistral.New("anotherApiKey",
+			mistral.WithBaseApiUrl(server.URL),
+			mistral.WithClientTransport(player))
+
+		replayed, errReplay := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", msgs))
+		replayedStream, errStream := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-small-latest", msgs))
+
+		// Then
+		assert.NoError(t, errReplay)
+		assert.Equal(t, "Hello world!", replayed.AssistantMessage().Content().String())
+		assert.Equal(t, 5, replayed.Usage.TotalTokens)
+
+		assert.NoError(t, errStream)
+		var chunks []*mistral.CompletionChunk
+		for chunk := range replayedStream {
+			chunks = append(chunks, chunk)
+		}
+		assert.Len(t, chunks, 2)
+		assert.Equal(t, "world!", chunks[1].Choices[0].Delta.Content().String())
+		assert.Equal(t, 5, chunks[1].Usage.TotalTokens)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should redact sensitive headers", func(t *testing.T) {
+		// Given
+		calls := 0
+		server := newCassetteServer(t, &calls)
+		defer server.Close()
+		path := filepath.Join(t.TempDir(), "chat.json")
+
+		recorder, _ := mistral.NewCassetteTransport(path, mistral.WithCassetteRedactedHeaders("Content-Type"))
+		c := mistral.New("secretApiKey",
+			mistral.WithBaseApiUrl(server.URL),
+			mistral.WithClientTransport(recorder))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", msgs))
+
+		// Then
+		assert.NoError(t, err)
+		content, _ := os.ReadFile(path)
+		assert.NotContains(t, string(content), "secretApiKey")
+		assert.NotContains(t, string(content), "session=secret")
+
+		interaction := recorder.Cassette().Interactions[0]
+		assert.Equal(t, "REDACTED", interaction.Request.Headers.Get("Authorization"))
+		assert.Equal(t, "REDACTED", interaction.Request.Headers.Get("Content-Type"))
+		assert.Equal(t, "REDACTED", interaction.Response.Headers.Get("Set-Cookie"))
+	})
+
+	t.Run("should match requests on their normalized body", func(t *testing.T) {
+		// Given
+		path := filepath.Join(t.TempDir(), "chat.json")
+		cassette := `{"interactions": [
+			{
+				"request": {"method": "POST", "path": "/v1/chat/completions", "body": "{\"messages\": [{\"content\": \"Hello!\", \"role\": \"user\"}], \"model\": \"mistral-small-latest\", \"parallel_tool_calls\": true}"},
+				"response": {"status_code": 200, "headers": {"Content-Type": ["application/json"]}, "body": ` + fmt.Sprintf("%q", cassetteChatResponse) + `}
+			}
+		]}`
+		assert.NoError(t, os.WriteFile(path, []byte(cassette), 0644))
+
+		player, err := mistral.NewCassetteTransport(path, mistral.WithCassetteMode(mistral.CassetteReplay))
+		assert.NoError(t, err)
+		c := mistral.New("fakeApiKey", mistral.WithClientTransport(player))
+
+		// When
+		res, errMatch := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", msgs))
+		_, errNoMatch := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large-latest", msgs))
+
+		// Then
+		assert.NoError(t, errMatch)
+		assert.Equal(t, "Hello world!", res.AssistantMessage().Content().String())
+		assert.ErrorIs(t, errNoMatch, mistral.ErrCassetteNoMatch)
+	})
+
+	t.Run("should match requests on their query", func(t *testing.T) {
+		// Given
+		path := filepath.Join(t.TempDir(), "models.json")
+		cassette := `{"interactions": [
+			{
+				"request": {"method": "GET", "path": "/v1/models", "query": "page=1&size=10"},
+				"response": {"status_code": 200, "body": "first page"}
+			},
+			{
+				"request": {"method": "GET", "path": "/v1/models", "query": "page=2&size=10"},
+				"response": {"status_code": 200, "body": "second page"}
+			}
+		]}`
+		assert.NoError(t, os.WriteFile(path, []byte(cassette), 0644))
+		player, err := mistral.NewCassetteTransport(path, mistral.WithCassetteMode(mistral.CassetteReplay))
+		assert.NoError(t, err)
+
+		roundTrip := func(url string) (string, error) {
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			resp, err := player.RoundTrip(req)
+			if err != nil {
+				return "", err
+			}
+			body, _ := io.ReadAll(resp.Body)
+			return string(body), nil
+		}
+
+		// When
+		second, errSecond := roundTrip("https://api.mistral.ai/v1/models?size=10&page=2")
+		first, errFirst := roundTrip("https://api.mistral.ai/v1/models?page=1&size=10")
+		_, errNoMatch := roundTrip("https://api.mistral.ai/v1/models")
+
+		// Then
+		assert.NoError(t, errSecond)
+		assert.Equal(t, "second page", second)
+		assert.NoError(t, errFirst)
+		assert.Equal(t, "first page", first)
+		assert.ErrorIs(t, errNoMatch, mistral.ErrCassetteNoMatch)
+	})
+
+	t.Run("should not record a stream closed before its end", func(t *testing.T) {
+		// Given
+		calls := 0
+		server := newCassetteServer(t, &calls)
+		defer server.Close()
+		path := filepath.Join(t.TempDir(), "stream.json")
+		recorder, err := mistral.NewCassetteTransport(path)
+		assert.NoError(t, err)
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions",
+			strings.NewReader(`{"model":"mistral-small-latest","stream":true}`))
+		resp, err := recorder.RoundTrip(req)
+		assert.NoError(t, err)
+
+		// When
+		_, err = resp.Body.Read(make([]byte, 10))
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+
+		// Then
+		assert.Empty(t, recorder.Cassette().Interactions)
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("should fail to replay a missing cassette", func(t *testing.T) {
+		_, err := mistral.NewCassetteTransport(filepath.Join(t.TempDir(), "missing.json"),
+			mistral.WithCassetteMode(mistral.CassetteReplay))
+
+		assert.Error(t, err)
+	})
+}
@@ -1,14 +1,11 @@
 package mistral
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -91,6 +88,10 @@ type ChatCompletionRequest struct {
 	Messages []ChatMessage `json:"messages"`
 
 	Tools []Tool `json:"tools,omitempty"`
+
+	// FallbackModels are the models to try, in order, when Model is unavailable. They are only used by the
+	// client decorator created with NewFallback, and are not sent to the API.
+	FallbackModels []string `json:"-"`
 }
 
 var _ json.Unmarshaler = (*ChatCompletionRequest)(nil)
@@ -148,7 +149,8 @@ type ChatCompletionResponse struct {
 	Object  string                 `json:"object"`
 	Usage   *UsageInfo             `json:"usage,omitempty"`
 
-	Latency time.Duration `json:"-"`
+	Latency  time.Duration    `json:"-"`
+	Metadata ResponseMetadata `json:"-"`
 }
 
 var _ json.Unmarshaler = (*ChatCompletionResponse)(nil)
@@ -274,6 +276,13 @@ func WithToolChoice(toolChoice ToolChoiceType) ChatCompletionRequestOption {
 	}
 }
 
+// WithFallbackModels sets the models to try, in order, when the model of the request is unavailable (see NewFallback).
+func WithFallbackModels(models ...string) ChatCompletionRequestOption {
+	return func(req *ChatCompletionRequest) {
+		req.FallbackModels = models
+	}
+}
+
 // WithStreaming enables streaming back partial progress.
 func WithStreaming() ChatCompletionRequestOption {
 	return func(req *ChatCompletionRequest) {
@@ -288,24 +297,27 @@ func (c *clientImpl) ChatCompletion(
 	ctx context.Context,
 	req *ChatCompletionRequest,
 ) (*ChatCompletionResponse, error) {
-	if c.limiter != nil {
-		if err := c.limiter.Wait(ctx); err != nil {
-			return nil, err
-		}
-	}
-
-	url := fmt.Sprintf("%s/v1/chat/completions", c.baseURL)
-
 	if req.Stream {
 		return nil, fmt.Errorf("the method ChatCompletion does not support streaming")
 	}
 
-	jsonValue, err := json.Marshal(req)
+	url, err := c.endpointURL(EndpointChatCompletions, req.Model, false)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonValue, err := c.encodeBody(EndpointChatCompletions, req.Model, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	response, lat, err := c.sendRequest(ctx, http.MethodPost, url, jsonValue)
+	call, err := c.acquire(ctx, EndpointChatCompletions, req.Model, estimateChatTokens(req))
+	if err != nil {
+		return nil, err
+	}
+
+	response, lat, meta, err := c.sendHedged(ctx, EndpointChatCompletions, req.Model, http.MethodPost, url, jsonValue)
+	call.finish(err)
 	if err != nil {
 		return nil, err
 	}
@@ -315,11 +327,18 @@ func (c *clientImpl) ChatCompletion(
 		logger.Printf("POST /v1/chat/completions called")
 	}
 
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
 	var resp ChatCompletionResponse
-	if err := unmarshallBody(response, &resp); err != nil {
+	if err := c.decodeBody(EndpointChatCompletions, body, &resp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
 	}
 	resp.Latency = lat
+	resp.Metadata = meta
+	call.reconcileUsage(resp.Usage)
+	call.observeQuota(response.Header)
 
 	return &resp, nil
 }
@@ -338,10 +357,11 @@ type CompletionChunk struct {
 	Object  string                           `json:"object"`
 	Usage   *UsageInfo                       `json:"usage,omitempty"`
 
-	IsLastChunk  bool          `json:"-"`
-	ChunkLatency time.Duration `json:"-"`
-	TotalLatency time.Duration `json:"-"`
-	Error        error         `json:"-"`
+	IsLastChunk  bool             `json:"-"`
+	ChunkLatency time.Duration    `json:"-"`
+	TotalLatency time.Duration    `json:"-"`
+	Error        error            `json:"-"`
+	Metadata     ResponseMetadata `json:"-"`
 }
 
 var _ json.Unmarshaler = (*CompletionChunk)(nil)
@@ -382,66 +402,74 @@ func (c *CompletionChunk) DeltaMessage() AssistantMessage {
 }
 
 func (c *clientImpl) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (<-chan *CompletionChunk, error) {
-	if c.limiter != nil {
-		if err := c.limiter.Wait(ctx); err != nil {
-			return nil, err
-		}
-	}
-
-	url := fmt.Sprintf("%s/v1/chat/completions", c.baseURL)
 	if !req.Stream {
 		return nil, fmt.Errorf("the method ChatCompletionStream requires streaming")
 	}
 
-	jsonValue, err := json.Marshal(req)
+	url, err := c.endpointURL(EndpointChatCompletions, req.Model, true)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonValue, err := c.encodeBody(EndpointChatCompletions, req.Model, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
+	call, err := c.acquire(ctx, EndpointChatCompletions, req.Model, estimateChatTokens(req))
+	if err != nil {
+		return nil, err
+	}
+
 	outChan := make(chan *CompletionChunk)
 
-	res, lat, err := c.sendRequest(ctx, http.MethodPost, url, jsonValue)
+	res, lat, meta, err := c.sendRequest(ctx, http.MethodPost, url, jsonValue)
+	call.finish(err)
 	if err != nil {
 		return nil, err
 	}
+	call.observeQuota(res.Header)
 
 	go func() {
 		defer close(outChan)
 		defer res.Body.Close() //nolint:errcheck
 
-		buff := bufio.NewReader(res.Body)
+		stream := c.deployment.newStreamReader(res.Body)
 
 		var t0 time.Time
 		var i uint
 		totLat := lat
 		for {
 			t0 = time.Now()
-			line, err := buff.ReadBytes('\n')
+			payload, err := stream.next()
 			lat += time.Since(t0)
 			if err != nil {
 				if err == io.EOF {
 					return
 				}
-				outChan <- &CompletionChunk{Error: fmt.Errorf("failed to read response line: %w", err)}
+				outChan <- &CompletionChunk{Error: err, Metadata: meta}
 				return
 			}
 
-			if !bytes.HasPrefix(line, []byte("data: ")) {
-				continue
-			}
-
-			jsonPart := strings.TrimSpace(
-				strings.TrimPrefix(string(line), "data: "))
-
-			if jsonPart == "[DONE]" {
-				return
+			if c.deployment.decodeChunk != nil {
+				if payload, err = c.deployment.decodeChunk(payload); err != nil {
+					outChan <- &CompletionChunk{
+						Error:    fmt.Errorf("failed to decode response chunk %d: %w", i, err),
+						Metadata: meta,
+					}
+					return
+				}
 			}
 			var chunk CompletionChunk
-			if err := json.Unmarshal([]byte(jsonPart), &chunk); err != nil {
+			if err := json.Unmarshal(payload, &chunk); err != nil {
 				outChan <- &CompletionChunk{
-					Error: fmt.Errorf("failed to unmarshal response chunk %d '%s': %w", i, jsonPart, err)}
+					Error:    fmt.Errorf("failed to unmarshal response chunk %d '%s': %w", i, payload, err),
+					Metadata: meta,
+				}
 				return
 			}
+			call.reconcileUsage(chunk.Usage)
+			chunk.Metadata = meta
 			chunk.ChunkLatency = lat
 			totLat += lat
 			lat = 0
@@ -0,0 +1,266 @@
+package mistral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCircuitFailureThreshold = 5
+	DefaultCircuitCooldown         = 30 * time.Second
+	DefaultCircuitHalfOpenProbes   = 1
+)
+
+// ErrCircuitOpen matches the errors of the calls rejected because their circuit is open (see CircuitOpenError).
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a circuit of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the calls through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects all the calls until the end of the cooldown.
+	CircuitOpen
+
+	// CircuitHalfOpen lets probe calls through, one at a time, to check whether the API has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitOpenError is returned, without calling the API, when the circuit of the endpoint and model is open.
+// It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	Endpoint Endpoint
+	Model    string
+
+	// RetryIn is the time left before the circuit lets a probe call through.
+	RetryIn time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	target := string(e.Endpoint)
+	if e.Model != "" {
+		target += " " + e.Model
+	}
+	return fmt.Sprintf("circuit open for %s, retry in %v", target, e.RetryIn.Round(time.Millisecond))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Retryable returns true: the call may succeed once the circuit is closed again.
+func (e *CircuitOpenError) Retryable() bool {
+	return true
+}
+
+// CircuitStateChangeFunc is called when a circuit changes state.
+type CircuitStateChangeFunc func(endpoint Endpoint, model string, from, to CircuitState)
+
+// CircuitBreaker makes the calls fail fast while the API is failing.
+//
+// Each endpoint and model has its own circuit. A circuit opens after a number of consecutive failures,
+// and rejects the calls with a CircuitOpenError during the cooldown. Then it becomes half-open: probe calls
+// are let through one at a time, and the circuit closes after enough successful probes, or opens again
+// on the first failure.
+//
+// By default, the retryable errors (rate limits, server errors, network errors, see IsRetryable) are failures,
+// except the cancellations and deadlines of the caller's context. Other errors, such as bad requests,
+// show that the API is up and count as successes.
+//
+// A CircuitBreaker is safe for concurrent use and can be shared between clients.
+type CircuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	halfOpenProbes   int
+	isFailure        func(err error) bool
+	onStateChange    []CircuitStateChangeFunc
+
+	mu       sync.Mutex
+	circuits map[circuitKey]*circuit
+}
+
+type circuitKey struct {
+	endpoint Endpoint
+	model    string
+}
+
+type circuit struct {
+	state           CircuitState
+	failures        int
+	successes       int
+	openedAt        time.Time
+	probeInProgress bool
+}
+
+type CircuitBreakerOption func(cb *CircuitBreaker)
+
+// WithCircuitFailureThreshold sets the number of consecutive failures which opens a circuit
+// (DefaultCircuitFailureThreshold by default).
+func WithCircuitFailureThreshold(n int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.failureThreshold = max(n, 1)
+	}
+}
+
+// WithCircuitCooldown sets how long a circuit stays open before letting a probe call through
+// (DefaultCircuitCooldown by default).
+func WithCircuitCooldown(cooldown time.Duration) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.cooldown = cooldown
+	}
+}
+
+// WithCircuitHalfOpenProbes sets the number of successful probe calls which closes a half-open circuit
+// (DefaultCircuitHalfOpenProbes by default).
+func WithCircuitHalfOpenProbes(n int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.halfOpenProbes = max(n, 1)
+	}
+}
+
+// WithCircuitFailurePredicate replaces the function telling which errors are failures.
+func WithCircuitFailurePredicate(isFailure func(err error) bool) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.isFailure = isFailure
+	}
+}
+
+// WithCircuitStateChange adds a function called, synchronously, each time a circuit changes state.
+func WithCircuitStateChange(fn CircuitStateChangeFunc) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.onStateChange = append(cb.onStateChange, fn)
+	}
+}
+
+// NewCircuitBreaker creates a circuit breaker. Available options are:
+//   - WithCircuitFailureThreshold
+//   - WithCircuitCooldown
+//   - WithCircuitHalfOpenProbes
+//   - WithCircuitFailurePredicate
+//   - WithCircuitStateChange
+func NewCircuitBreaker(opts ...CircuitBreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		failureThreshold: DefaultCircuitFailureThreshold,
+		cooldown:         DefaultCircuitCooldown,
+		halfOpenProbes:   DefaultCircuitHalfOpenProbes,
+		isFailure:        IsRetryable,
+		circuits:         make(map[circuitKey]*circuit),
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	return cb
+}
+
+// Allow tells whether a call to the endpoint and model can be made. If not, it returns a CircuitOpenError.
+// Otherwise, the returned function must be called once with the outcome of the call.
+func (cb *CircuitBreaker) Allow(endpoint Endpoint, model string) (func(err error), error) {
+	key := circuitKey{endpoint: endpoint, model: model}
+	now := time.Now()
+
+	cb.mu.Lock()
+	c := cb.circuit(key)
+	from := c.state
+	probe := false
+	switch c.state {
+	case CircuitOpen:
+		if retryIn := cb.cooldown - now.Sub(c.openedAt); retryIn > 0 {
+			cb.mu.Unlock()
+			return nil, &CircuitOpenError{Endpoint: endpoint, Model: model, RetryIn: retryIn}
+		}
+		c.state, c.successes = CircuitHalfOpen, 0
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probeInProgress {
+			cb.mu.Unlock()
+			return nil, &CircuitOpenError{Endpoint: endpoint, Model: model}
+		}
+		c.probeInProgress, probe = true, true
+	}
+	to := c.state
+	cb.mu.Unlock()
+	cb.notify(key, from, to)
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { cb.record(key, probe, err) })
+	}, nil
+}
+
+// State returns the current state of the circuit of the endpoint and model.
+func (cb *CircuitBreaker) State(endpoint Endpoint, model string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(circuitKey{endpoint: endpoint, model: model})
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= cb.cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// circuit returns the circuit of the key, creating it if needed. It must be called with cb.mu held.
+func (cb *CircuitBreaker) circuit(key circuitKey) *circuit {
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		cb.circuits[key] = c
+	}
+	return c
+}
+
+func (cb *CircuitBreaker) record(key circuitKey, probe bool, err error) {
+	cb.mu.Lock()
+	c := cb.circuit(key)
+	from := c.state
+	if probe {
+		c.probeInProgress = false
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up: this tells nothing about the API
+	case err != nil && cb.isFailure(err):
+		c.failures++
+		if c.state == CircuitHalfOpen || (c.state == CircuitClosed && c.failures >= cb.failureThreshold) {
+			c.state, c.openedAt = CircuitOpen, time.Now()
+		}
+	default:
+		c.failures = 0
+		if c.state == CircuitHalfOpen && probe {
+			c.successes++
+			if c.successes >= cb.halfOpenProbes {
+				c.state = CircuitClosed
+			}
+		}
+	}
+	to := c.state
+	cb.mu.Unlock()
+	cb.notify(key, from, to)
+}
+
+func (cb *CircuitBreaker) notify(key circuitKey, from, to CircuitState) {
+	if from == to {
+		return
+	}
+	for _, fn := range cb.onStateChange {
+		fn(key.endpoint, key.model, from, to)
+	}
+}
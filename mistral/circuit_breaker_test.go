@@ -0,0 +1,164 @@
+package mistral_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+func TestCircuitBreaker_Allow(t *testing.T) {
+	serverErr := mistral.NewApiError(http.StatusServiceUnavailable, nil)
+
+	// failTimes records n failures on the circuit.
+	failTimes := func(t *testing.T, cb *mistral.CircuitBreaker, model string, n int) {
+		t.Helper()
+		for range n {
+			done, err := cb.Allow(mistral.EndpointChatCompletions, model)
+			assert.NoError(t, err)
+			done(serverErr)
+		}
+	}
+
+	t.Run("should open after consecutive failures", func(t *testing.T) {
+		// Given
+		cb := mistral.NewCircuitBreaker(mistral.WithCircuitFailureThreshold(3), mistral.WithCircuitCooldown(time.Minute))
+
+		// When
+		failTimes(t, cb, "mistral-large", 2)
+		done, _ := cb.Allow(mistral.EndpointChatCompletions, "mistral-large")
+		done(nil) // resets the count
+		failTimes(t, cb, "mistral-large", 3)
+		_, err := cb.Allow(mistral.EndpointChatCompletions, "mistral-large")
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrCircuitOpen)
+		var openErr *mistral.CircuitOpenError
+		assert.ErrorAs(t, err, &openErr)
+		assert.Equal(t, "mistral-large", openErr.Model)
+		assert.Greater(t, openErr.RetryIn, 59*time.Second)
+		assert.True(t, mistral.IsRetryable(err))
+		assert.Equal(t, mistral.CircuitOpen, cb.State(mistral.EndpointChatCompletions, "mistral-large"))
+		assert.Equal(t, mistral.CircuitClosed, cb.State(mistral.EndpointChatCompletions, "mistral-small"))
+	})
+
+	t.Run("should close after a successful probe", func(t *testing.T) {
+		// Given
+		var transitions []string
+		cb := mistral.NewCircuitBreaker(
+			mistral.WithCircuitFailureThreshold(1),
+			mistral.WithCircuitCooldown(20*time.Millisecond),
+			mistral.WithCircuitStateChange(func(endpoint mistral.Endpoint, model string, from, to mistral.CircuitState) {
+				transitions = append(transitions, fmt.Sprintf("%s->%s", from, to))
+			}),
+		)
+		failTimes(t, cb, "mistral-large", 1)
+		time.Sleep(30 * time.Millisecond)
+
+		// When
+		probeDone, err := cb.Allow(mistral.EndpointChatCompletions, "mistral-large")
+		assert.NoError(t, err)
+		_, concurrentErr := cb.Allow(mistral.EndpointChatCompletions, "mistral-large")
+		probeDone(nil)
+
+		// Then
+		assert.ErrorIs(t, concurrentErr, mistral.ErrCircuitOpen)
+		assert.Equal(t, mistral.CircuitClosed, cb.State(mistral.EndpointChatCompletions, "mistral-large"))
+		assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, transitions)
+	})
+
+	t.Run("should open again when the probe fails", func(t *testing.T) {
+		// Given
+		cb := mistral.NewCircuitBreaker(mistral.WithCircuitFailureThreshold(1), mistral.WithCircuitCooldown(20*time.Millisecond))
+		failTimes(t, cb, "mistral-large", 1)
+		time.Sleep(30 * time.Millisecond)
+
+		// When
+		failTimes(t, cb, "mistral-large", 1)
+		_, err := cb.Allow(mistral.EndpointChatCompletions, "mistral-large")
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrCircuitOpen)
+	})
+
+	t.Run("should not count the errors of the caller nor the bad requests", func(t *testing.T) {
+		// Given
+		cb := mistral.NewCircuitBreaker(mistral.WithCircuitFailureThreshold(1))
+
+		// When
+		for _, err := range []error{
+			context.Canceled,
+			fmt.Errorf("failed to make HTTP request: %w", context.DeadlineExceeded),
+			mistral.NewApiError(http.StatusBadRequest, nil),
+			errors.New("boom"),
+		} {
+			done, allowErr := cb.Allow(mistral.EndpointChatCompletions, "mistral-large")
+			assert.NoError(t, allowErr)
+			done(err)
+		}
+
+		// Then
+		assert.Equal(t, mistral.CircuitClosed, cb.State(mistral.EndpointChatCompletions, "mistral-large"))
+	})
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var calls int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`))
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var states []mistral.CircuitState
+	cb := mistral.NewCircuitBreaker(
+		mistral.WithCircuitFailureThreshold(2),
+		mistral.WithCircuitCooldown(50*time.Millisecond),
+		mistral.WithCircuitStateChange(func(_ mistral.Endpoint, _ string, _, to mistral.CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, to)
+		}),
+	)
+	c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL),
+		mistral.WithRetry(1, time.Millisecond, time.Millisecond), mistral.WithCircuitBreaker(cb))
+	req := mistral.NewChatCompletionRequest("mistral-large", []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")})
+
+	// When the API is down
+	for range 2 {
+		_, err := c.ChatCompletion(ctx, req)
+		assert.ErrorIs(t, err, mistral.ErrRetriesExhausted)
+	}
+	_, err := c.ChatCompletion(ctx, req)
+
+	// Then the calls fail fast
+	assert.ErrorIs(t, err, mistral.ErrCircuitOpen)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// When the API recovers
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	res, err := c.ChatCompletion(ctx, req)
+
+	// Then the circuit is closed again
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", res.AssistantMessage().Content().String())
+	assert.Equal(t, []mistral.CircuitState{mistral.CircuitOpen, mistral.CircuitHalfOpen, mistral.CircuitClosed}, states)
+}
@@ -3,7 +3,6 @@ package mistral
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -44,12 +43,17 @@ type Client interface {
 }
 
 type clientImpl struct {
-	apiKey  string
-	baseURL string
-
-	limiter    *rate.Limiter
-	httpClient *http.Client
-	verbose    bool
+	credentials CredentialProvider
+	deployment  *Deployment
+	baseURL     string
+
+	limiter          *rate.Limiter
+	limiterBaseLimit rate.Limit
+	tokenLimiter     *TokenLimiter
+	circuitBreaker   *CircuitBreaker
+	hedger           *hedger
+	httpClient       *http.Client
+	verbose          bool
 
 	retryMaxRetries  int
 	retryWaitMin     time.Duration
@@ -64,15 +68,26 @@ type Option func(impl *clientImpl)
 // New create a new Client instance. Available options are:
 //   - WithClientTimeout
 //   - WithBaseApiUrl
+//   - WithDeployment
+//   - WithApiKeyPool
+//   - WithCredentialProvider
 //   - WithRateLimiter
+//   - WithTokenLimiter
+//   - WithCircuitBreaker
+//   - WithHedgedRequests
 //   - WithVerbose
 //   - WithRetry
 //   - WithRetryStatusCodes
 //   - WithClientTransport
+//   - WithLocalCache
+//   - WithCacheDir
+//   - WithCacheOptions
+//   - WithCacheCompression
+//   - WithCacheEncryption
+//   - WithCacheEncryptionFromEnv
 func New(apiKey string, opts ...Option) Client {
 	c := &clientImpl{
-		apiKey:  apiKey,
-		baseURL: BaseApiUrl,
+		deployment: MistralDeployment(),
 		httpClient: &http.Client{
 			Timeout: defaultTimeout,
 		},
@@ -99,21 +114,42 @@ func New(apiKey string, opts ...Option) Client {
 		opt(c)
 	}
 
+	if c.baseURL == "" {
+		c.baseURL = c.deployment.baseURL
+	}
+	if c.credentials == nil {
+		c.credentials = NewStaticCredentials(apiKey)
+	}
+
 	if c.cacheConfig.enabled {
-		engine, err := cache.NewLocalFsEngine(c.cacheConfig.cacheDir) // TODO: implement other kind of engines later (s3, db...)
+		engine, err := cache.NewLocalFsEngine(c.cacheConfig.cacheDir, c.cacheConfig.localOptions...) // TODO: implement other kind of engines later (s3, db...)
 		if err != nil {
 			logger.Fatalf("Failed to initialize local cache engine: %v", err)
 		}
 
-		return NewCached(c, engine)
+		var cacheEngine CacheEngine = engine
+		switch {
+		case len(c.cacheConfig.encryptionKeys) > 0:
+			cacheEngine, err = NewEncryptedCacheEngine(engine, c.cacheConfig.encryptionKeys[0], c.cacheConfig.encryptionKeys[1:]...)
+		case c.cacheConfig.encryptionEnv != "":
+			cacheEngine, err = NewEncryptedCacheEngineFromEnv(engine, c.cacheConfig.encryptionEnv)
+		}
+		if err != nil {
+			logger.Fatalf("Failed to initialize cache encryption: %v", err)
+		}
+
+		return NewCached(c, cacheEngine, c.cacheConfig.options...)
 	}
 
 	return c
 }
 
-// NewCached decorates a client instance to cache responses with the given cache engine.
-func NewCached(client Client, cacheEngine CacheEngine) Client {
-	cc, err := newCachedClient(client, cacheEngine)
+// NewCached decorates a client instance to cache responses with the given cache engine. Available options are:
+//   - WithModelsCacheTTL
+//   - WithModelsBackgroundRefresh
+//   - WithStreamReplaySpeed
+func NewCached(client Client, cacheEngine CacheEngine, opts ...CacheOption) Client {
+	cc, err := newCachedClient(client, cacheEngine, opts...)
 	if err != nil {
 		logger.Fatalf("Failed to initialize local cache: %v", err)
 	}
@@ -132,9 +168,64 @@ func WithBaseApiUrl(baseURL string) Option {
 	}
 }
 
+// WithDeployment sets where the models are served: the Mistral API (the default), a self-hosted vLLM server,
+// Azure AI, Vertex AI or Bedrock. The base URL of the deployment can still be overridden with WithBaseApiUrl.
+func WithDeployment(deployment *Deployment) Option {
+	return func(c *clientImpl) {
+		c.deployment = deployment
+	}
+}
+
+// WithApiKeyPool spreads the requests over the keys of the pool, instead of using the key given to New.
+// A key rejected with a 401 or 429 status code is sidelined, and the request is retried at once with another key.
+func WithApiKeyPool(pool *KeyPool) Option {
+	return WithCredentialProvider(pool)
+}
+
+// WithCredentialProvider authenticates the requests with the credentials of the provider, instead of
+// the key given to New. The provider is called on each attempt, and the request is retried once with
+// a refreshed credential when the API answers with a 401 status code.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(c *clientImpl) {
+		c.credentials = provider
+	}
+}
+
+// WithRateLimiter limits the rate of the requests.
+// The limiter is slowed down when the rate-limit headers of the responses report a quota running out,
+// and gets back to its initial limit when the quota is restored.
 func WithRateLimiter(rateLimiter *rate.Limiter) Option {
 	return func(c *clientImpl) {
 		c.limiter = rateLimiter
+		if rateLimiter != nil {
+			c.limiterBaseLimit = rateLimiter.Limit()
+		}
+	}
+}
+
+// WithTokenLimiter limits the number of tokens consumed per minute, per model and per endpoint (see TokenLimiter).
+func WithTokenLimiter(tokenLimiter *TokenLimiter) Option {
+	return func(c *clientImpl) {
+		c.tokenLimiter = tokenLimiter
+	}
+}
+
+// WithCircuitBreaker makes the calls fail fast with a CircuitOpenError while the API is failing (see CircuitBreaker).
+func WithCircuitBreaker(circuitBreaker *CircuitBreaker) Option {
+	return func(c *clientImpl) {
+		c.circuitBreaker = circuitBreaker
+	}
+}
+
+// WithHedgedRequests sends a second identical ChatCompletion or Embeddings request when the first one hasn't
+// answered within the given percentile (0.95 for p95) of the latencies observed for the same endpoint and model,
+// or within initialDelay until enough latencies are observed. The first answer wins and the other request is canceled.
+//
+// The hedge request goes through the same admission as the first one: it doesn't consume the limiters twice,
+// and the cache decorator only sees one response.
+func WithHedgedRequests(percentile float64, initialDelay time.Duration) Option {
+	return func(c *clientImpl) {
+		c.hedger = newHedger(percentile, initialDelay)
 	}
 }
 
@@ -147,6 +238,8 @@ func WithVerbose(verbose bool) Option {
 // WithRetry configures automatic retries for HTTP requests.
 // maxRetries is the number of retries after the first attempt.
 // waitMin and waitMax control the exponential backoff bounds (set to 0 for default).
+// When the server tells how long to wait, with the Retry-After header or the rate-limit reset of an exhausted quota,
+// this delay is used instead of the backoff, capped by waitMax.
 // Accepted ranges:
 //
 //	0 < waitMin <= waitMax
@@ -183,6 +276,7 @@ func WithRetryStatusCodes(codes ...int) Option {
 }
 
 // WithClientTransport overrides the underlying HTTP client transport.
+// See NewCassetteTransport to record and replay the API interactions in tests.
 func WithClientTransport(t http.RoundTripper) Option {
 	return func(c *clientImpl) {
 		c.httpClient.Transport = t
@@ -205,6 +299,39 @@ func WithCacheDir(dir string) Option {
 	}
 }
 
+// WithCacheCompression compresses the entries of the local cache enabled with WithLocalCache or WithCacheDir.
+func WithCacheCompression(c CacheCompression) Option {
+	return func(impl *clientImpl) {
+		impl.cacheConfig.localOptions = append(impl.cacheConfig.localOptions, WithLocalCacheCompression(c))
+	}
+}
+
+// WithCacheEncryption encrypts the entries of the local cache with AES-GCM.
+// The previous keys are only used to read the entries written before a key rotation (see EncryptedCacheEngine).
+func WithCacheEncryption(key []byte, previousKeys ...[]byte) Option {
+	return func(c *clientImpl) {
+		c.cacheConfig.encryptionKeys = append([][]byte{key}, previousKeys...)
+	}
+}
+
+// WithCacheEncryptionFromEnv encrypts the entries of the local cache with the keys read from the given
+// environment variable, or DefaultCacheKeyEnv if empty: a comma separated list of base64 encoded keys, the active one first.
+func WithCacheEncryptionFromEnv(envVar string) Option {
+	return func(c *clientImpl) {
+		if envVar == "" {
+			envVar = DefaultCacheKeyEnv
+		}
+		c.cacheConfig.encryptionEnv = envVar
+	}
+}
+
+// WithCacheOptions configures the cache enabled with WithLocalCache or WithCacheDir.
+func WithCacheOptions(opts ...CacheOption) Option {
+	return func(c *clientImpl) {
+		c.cacheConfig.options = append(c.cacheConfig.options, opts...)
+	}
+}
+
 // isRetryableErr returns true if the error is retryable.
 //
 // Retriable errors:
@@ -252,78 +379,198 @@ func (c *clientImpl) nextBackoff(attempt int) time.Duration {
 	return jitter
 }
 
-func unmarshallBody(resp *http.Response, v interface{}) error {
-	err := json.NewDecoder(resp.Body).Decode(v)
-	return err
+// pendingCall is a call admitted by the circuit breaker and the limiters, waiting for its outcome.
+type pendingCall struct {
+	done        func(err error)
+	reservation *TokenReservation
 }
 
-func (c *clientImpl) sendRequest(ctx context.Context, method, url string, body []byte) (*http.Response, time.Duration, error) {
-	// attempt = 0 is the first try; we perform up to (1 + retryMaxRetries) attempts total.
-	for attempt := 0; attempt <= c.retryMaxRetries; attempt++ {
+// acquire admits a call to the endpoint: it checks the circuit breaker configured with WithCircuitBreaker,
+// waits for the limiter configured with WithRateLimiter, then reserves the estimated tokens
+// on the token limiter configured with WithTokenLimiter.
+func (c *clientImpl) acquire(ctx context.Context, endpoint Endpoint, model string, tokens int) (*pendingCall, error) {
+	call := &pendingCall{done: func(error) {}}
+	if c.circuitBreaker != nil {
+		done, err := c.circuitBreaker.Allow(endpoint, model)
+		if err != nil {
+			if c.verbose {
+				logger.Printf("Circuit breaker: %v", err)
+			}
+			return nil, err
+		}
+		call.done = done
+	}
+
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			call.done(err)
+			return nil, err
+		}
+	}
+
+	if c.tokenLimiter != nil {
+		reservation, err := c.tokenLimiter.Reserve(ctx, endpoint, model, tokens)
+		if err != nil {
+			call.done(err)
+			return nil, err
+		}
+		if c.verbose && reservation.Delay > 0 {
+			logger.Printf("Token limiter: waited %v to reserve %d tokens for %s on %s",
+				reservation.Delay, reservation.Tokens(), model, endpoint)
+		}
+		call.reservation = reservation
+	}
+
+	return call, nil
+}
+
+// finish records the outcome of the request: the reserved tokens are given back if it failed.
+func (p *pendingCall) finish(err error) {
+	p.done(err)
+	if err != nil {
+		p.reservation.Cancel()
+	}
+}
+
+// reconcileUsage reconciles the reserved tokens with the usage reported by the API, if any.
+func (p *pendingCall) reconcileUsage(usage *UsageInfo) {
+	p.reservation.reconcileUsage(usage)
+}
+
+// observeQuota lowers the token budgets of the call to the quota by size reported in the response headers, if any.
+func (p *pendingCall) observeQuota(h http.Header) {
+	if state, ok := ParseRateLimitHeaders(h); ok && state.BySize {
+		p.reservation.observeQuota(state)
+	}
+}
+
+// recordKeyUsage records the outcome of a request sent with a key of the pool, if any, and ends the request
+// unless it succeeded. It returns true if the key was sidelined and the request can be retried with another key.
+func (c *clientImpl) recordKeyUsage(key *pooledKey, resp *http.Response) bool {
+	if key == nil {
+		return false
+	}
+	cooldown := key.pool.record(key, resp)
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		key.pool.release(key)
+	}
+	if cooldown == 0 {
+		return false
+	}
+	if c.verbose {
+		logger.Printf("API key %s sidelined for %v after HTTP status %s", key.usage.Key, cooldown, resp.Status)
+	}
+	return key.pool.Available() > 0
+}
+
+// sendRequest sends the request, retrying it as configured, and returns the successful response
+// with its latency and metadata.
+func (c *clientImpl) sendRequest(ctx context.Context, method, url string, body []byte) (*http.Response, time.Duration, ResponseMetadata, error) {
+	// attempt = 0 is the first try; we perform up to (1 + retryMaxRetries) attempts total,
+	// plus one if the credential is refreshed.
+	retries, refreshed := c.retryMaxRetries, false
+	for attempt := 0; attempt <= retries; attempt++ {
 		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to create HTTP request: %w", err)
+			return nil, 0, ResponseMetadata{}, fmt.Errorf("failed to create HTTP request: %w", err)
+		}
+
+		cred, err := c.credentials.Credential(ctx)
+		if err != nil {
+			return nil, 0, ResponseMetadata{}, fmt.Errorf("failed to get credentials: %w", err)
 		}
+		key := cred.key
 
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		header, value := cred.Header, cred.Value
+		if cred.apiKey != "" && c.deployment.apiKeyHeader != "" {
+			header, value = c.deployment.apiKeyHeader, cred.apiKey
+		}
+		req.Header.Set(header, value)
 		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 
 		t0 := time.Now()
 		resp, err := c.httpClient.Do(req)
 		latency := time.Since(t0)
+		rotate := c.recordKeyUsage(key, resp)
 		if err != nil {
-			if attempt < c.retryMaxRetries && isRetryableErr(err) {
+			if attempt < retries && isRetryableErr(err) {
 				wait := c.nextBackoff(attempt)
 				if c.verbose {
 					logger.Printf("HTTP request error, retrying attempt %d/%d after %v: %v",
-						attempt+1, c.retryMaxRetries, wait, err)
+						attempt+1, retries, wait, err)
 				}
 				select {
 				case <-time.After(wait):
 					continue
 				case <-ctx.Done():
-					return nil, 0, ctx.Err()
+					return nil, 0, ResponseMetadata{}, ctx.Err()
 				}
 			}
-			return nil, 0, fmt.Errorf("failed to make HTTP request: %w", err)
+			err = fmt.Errorf("failed to make HTTP request: %w", err)
+			if attempt > 0 && isRetryableErr(err) {
+				err = &RetriesExhaustedError{Attempts: attempt + 1, Err: err}
+			}
+			return nil, 0, ResponseMetadata{}, err
 		}
 
+		c.adjustLimiter(resp.Header)
+
 		if resp.StatusCode != http.StatusOK {
-			if attempt < c.retryMaxRetries {
-				if _, ok := c.retryStatusCodes[resp.StatusCode]; ok {
+			if resp.StatusCode == http.StatusUnauthorized && !refreshed && c.credentials.Refresh(ctx, cred) {
+				if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+					return nil, 0, ResponseMetadata{}, fmt.Errorf("failed to drain response body: %w", err)
+				}
+				resp.Body.Close() //nolint:errcheck
+				if c.verbose {
+					logger.Printf("HTTP status %s, retrying with refreshed credentials", resp.Status)
+				}
+				retries, refreshed = retries+1, true
+				continue
+			}
+
+			if attempt < retries {
+				_, retryable := c.retryStatusCodes[resp.StatusCode]
+				if key != nil && isKeyRejected(resp.StatusCode) {
+					// The key is sidelined: retry only if another one is available
+					retryable = rotate
+				}
+				if retryable {
 					// Drain and close the body before retrying
 					if _, err := io.Copy(io.Discard, resp.Body); err != nil {
-						return nil, 0, fmt.Errorf("failed to drain response body: %w", err)
+						return nil, 0, ResponseMetadata{}, fmt.Errorf("failed to drain response body: %w", err)
+					}
+					resp.Body.Close() //nolint:errcheck
+					var wait time.Duration
+					if !rotate {
+						wait = c.retryWait(attempt, resp)
 					}
-					wait := c.nextBackoff(attempt)
 					if c.verbose {
 						logger.Printf("HTTP status %s, retrying attempt %d/%d after %v",
-							resp.Status, attempt+1, c.retryMaxRetries, wait)
+							resp.Status, attempt+1, retries, wait)
 					}
 					select {
 					case <-time.After(wait):
 						continue
 					case <-ctx.Done():
-						return nil, 0, ctx.Err()
+						return nil, 0, ResponseMetadata{}, ctx.Err()
 					}
 				}
 			}
 
-			if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-				var content map[string]any
-				if err := unmarshallBody(resp, &content); err != nil {
-					return nil, 0, NewApiError(resp.StatusCode, nil)
-				}
-				return nil, 0, NewApiError(resp.StatusCode, content)
+			var err error = newApiErrorFromResponse(resp)
+			resp.Body.Close() //nolint:errcheck
+			if _, ok := c.retryStatusCodes[resp.StatusCode]; ok && attempt > 0 {
+				err = &RetriesExhaustedError{Attempts: attempt + 1, Err: err}
 			}
-
-			errResponseBody, _ := io.ReadAll(resp.Body)
-			return nil, 0, fmt.Errorf("HTTP request failed with status %s and body '%s'",
-				resp.Status, string(errResponseBody))
+			return nil, 0, ResponseMetadata{}, err
 		}
 
-		return resp, latency, nil
+		if key != nil {
+			// The key stays in flight until the body is read
+			resp.Body = &closeHook{ReadCloser: resp.Body, hook: func() { key.pool.release(key) }}
+		}
+		return resp, latency, newResponseMetadata(resp, attempt+1), nil
 	}
 
-	return nil, 0, fmt.Errorf("exhausted retries without a successful response")
+	return nil, 0, ResponseMetadata{}, ErrRetriesExhausted
 }
@@ -0,0 +1,165 @@
+package mistral
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownPrice is returned when the pricing table has no price for the model.
+var ErrUnknownPrice = errors.New("unknown model price")
+
+// ModelPrice is the price of a model: per million tokens, and per minute of audio for the audio models.
+type ModelPrice struct {
+	// Input is the price of a million prompt tokens.
+	Input float64 `json:"input"`
+
+	// Output is the price of a million completion tokens.
+	Output float64 `json:"output,omitempty"`
+
+	// AudioMinute is the price of a minute of audio, for the transcription of an audio file (see AudioCost).
+	// The audio of the chat completions is billed in prompt tokens instead.
+	AudioMinute float64 `json:"audio_minute,omitempty"`
+}
+
+// defaultPrices are the prices of the Mistral API, in euros, by model prefix.
+// They are indicative: check them against https://mistral.ai/pricing and override them if needed.
+var defaultPrices = map[string]ModelPrice{
+	"mistral-large":      {Input: 2, Output: 6},
+	"mistral-medium":     {Input: 0.4, Output: 2},
+	"mistral-small":      {Input: 0.1, Output: 0.3},
+	"mistral-saba":       {Input: 0.2, Output: 0.6},
+	"mistral-tiny":       {Input: 0.25, Output: 0.25},
+	"ministral-3b":       {Input: 0.04, Output: 0.04},
+	"ministral-8b":       {Input: 0.1, Output: 0.1},
+	"open-mistral-7b":    {Input: 0.25, Output: 0.25},
+	"open-mistral-nemo":  {Input: 0.15, Output: 0.15},
+	"open-mixtral-8x7b":  {Input: 0.7, Output: 0.7},
+	"open-mixtral-8x22b": {Input: 2, Output: 6},
+	"codestral":          {Input: 0.3, Output: 0.9},
+	"devstral-small":     {Input: 0.1, Output: 0.3},
+	"devstral-medium":    {Input: 0.4, Output: 2},
+	"magistral-small":    {Input: 0.5, Output: 1.5},
+	"magistral-medium":   {Input: 2, Output: 5},
+	"pixtral-12b":        {Input: 0.15, Output: 0.15},
+	"pixtral-large":      {Input: 2, Output: 6},
+	"voxtral-mini":       {Input: 0.04, Output: 0.04, AudioMinute: 0.001},
+	"voxtral-small":      {Input: 0.1, Output: 0.3, AudioMinute: 0.004},
+	"mistral-embed":      {Input: 0.1},
+	"codestral-embed":    {Input: 0.15},
+	"mistral-moderation": {Input: 0.1},
+}
+
+// PricingTable gives the price of the models, to compute the cost of the responses from their UsageInfo.
+// The price of a model is the one of its ID, or else of the longest prefix of its ID, so that "mistral-large"
+// prices "mistral-large-latest" and "mistral-large-2411".
+//
+// A PricingTable is safe for concurrent use.
+type PricingTable struct {
+	mu     sync.RWMutex
+	prices map[string]ModelPrice
+}
+
+// DefaultPricingTable returns a table with the prices of the Mistral API models, in euros.
+// They are indicative, and can be overridden with Set, Load or LoadFile.
+func DefaultPricingTable() *PricingTable {
+	return NewPricingTable(defaultPrices)
+}
+
+// NewPricingTable returns a table with the given prices only, by model ID or prefix.
+func NewPricingTable(prices map[string]ModelPrice) *PricingTable {
+	return &PricingTable{prices: maps.Clone(prices)}
+}
+
+// Set sets the price of the models whose ID starts with the prefix.
+func (t *PricingTable) Set(modelPrefix string, price ModelPrice) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prices == nil {
+		t.prices = make(map[string]ModelPrice)
+	}
+	t.prices[modelPrefix] = price
+}
+
+// Load sets the prices of a JSON object, keyed by model ID or prefix:
+//
+//	{"mistral-large": {"input": 2, "output": 6}, "voxtral-mini": {"input": 0.04, "output": 0.04, "audio_minute": 0.001}}
+//
+// The prices of the other models are kept.
+func (t *PricingTable) Load(r io.Reader) error {
+	var prices map[string]ModelPrice
+	if err := json.NewDecoder(r).Decode(&prices); err != nil {
+		return fmt.Errorf("failed to decode pricing table: %w", err)
+	}
+	for model, price := range prices {
+		t.Set(model, price)
+	}
+	return nil
+}
+
+// LoadFile sets the prices of the JSON file (see Load).
+func (t *PricingTable) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open pricing file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+	return t.Load(f)
+}
+
+// Price returns the price of the model.
+func (t *PricingTable) Price(model string) (ModelPrice, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if price, ok := t.prices[model]; ok {
+		return price, true
+	}
+	var best string
+	var price ModelPrice
+	found := false
+	for prefix, p := range t.prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, price, found = prefix, p, true
+		}
+	}
+	return price, found
+}
+
+// UsageCost returns the cost of the usage of the model: its prompt and completion tokens.
+// PromptAudioSeconds is not billed, the prompt tokens already counting the audio.
+func (t *PricingTable) UsageCost(model string, usage UsageInfo) (float64, error) {
+	price, ok := t.Price(model)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownPrice, model)
+	}
+	return price.Input*float64(usage.PromptTokens)/1e6 +
+		price.Output*float64(usage.CompletionTokens)/1e6, nil
+}
+
+// ChatCost returns the cost of the chat completion, the audio tokens included. It is 0 when the response reports
+// no usage.
+func (t *PricingTable) ChatCost(res *ChatCompletionResponse) (float64, error) {
+	if res.Usage == nil {
+		return 0, nil
+	}
+	return t.UsageCost(res.Model, *res.Usage)
+}
+
+// EmbeddingCost returns the cost of the embeddings.
+func (t *PricingTable) EmbeddingCost(res *EmbeddingResponse) (float64, error) {
+	return t.UsageCost(res.Model, res.Usage)
+}
+
+// AudioCost returns the cost of the given seconds of audio for the model, such as the transcription of an audio file.
+func (t *PricingTable) AudioCost(model string, seconds float64) (float64, error) {
+	price, ok := t.Price(model)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownPrice, model)
+	}
+	return price.AudioMinute * seconds / 60, nil
+}
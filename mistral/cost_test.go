@@ -0,0 +1,118 @@
+package mistral_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+func TestPricingTable(t *testing.T) {
+	t.Run("should price the models by their longest prefix", func(t *testing.T) {
+		// Given
+		table := mistral.NewPricingTable(map[string]mistral.ModelPrice{
+			"codestral":       {Input: 0.3, Output: 0.9},
+			"codestral-embed": {Input: 0.15},
+		})
+
+		// When
+		code, okCode := table.Price("codestral-2508")
+		embed, okEmbed := table.Price("codestral-embed-2505")
+		_, okUnknown := table.Price("mistral-large-latest")
+
+		// Then
+		assert.True(t, okCode)
+		assert.Equal(t, 0.9, code.Output)
+		assert.True(t, okEmbed)
+		assert.Equal(t, 0.15, embed.Input)
+		assert.False(t, okUnknown)
+	})
+
+	t.Run("should compute the cost of the responses", func(t *testing.T) {
+		// Given
+		table := mistral.NewPricingTable(map[string]mistral.ModelPrice{
+			"mistral-large": {Input: 2, Output: 6},
+			"mistral-embed": {Input: 0.1},
+			"voxtral-small": {Input: 0.1, Output: 0.3, AudioMinute: 0.004},
+		})
+
+		// When
+		chat, errChat := table.ChatCost(&mistral.ChatCompletionResponse{
+			Model: "mistral-large-2411",
+			Usage: &mistral.UsageInfo{PromptTokens: 1_000_000, CompletionTokens: 500_000},
+		})
+		embed, errEmbed := table.EmbeddingCost(&mistral.EmbeddingResponse{
+			Model: "mistral-embed",
+			Usage: mistral.UsageInfo{PromptTokens: 2_000_000},
+		})
+		seconds, errSeconds := table.AudioCost("voxtral-small-latest", 30)
+		_, errUnknown := table.ChatCost(&mistral.ChatCompletionResponse{
+			Model: "unknown",
+			Usage: &mistral.UsageInfo{PromptTokens: 1},
+		})
+
+		// Then
+		assert.NoError(t, errChat)
+		assert.InDelta(t, 5.0, chat, 1e-9)
+		assert.NoError(t, errEmbed)
+		assert.InDelta(t, 0.2, embed, 1e-9)
+		assert.NoError(t, errSeconds)
+		assert.InDelta(t, 0.002, seconds, 1e-9)
+		assert.ErrorIs(t, errUnknown, mistral.ErrUnknownPrice)
+	})
+
+	t.Run("should not bill the audio of a chat completion twice", func(t *testing.T) {
+		// Given
+		table := mistral.NewPricingTable(map[string]mistral.ModelPrice{
+			"voxtral-small": {Input: 0.1, Output: 0.3, AudioMinute: 0.004},
+		})
+		var res mistral.ChatCompletionResponse
+		assert.NoError(t, json.Unmarshal([]byte(`{
+			"id": "2f6e8b1c0a7d4e39b5c1d2e3f4a5b6c7",
+			"object": "chat.completion",
+			"model": "voxtral-small-2507",
+			"created": 1752830016,
+			"choices": [{
+				"index": 0,
+				"message": {"role": "assistant", "content": "The speaker asks for the weather forecast in Paris."},
+				"finish_reason": "stop"
+			}],
+			"usage": {"prompt_audio_seconds": 120, "prompt_tokens": 1542, "total_tokens": 1554, "completion_tokens": 12}
+		}`), &res))
+
+		// When
+		cost, err := table.ChatCost(&res)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 120, res.Usage.PromptAudioSeconds)
+		assert.InDelta(t, 0.1*1542/1e6+0.3*12/1e6, cost, 1e-12)
+	})
+
+	t.Run("should override the prices from a file", func(t *testing.T) {
+		// Given
+		path := filepath.Join(t.TempDir(), "prices.json")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"mistral-large": {"input": 1, "output": 3}}`), 0600))
+		table := mistral.DefaultPricingTable()
+
+		// When
+		err := table.LoadFile(path)
+
+		// Then
+		assert.NoError(t, err)
+		large, _ := table.Price("mistral-large-latest")
+		assert.Equal(t, mistral.ModelPrice{Input: 1, Output: 3}, large)
+		_, ok := table.Price("mistral-small-latest")
+		assert.True(t, ok, "the other prices must be kept")
+	})
+
+	t.Run("should fail with an invalid file", func(t *testing.T) {
+		err := mistral.DefaultPricingTable().Load(strings.NewReader("["))
+
+		assert.ErrorContains(t, err, "failed to decode pricing table")
+	})
+}
@@ -0,0 +1,329 @@
+package mistral
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2ExpiryMargin is how long before its expiry an OAuth2 token is renewed.
+const oauth2ExpiryMargin = 30 * time.Second
+
+// Credential authenticates a request with a header.
+type Credential struct {
+	// Header is the name of the header, such as Authorization or api-key.
+	Header string
+
+	// Value is the value of the header, such as "Bearer <token>".
+	Value string
+
+	// key is the key of the KeyPool which issued the credential, if any.
+	key *pooledKey
+
+	// apiKey is the API key of the credential when no header was chosen for it, so that the client can
+	// send it in the header of its deployment, such as the api-key header of Azure.
+	apiKey string
+}
+
+// BearerCredential returns the credential sending the token in an "Authorization: Bearer" header,
+// as expected by the Mistral API.
+func BearerCredential(token string) Credential {
+	return Credential{Header: "Authorization", Value: "Bearer " + token}
+}
+
+// ApiKeyCredential returns the credential sending the key as is in the given header,
+// such as the api-key header of Azure deployments.
+func ApiKeyCredential(header, key string) Credential {
+	return Credential{Header: header, Value: key}
+}
+
+// CredentialProvider provides the credential of each HTTP request sent by the client, retries included.
+type CredentialProvider interface {
+	// Credential returns the credential to authenticate the next request.
+	Credential(ctx context.Context) (Credential, error)
+
+	// Refresh is called when the API rejected the credential with a 401 status code.
+	// It returns true if the next call to Credential may return a different credential:
+	// the request is then retried once.
+	Refresh(ctx context.Context, rejected Credential) bool
+}
+
+type CredentialOption func(f *credentialFormat)
+
+// credentialFormat turns a secret into a credential.
+type credentialFormat struct {
+	header string
+}
+
+func (f credentialFormat) credential(secret string) Credential {
+	if f.header == "" {
+		cred := BearerCredential(secret)
+		cred.apiKey = secret
+		return cred
+	}
+	return ApiKeyCredential(f.header, secret)
+}
+
+func newCredentialFormat(opts []CredentialOption) credentialFormat {
+	var f credentialFormat
+	for _, opt := range opts {
+		opt(&f)
+	}
+	return f
+}
+
+// WithApiKeyHeader sends the key as is in the given header, such as api-key, instead of an "Authorization: Bearer"
+// header. Without it, the key is sent in the header of the deployment of the client: api-key for Azure deployments.
+func WithApiKeyHeader(header string) CredentialOption {
+	return func(f *credentialFormat) {
+		f.header = header
+	}
+}
+
+type staticCredentials struct {
+	credential Credential
+}
+
+// NewStaticCredentials returns a provider always giving the same key. It is the provider used by New.
+// Available options are:
+//   - WithApiKeyHeader
+func NewStaticCredentials(apiKey string, opts ...CredentialOption) CredentialProvider {
+	return &staticCredentials{credential: newCredentialFormat(opts).credential(apiKey)}
+}
+
+func (p *staticCredentials) Credential(_ context.Context) (Credential, error) {
+	return p.credential, nil
+}
+
+func (p *staticCredentials) Refresh(_ context.Context, _ Credential) bool {
+	return false
+}
+
+type envCredentials struct {
+	envVar string
+	format credentialFormat
+}
+
+// NewEnvCredentials returns a provider reading the key from the environment variable on each request,
+// so that the key can be rotated without restarting the client.
+// Available options are:
+//   - WithApiKeyHeader
+func NewEnvCredentials(envVar string, opts ...CredentialOption) CredentialProvider {
+	return &envCredentials{envVar: envVar, format: newCredentialFormat(opts)}
+}
+
+func (p *envCredentials) Credential(_ context.Context) (Credential, error) {
+	key := strings.TrimSpace(os.Getenv(p.envVar))
+	if key == "" {
+		return Credential{}, fmt.Errorf("environment variable %s is not set", p.envVar)
+	}
+	return p.format.credential(key), nil
+}
+
+func (p *envCredentials) Refresh(ctx context.Context, rejected Credential) bool {
+	cred, err := p.Credential(ctx)
+	return err == nil && cred != rejected
+}
+
+type fileCredentials struct {
+	path   string
+	format credentialFormat
+
+	mu         sync.Mutex
+	modTime    time.Time
+	size       int64
+	credential Credential
+}
+
+// NewFileCredentials returns a provider reading the key, or token, from the file. The file is read again
+// when it changes, so that a sidecar can renew short-lived tokens.
+// Available options are:
+//   - WithApiKeyHeader
+func NewFileCredentials(path string, opts ...CredentialOption) CredentialProvider {
+	return &fileCredentials{path: path, format: newCredentialFormat(opts)}
+}
+
+func (p *fileCredentials) Credential(_ context.Context) (Credential, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to read the credentials file: %w", err)
+	}
+	if p.credential.Value != "" && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.credential, nil
+	}
+	if err := p.load(info); err != nil {
+		return Credential{}, err
+	}
+	return p.credential, nil
+}
+
+func (p *fileCredentials) Refresh(_ context.Context, rejected Credential) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The file may have been rewritten within the resolution of its modification time
+	info, err := os.Stat(p.path)
+	if err != nil || p.load(info) != nil {
+		return false
+	}
+	return p.credential != rejected
+}
+
+func (p *fileCredentials) load(info os.FileInfo) error {
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read the credentials file: %w", err)
+	}
+	key := strings.TrimSpace(string(content))
+	if key == "" {
+		return fmt.Errorf("credentials file %s is empty", p.path)
+	}
+	p.credential = p.format.credential(key)
+	p.modTime, p.size = info.ModTime(), info.Size()
+	return nil
+}
+
+type oauth2Credentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	params       url.Values
+	httpClient   *http.Client
+
+	mu         sync.Mutex
+	credential Credential
+	expiry     time.Time
+}
+
+type OAuth2Option func(p *oauth2Credentials)
+
+// WithOAuth2Scopes sets the scopes requested with the token.
+func WithOAuth2Scopes(scopes ...string) OAuth2Option {
+	return func(p *oauth2Credentials) {
+		p.scopes = scopes
+	}
+}
+
+// WithOAuth2Params adds parameters to the token request, such as an audience.
+func WithOAuth2Params(params url.Values) OAuth2Option {
+	return func(p *oauth2Credentials) {
+		for name, values := range params {
+			p.params[name] = append(p.params[name], values...)
+		}
+	}
+}
+
+// WithOAuth2HTTPClient sets the HTTP client used to request the tokens. Defaults to a client with a 30 seconds timeout.
+func WithOAuth2HTTPClient(httpClient *http.Client) OAuth2Option {
+	return func(p *oauth2Credentials) {
+		p.httpClient = httpClient
+	}
+}
+
+// NewOAuth2ClientCredentials returns a provider getting bearer tokens from the token endpoint with
+// the OAuth2 client credentials flow. The token is renewed shortly before it expires, or when the API rejects it.
+// Available options are:
+//   - WithOAuth2Scopes
+//   - WithOAuth2Params
+//   - WithOAuth2HTTPClient
+func NewOAuth2ClientCredentials(tokenURL, clientID, clientSecret string, opts ...OAuth2Option) CredentialProvider {
+	p := &oauth2Credentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		params:       make(url.Values),
+		httpClient:   &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *oauth2Credentials) Credential(ctx context.Context) (Credential, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.credential.Value != "" && time.Now().Before(p.expiry) {
+		return p.credential, nil
+	}
+	if err := p.fetch(ctx); err != nil {
+		return Credential{}, err
+	}
+	return p.credential, nil
+}
+
+func (p *oauth2Credentials) Refresh(_ context.Context, rejected Credential) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.credential == rejected {
+		p.credential = Credential{}
+	}
+	return true
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// fetch requests a new token. The caller must hold the lock.
+func (p *oauth2Credentials) fetch(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(p.scopes) > 0 {
+		form.Set("scope", strings.Join(p.scopes, " "))
+	}
+	for name, values := range p.params {
+		form[name] = values
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create the OAuth2 token request: %w", err)
+	}
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request an OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to request an OAuth2 token: %w", newApiErrorFromResponse(resp))
+	}
+	var token oauth2TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode the OAuth2 token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return errors.New("the OAuth2 token response has no access token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return fmt.Errorf("unsupported OAuth2 token type %q", token.TokenType)
+	}
+
+	p.credential = BearerCredential(token.AccessToken)
+	// Without expiry, the token is renewed hourly, or as soon as the API rejects it
+	p.expiry = time.Now().Add(time.Hour)
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		p.expiry = time.Now().Add(max(lifetime-oauth2ExpiryMargin, lifetime/2))
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package mistral_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// makeAuthServer accepts the requests whose header matches one of the valid values, and records the values it receives.
+func makeAuthServer(t *testing.T, header string, valid ...string) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(header)
+		mu.Lock()
+		received = append(received, value)
+		mu.Unlock()
+
+		for _, v := range valid {
+			if value == v {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message": "Unauthorized"}`))
+	}))
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func TestClient_CredentialProvider(t *testing.T) {
+	ctx := context.Background()
+	req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
+
+	t.Run("should send the key in the configured header", func(t *testing.T) {
+		// Given
+		srv, received := makeAuthServer(t, "api-key", "azure-api-key")
+		defer srv.Close()
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL),
+			mistral.WithCredentialProvider(mistral.NewStaticCredentials("azure-api-key", mistral.WithApiKeyHeader("api-key"))))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"azure-api-key"}, received())
+	})
+
+	t.Run("should not retry a static key rejected by the API", func(t *testing.T) {
+		// Given
+		srv, received := makeAuthServer(t, "Authorization", "Bearer valid-api-key")
+		defer srv.Close()
+		c := mistral.New("invalid-api-key", mistral.WithBaseApiUrl(srv.URL))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrUnauthorized)
+		assert.Len(t, received(), 1)
+	})
+
+	t.Run("should read the key from the environment on each request", func(t *testing.T) {
+		// Given
+		srv, received := makeAuthServer(t, "Authorization", "Bearer first-api-key", "Bearer second-api-key")
+		defer srv.Close()
+		t.Setenv("TEST_MISTRAL_API_KEY", "first-api-key")
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL),
+			mistral.WithCredentialProvider(mistral.NewEnvCredentials("TEST_MISTRAL_API_KEY")))
+
+		// When
+		_, err1 := c.Embeddings(ctx, req)
+		t.Setenv("TEST_MISTRAL_API_KEY", "second-api-key")
+		_, err2 := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Equal(t, []string{"Bearer first-api-key", "Bearer second-api-key"}, received())
+	})
+
+	t.Run("should fail when the environment variable is not set", func(t *testing.T) {
+		// Given
+		c := mistral.New("", mistral.WithBaseApiUrl("http://localhost:0"),
+			mistral.WithCredentialProvider(mistral.NewEnvCredentials("TEST_MISTRAL_UNSET_API_KEY")))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.ErrorContains(t, err, "TEST_MISTRAL_UNSET_API_KEY")
+	})
+
+	t.Run("should read the token again when the file changes", func(t *testing.T) {
+		// Given
+		srv, received := makeAuthServer(t, "Authorization", "Bearer first-token", "Bearer renewed-token")
+		defer srv.Close()
+		path := filepath.Join(t.TempDir(), "token")
+		assert.NoError(t, os.WriteFile(path, []byte("first-token\n"), 0o600))
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL),
+			mistral.WithCredentialProvider(mistral.NewFileCredentials(path)))
+
+		// When
+		_, err1 := c.Embeddings(ctx, req)
+		assert.NoError(t, os.WriteFile(path, []byte("renewed-token"), 0o600))
+		_, err2 := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Equal(t, "Bearer renewed-token", received()[len(received())-1])
+	})
+}
+
+func TestClient_OAuth2ClientCredentials(t *testing.T) {
+	ctx := context.Background()
+	req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
+
+	// makeTokenServer issues the tokens token-1, token-2... and checks the client credentials.
+	makeTokenServer := func(t *testing.T, issued *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, ok := r.BasicAuth()
+			if !ok || id != "client-id" || secret != "client-secret" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, "mistral.chat", r.FormValue("scope"))
+			n := atomic.AddInt32(issued, 1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token": "token-` + string(rune('0'+n)) + `", "token_type": "Bearer", "expires_in": 3600}`))
+		}))
+	}
+
+	t.Run("should reuse the token until it expires", func(t *testing.T) {
+		// Given
+		var issued int32
+		tokenSrv := makeTokenServer(t, &issued)
+		defer tokenSrv.Close()
+		srv, received := makeAuthServer(t, "Authorization", "Bearer token-1")
+		defer srv.Close()
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithCredentialProvider(
+			mistral.NewOAuth2ClientCredentials(tokenSrv.URL, "client-id", "client-secret", mistral.WithOAuth2Scopes("mistral.chat"))))
+
+		// When
+		_, err1 := c.Embeddings(ctx, req)
+		_, err2 := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&issued))
+		assert.Equal(t, []string{"Bearer token-1", "Bearer token-1"}, received())
+	})
+
+	t.Run("should retry once with a new token when the token is rejected", func(t *testing.T) {
+		// Given
+		var issued int32
+		tokenSrv := makeTokenServer(t, &issued)
+		defer tokenSrv.Close()
+		srv, received := makeAuthServer(t, "Authorization", "Bearer token-2")
+		defer srv.Close()
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(0, 0, 0), mistral.WithCredentialProvider(
+			mistral.NewOAuth2ClientCredentials(tokenSrv.URL, "client-id", "client-secret", mistral.WithOAuth2Scopes("mistral.chat"))))
+
+		// When
+		res, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 2, res.Metadata.Attempts)
+		assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, received())
+	})
+
+	t.Run("should retry only once", func(t *testing.T) {
+		// Given
+		var issued int32
+		tokenSrv := makeTokenServer(t, &issued)
+		defer tokenSrv.Close()
+		srv, received := makeAuthServer(t, "Authorization")
+		defer srv.Close()
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithCredentialProvider(
+			mistral.NewOAuth2ClientCredentials(tokenSrv.URL, "client-id", "client-secret", mistral.WithOAuth2Scopes("mistral.chat"))))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrUnauthorized)
+		assert.Len(t, received(), 2)
+	})
+
+	t.Run("should fail when the token endpoint rejects the client", func(t *testing.T) {
+		// Given
+		var issued int32
+		tokenSrv := makeTokenServer(t, &issued)
+		defer tokenSrv.Close()
+		c := mistral.New("", mistral.WithBaseApiUrl("http://localhost:0"), mistral.WithCredentialProvider(
+			mistral.NewOAuth2ClientCredentials(tokenSrv.URL, "client-id", "wrong-secret")))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrUnauthorized)
+		assert.ErrorContains(t, err, "OAuth2 token")
+	})
+}
@@ -0,0 +1,299 @@
+package mistral
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNotSupportedByDeployment is returned when the deployment doesn't offer the called endpoint,
+// such as the models endpoints on the cloud providers.
+var ErrNotSupportedByDeployment = errors.New("not supported by the deployment")
+
+// Deployment describes where the models are served: the Mistral API, a self-hosted server or a cloud provider.
+// It adapts the URL of each endpoint, the authentication header and the minor schema differences,
+// so that the Client works the same way on all of them. Use it with WithDeployment.
+type Deployment struct {
+	name    string
+	baseURL string
+
+	// path returns the path of the endpoint, and its query if any, for the model.
+	path func(endpoint Endpoint, model string, stream bool) (string, error)
+
+	// apiKeyHeader is the header sending the API keys, or empty for an "Authorization: Bearer" header.
+	// It applies to the key given to New and to the keys of the credential providers without WithApiKeyHeader.
+	apiKeyHeader string
+
+	// encodeRequest adapts the JSON body of the requests, if needed.
+	encodeRequest func(endpoint Endpoint, model string, body []byte) ([]byte, error)
+
+	// decodeResponse adapts the JSON body of the responses, if needed.
+	decodeResponse func(endpoint Endpoint, body []byte) ([]byte, error)
+
+	// decodeChunk adapts the JSON payload of the stream chunks, if needed.
+	decodeChunk func(payload []byte) ([]byte, error)
+
+	// eventStream tells whether the stream is framed as an AWS event stream instead of server-sent events.
+	eventStream bool
+
+	// modelsFromList tells whether a model is got by filtering the models list, when there is no endpoint for it.
+	modelsFromList bool
+}
+
+// Name returns the name of the deployment, such as "mistral" or "bedrock".
+func (d *Deployment) Name() string {
+	return d.name
+}
+
+// MistralDeployment is the Mistral API. It is the default deployment.
+func MistralDeployment() *Deployment {
+	return &Deployment{
+		name:    "mistral",
+		baseURL: BaseApiUrl,
+		path:    mistralPath,
+	}
+}
+
+// VLLMDeployment is a self-hosted vLLM server (or any OpenAI compatible server), at the given base URL.
+//
+// The model is the name served by vLLM. The Mistral specific parameters are translated: RandomSeed is sent as seed,
+// OutputDimension as dimensions, and SafePrompt and PromptMode are not sent. GetModel filters the models list.
+func VLLMDeployment(baseURL string) *Deployment {
+	return &Deployment{
+		name:    "vllm",
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		path:    mistralPath,
+		encodeRequest: func(_ Endpoint, _ string, body []byte) ([]byte, error) {
+			return rewriteFields(body, map[string]string{"random_seed": "seed", "output_dimension": "dimensions"},
+				"safe_prompt", "prompt_mode")
+		},
+		modelsFromList: true,
+	}
+}
+
+// AzureAIDeployment is a Mistral model deployed on Azure AI, at the endpoint of the deployment,
+// such as https://my-deployment.eastus2.models.ai.azure.com or https://my-resource.services.ai.azure.com/models.
+//
+// The API key given to New, or the keys of a KeyPool, are sent in the api-key header. The api-version query parameter is set if apiVersion is
+// not empty. RandomSeed is sent as seed, and SafePrompt and PromptMode are not sent.
+// The models endpoints are not supported.
+func AzureAIDeployment(endpoint, apiVersion string) *Deployment {
+	return &Deployment{
+		name:         "azure",
+		baseURL:      strings.TrimSuffix(endpoint, "/"),
+		apiKeyHeader: "api-key",
+		path: func(endpoint Endpoint, _ string, _ bool) (string, error) {
+			if endpoint == EndpointModels {
+				return "", ErrNotSupportedByDeployment
+			}
+			path := "/" + string(endpoint)
+			if apiVersion != "" {
+				path += "?api-version=" + url.QueryEscape(apiVersion)
+			}
+			return path, nil
+		},
+		encodeRequest: func(_ Endpoint, _ string, body []byte) ([]byte, error) {
+			return rewriteFields(body, map[string]string{"random_seed": "seed"}, "safe_prompt", "prompt_mode")
+		},
+	}
+}
+
+// VertexDeployment is a Mistral model of the Vertex AI Model Garden, in the given Google Cloud project and region,
+// such as us-central1, or global.
+//
+// The model is addressed with its Vertex ID, such as "mistral-large-2411" or "mistral-small-2503@001": the version is
+// only kept in the URL. The requests must be authenticated with a Google Cloud access token, for instance with
+// WithCredentialProvider and NewFileCredentials or NewOAuth2ClientCredentials. The models endpoints are not supported.
+func VertexDeployment(project, region string) *Deployment {
+	host := "https://" + region + "-aiplatform.googleapis.com"
+	if region == "global" {
+		host = "https://aiplatform.googleapis.com"
+	}
+	return &Deployment{
+		name:    "vertex",
+		baseURL: host,
+		path: func(endpoint Endpoint, model string, stream bool) (string, error) {
+			if endpoint == EndpointModels {
+				return "", ErrNotSupportedByDeployment
+			}
+			method := "rawPredict"
+			if stream {
+				method = "streamRawPredict"
+			}
+			return fmt.Sprintf("/v1/projects/%s/locations/%s/publishers/mistralai/models/%s:%s",
+				url.PathEscape(project), url.PathEscape(region), url.PathEscape(model), method), nil
+		},
+		encodeRequest: func(_ Endpoint, model string, body []byte) ([]byte, error) {
+			name, _, _ := strings.Cut(model, "@")
+			return setField(body, "model", name)
+		},
+	}
+}
+
+// BedrockDeployment is a Mistral model of AWS Bedrock, in the given region, such as us-east-1.
+//
+// The model is addressed with its Bedrock ID, such as "mistral.mistral-large-2407-v1:0", in the URL. The requests
+// must be authenticated with a Bedrock API key, given to New: they are not signed with AWS Signature V4.
+// The Bedrock stop_reason is reported as FinishReason, and the stream is read from the AWS event stream framing.
+// The embeddings and the models endpoints are not supported.
+func BedrockDeployment(region string) *Deployment {
+	return &Deployment{
+		name:    "bedrock",
+		baseURL: "https://bedrock-runtime." + region + ".amazonaws.com",
+		path: func(endpoint Endpoint, model string, stream bool) (string, error) {
+			if endpoint != EndpointChatCompletions {
+				return "", ErrNotSupportedByDeployment
+			}
+			if stream {
+				return "/model/" + url.PathEscape(model) + "/invoke-with-response-stream", nil
+			}
+			return "/model/" + url.PathEscape(model) + "/invoke", nil
+		},
+		encodeRequest: func(_ Endpoint, _ string, body []byte) ([]byte, error) {
+			return rewriteFields(body, nil,
+				"model", "stream", "n", "random_seed", "safe_prompt", "prompt_mode", "parallel_tool_calls")
+		},
+		decodeResponse: func(_ Endpoint, body []byte) ([]byte, error) {
+			return rewriteChoices(body, map[string]string{"stop_reason": "finish_reason"})
+		},
+		decodeChunk: decodeBedrockChunk,
+		eventStream: true,
+	}
+}
+
+func mistralPath(endpoint Endpoint, _ string, _ bool) (string, error) {
+	return "/v1/" + string(endpoint), nil
+}
+
+// endpointURL returns the URL of the endpoint for the model, on the deployment of the client.
+func (c *clientImpl) endpointURL(endpoint Endpoint, model string, stream bool) (string, error) {
+	path, err := c.deployment.path(endpoint, model, stream)
+	if err != nil {
+		return "", fmt.Errorf("%s endpoint on %s deployment: %w", endpoint, c.deployment.name, err)
+	}
+	return c.baseURL + path, nil
+}
+
+// encodeBody marshals the request body, adapted to the deployment of the client.
+func (c *clientImpl) encodeBody(endpoint Endpoint, model string, req any) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.deployment.encodeRequest == nil {
+		return body, nil
+	}
+	return c.deployment.encodeRequest(endpoint, model, body)
+}
+
+// decodeBody unmarshals the response body, adapted from the deployment of the client.
+func (c *clientImpl) decodeBody(endpoint Endpoint, body []byte, v any) error {
+	if c.deployment.decodeResponse != nil {
+		var err error
+		if body, err = c.deployment.decodeResponse(endpoint, body); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(body, v)
+}
+
+// rewriteFields renames and removes the top-level fields of the JSON object.
+func rewriteFields(body []byte, renames map[string]string, removes ...string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	renameFields(fields, renames)
+	for _, name := range removes {
+		delete(fields, name)
+	}
+	return json.Marshal(fields)
+}
+
+func renameFields(fields map[string]json.RawMessage, renames map[string]string) {
+	for from, to := range renames {
+		if value, ok := fields[from]; ok {
+			delete(fields, from)
+			fields[to] = value
+		}
+	}
+}
+
+// setField sets a top-level field of the JSON object.
+func setField(body []byte, name string, value any) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields[name] = raw
+	return json.Marshal(fields)
+}
+
+// rewriteChoices renames the fields of the choices of the JSON object. The null fields are removed.
+func rewriteChoices(body []byte, renames map[string]string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	var choices []map[string]json.RawMessage
+	if raw, ok := fields["choices"]; ok {
+		if err := json.Unmarshal(raw, &choices); err != nil {
+			return nil, err
+		}
+	}
+	for _, choice := range choices {
+		renameFields(choice, renames)
+		for name, value := range choice {
+			if string(value) == "null" {
+				delete(choice, name)
+			}
+		}
+	}
+	if choices != nil {
+		raw, err := json.Marshal(choices)
+		if err != nil {
+			return nil, err
+		}
+		fields["choices"] = raw
+	}
+	return json.Marshal(fields)
+}
+
+// bedrockInvocationMetrics are the metrics sent by Bedrock with the last chunk of a stream.
+type bedrockInvocationMetrics struct {
+	InputTokenCount  int `json:"inputTokenCount"`
+	OutputTokenCount int `json:"outputTokenCount"`
+}
+
+// decodeBedrockChunk turns a Bedrock chunk, whose choices carry a message and a stop_reason, into a Mistral chunk,
+// whose choices carry a delta and a finish_reason. The invocation metrics are reported as usage.
+func decodeBedrockChunk(payload []byte) ([]byte, error) {
+	payload, err := rewriteChoices(payload, map[string]string{"message": "delta", "stop_reason": "finish_reason"})
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	raw, ok := fields["amazon-bedrock-invocationMetrics"]
+	if !ok || fields["usage"] != nil {
+		return payload, nil
+	}
+	var metrics bedrockInvocationMetrics
+	if err := json.Unmarshal(raw, &metrics); err != nil {
+		return nil, err
+	}
+	return setField(payload, "usage", UsageInfo{
+		PromptTokens:     metrics.InputTokenCount,
+		CompletionTokens: metrics.OutputTokenCount,
+		TotalTokens:      metrics.InputTokenCount + metrics.OutputTokenCount,
+	})
+}
@@ -0,0 +1,381 @@
+package mistral_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// recordedRequest is a request received by a stand-in server.
+type recordedRequest struct {
+	Path   string
+	Header http.Header
+	Body   map[string]any
+}
+
+// makeStandInServer answers with the handler, and records the requests it receives.
+func makeStandInServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordedRequest{Path: r.URL.RequestURI(), Header: r.Header.Clone()}
+		if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+			assert.NoError(t, json.Unmarshal(body, &rec.Body))
+		}
+		mu.Lock()
+		requests = append(requests, rec)
+		mu.Unlock()
+		handler(w, r)
+	}))
+	return srv, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(body))
+}
+
+func writeSSE(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range chunks {
+		_, _ = w.Write([]byte("data: " + chunk + "\n\n"))
+	}
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+}
+
+// encodeEventStreamMessage encodes an AWS event stream message with string headers.
+func encodeEventStreamMessage(headers map[string]string, payload []byte) []byte {
+	var h bytes.Buffer
+	for name, value := range headers {
+		h.WriteByte(byte(len(name)))
+		h.WriteString(name)
+		h.WriteByte(7)
+		_ = binary.Write(&h, binary.BigEndian, uint16(len(value)))
+		h.WriteString(value)
+	}
+
+	var msg bytes.Buffer
+	_ = binary.Write(&msg, binary.BigEndian, uint32(12+h.Len()+len(payload)+4))
+	_ = binary.Write(&msg, binary.BigEndian, uint32(h.Len()))
+	_ = binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(h.Bytes())
+	msg.Write(payload)
+	_ = binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func writeEventStream(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+	for _, chunk := range chunks {
+		payload, _ := json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString([]byte(chunk))})
+		_, _ = w.Write(encodeEventStreamMessage(
+			map[string]string{":message-type": "event", ":event-type": "chunk", ":content-type": "application/json"}, payload))
+	}
+}
+
+func readChunks(t *testing.T, stream <-chan *mistral.CompletionChunk) (string, []*mistral.CompletionChunk) {
+	t.Helper()
+	var content string
+	var chunks []*mistral.CompletionChunk
+	for chunk := range stream {
+		assert.NoError(t, chunk.Error)
+		chunks = append(chunks, chunk)
+		if chunk.Error == nil {
+			delta := chunk.DeltaMessage()
+			content += delta.Content().String()
+		}
+	}
+	return content, chunks
+}
+
+func TestDeployment_VLLM(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := makeStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			writeJSON(w, `{"choices": [{"message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`)
+		case "/v1/embeddings":
+			writeJSON(w, `{"data": [{"embedding": [0.1, 0.2]}]}`)
+		case "/v1/models":
+			writeJSON(w, `{"object": "list", "data": [{"id": "mistralai/Mistral-Small-3.1-24B-Instruct-2503", "object": "model"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer srv.Close()
+	c := mistral.New("vllm-api-key", mistral.WithDeployment(mistral.VLLMDeployment(srv.URL)))
+	model := "mistralai/Mistral-Small-3.1-24B-Instruct-2503"
+
+	t.Run("should translate the Mistral specific parameters", func(t *testing.T) {
+		// Given
+		req := mistral.NewChatCompletionRequest(model, []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")})
+		req.RandomSeed = 42
+		req.SafePrompt = true
+
+		// When
+		res, err := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello", res.AssistantMessage().Content().String())
+		last := requests()[len(requests())-1]
+		assert.Equal(t, "Bearer vllm-api-key", last.Header.Get("Authorization"))
+		assert.Equal(t, float64(42), last.Body["seed"])
+		assert.NotContains(t, last.Body, "random_seed")
+		assert.NotContains(t, last.Body, "safe_prompt")
+	})
+
+	t.Run("should compute embeddings", func(t *testing.T) {
+		// Given
+		req := mistral.NewEmbeddingRequest("intfloat/e5-mistral-7b-instruct", []string{"hello"})
+		req.OutputDimension = 256
+
+		// When
+		res, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Len(t, res.Data, 1)
+		assert.Equal(t, float64(256), requests()[len(requests())-1].Body["dimensions"])
+	})
+
+	t.Run("should get a model from the list", func(t *testing.T) {
+		// When
+		card, err := c.GetModel(ctx, model)
+		_, notFoundErr := c.GetModel(ctx, "unknown-model")
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, model, card.Id)
+		assert.ErrorIs(t, notFoundErr, mistral.ErrModelNotFound)
+	})
+}
+
+func TestDeployment_AzureAI(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	srv, requests := makeStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "azure-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/models/chat/completions":
+			writeSSE(w, `{"choices": [{"delta": {"role": "assistant", "content": "Hel"}}]}`,
+				`{"choices": [{"delta": {"content": "lo"}, "finish_reason": "stop"}]}`)
+		case "/models/embeddings":
+			writeJSON(w, `{"data": [{"embedding": [0.1, 0.2]}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer srv.Close()
+	c := mistral.New("azure-api-key",
+		mistral.WithDeployment(mistral.AzureAIDeployment(srv.URL+"/models", "2024-05-01-preview")))
+
+	// When
+	stream, err := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-large-2411",
+		[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}))
+	assert.NoError(t, err)
+	content, _ := readChunks(t, stream)
+	_, embErr := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))
+	_, modelsErr := c.ListModels(ctx)
+
+	// Then
+	assert.Equal(t, "Hello", content)
+	assert.NoError(t, embErr)
+	assert.ErrorIs(t, modelsErr, mistral.ErrNotSupportedByDeployment)
+	reqs := requests()
+	assert.Len(t, reqs, 2)
+	assert.Equal(t, "/models/chat/completions?api-version=2024-05-01-preview", reqs[0].Path)
+	assert.Empty(t, reqs[0].Header.Get("Authorization"))
+	assert.Equal(t, "mistral-large-2411", reqs[0].Body["model"])
+}
+
+func TestDeployment_AzureAI_Credentials(t *testing.T) {
+	ctx := context.Background()
+	req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
+	makeAzureServer := func(t *testing.T, rejectedKey string) (*httptest.Server, func() []recordedRequest) {
+		return makeStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("api-key") == "" || r.Header.Get("api-key") == rejectedKey {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			writeJSON(w, `{"data": [{"embedding": [0.1, 0.2]}]}`)
+		})
+	}
+
+	t.Run("should send the keys of a pool in the api-key header", func(t *testing.T) {
+		// Given
+		srv, requests := makeAzureServer(t, "first-api-key")
+		defer srv.Close()
+		pool := mistral.NewKeyPool([]string{"first-api-key", "second-api-key"})
+		c := mistral.New("", mistral.WithApiKeyPool(pool),
+			mistral.WithDeployment(mistral.AzureAIDeployment(srv.URL, "")))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		reqs := requests()
+		assert.Len(t, reqs, 2)
+		assert.Equal(t, "first-api-key", reqs[0].Header.Get("api-key"))
+		assert.Equal(t, "second-api-key", reqs[1].Header.Get("api-key"))
+		assert.Empty(t, reqs[1].Header.Get("Authorization"))
+		assert.Equal(t, 1, pool.Usage()[0].Unauthorized)
+	})
+
+	t.Run("should send the key of the environment in the api-key header", func(t *testing.T) {
+		// Given
+		srv, requests := makeAzureServer(t, "")
+		defer srv.Close()
+		t.Setenv("AZURE_API_KEY", "azure-api-key")
+		c := mistral.New("", mistral.WithCredentialProvider(mistral.NewEnvCredentials("AZURE_API_KEY")),
+			mistral.WithDeployment(mistral.AzureAIDeployment(srv.URL, "")))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "azure-api-key", requests()[0].Header.Get("api-key"))
+	})
+
+	t.Run("should keep the header chosen for the provider", func(t *testing.T) {
+		// Given
+		srv, requests := makeAzureServer(t, "")
+		defer srv.Close()
+		provider := mistral.NewStaticCredentials("gateway-key", mistral.WithApiKeyHeader("X-Gateway-Key"))
+		c := mistral.New("", mistral.WithCredentialProvider(provider),
+			mistral.WithDeployment(mistral.AzureAIDeployment(srv.URL, "")))
+
+		// When
+		_, err := c.Embeddings(ctx, req)
+
+		// Then
+		assert.Error(t, err)
+		assert.Equal(t, "gateway-key", requests()[0].Header.Get("X-Gateway-Key"))
+		assert.Empty(t, requests()[0].Header.Get("api-key"))
+	})
+}
+
+func TestDeployment_Vertex(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	srv, requests := makeStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/projects/my-project/locations/europe-west4/publishers/mistralai/models/mistral-small-2503@001:rawPredict":
+			writeJSON(w, `{"choices": [{"message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`)
+		case "/v1/projects/my-project/locations/europe-west4/publishers/mistralai/models/mistral-small-2503@001:streamRawPredict":
+			writeSSE(w, `{"choices": [{"delta": {"role": "assistant", "content": "Hel"}}]}`,
+				`{"choices": [{"delta": {"content": "lo"}, "finish_reason": "stop"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer srv.Close()
+	c := mistral.New("google-access-token", mistral.WithBaseApiUrl(srv.URL),
+		mistral.WithDeployment(mistral.VertexDeployment("my-project", "europe-west4")))
+	messages := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	// When
+	res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-2503@001", messages))
+	assert.NoError(t, err)
+	stream, streamErr := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-small-2503@001", messages))
+	assert.NoError(t, streamErr)
+	content, _ := readChunks(t, stream)
+
+	// Then
+	assert.Equal(t, "Hello", res.AssistantMessage().Content().String())
+	assert.Equal(t, "Hello", content)
+	reqs := requests()
+	assert.Len(t, reqs, 2)
+	assert.Equal(t, "Bearer google-access-token", reqs[0].Header.Get("Authorization"))
+	assert.Equal(t, "mistral-small-2503", reqs[0].Body["model"])
+}
+
+func TestDeployment_Bedrock(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	model := "mistral.mistral-large-2407-v1:0"
+	srv, requests := makeStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/model/" + model + "/invoke":
+			writeJSON(w, `{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "stop_reason": "stop"}]}`)
+		case "/model/" + model + "/invoke-with-response-stream":
+			writeEventStream(w,
+				`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hel"}, "stop_reason": null}]}`,
+				`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "lo"}, "stop_reason": "stop"}],
+					"amazon-bedrock-invocationMetrics": {"inputTokenCount": 7, "outputTokenCount": 2}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer srv.Close()
+	c := mistral.New("bedrock-api-key", mistral.WithBaseApiUrl(srv.URL),
+		mistral.WithDeployment(mistral.BedrockDeployment("us-west-2")))
+	messages := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	// When
+	res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest(model, messages))
+	assert.NoError(t, err)
+	stream, streamErr := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest(model, messages))
+	assert.NoError(t, streamErr)
+	content, chunks := readChunks(t, stream)
+	_, embErr := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))
+
+	// Then
+	assert.Equal(t, "Hello", res.AssistantMessage().Content().String())
+	assert.Equal(t, mistral.FinishReasonStop, res.Choices[0].FinishReason)
+	assert.Equal(t, "Hello", content)
+	if assert.Len(t, chunks, 2) {
+		assert.True(t, chunks[1].IsLastChunk)
+		assert.Equal(t, 9, chunks[1].Usage.TotalTokens)
+	}
+	assert.ErrorIs(t, embErr, mistral.ErrNotSupportedByDeployment)
+	reqs := requests()
+	assert.Len(t, reqs, 2)
+	assert.Equal(t, "Bearer bedrock-api-key", reqs[0].Header.Get("Authorization"))
+	assert.NotContains(t, reqs[0].Body, "model")
+	assert.NotContains(t, reqs[1].Body, "stream")
+}
+
+func TestDeployment_Bedrock_StreamException(t *testing.T) {
+	// Given
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		_, _ = w.Write(encodeEventStreamMessage(
+			map[string]string{":message-type": "exception", ":exception-type": "throttlingException"},
+			[]byte(`{"message": "Too many requests"}`)))
+	}))
+	defer srv.Close()
+	c := mistral.New("bedrock-api-key", mistral.WithBaseApiUrl(srv.URL),
+		mistral.WithDeployment(mistral.BedrockDeployment("us-west-2")))
+
+	// When
+	stream, err := c.ChatCompletionStream(context.Background(), mistral.NewChatCompletionStreamRequest(
+		"mistral.mistral-large-2407-v1:0", []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}))
+
+	// Then
+	assert.NoError(t, err)
+	chunk := <-stream
+	assert.ErrorContains(t, chunk.Error, "throttlingException: Too many requests")
+}
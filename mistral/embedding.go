@@ -2,8 +2,8 @@ package mistral
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 )
@@ -67,6 +67,8 @@ type EmbeddingResponse struct {
 	Usage   UsageInfo       `json:"usage"`
 	Data    []EmbeddingData `json:"data"`
 	Latency time.Duration   `json:"latency_ms,omitempty"`
+
+	Metadata ResponseMetadata `json:"-"`
 }
 
 func (r *EmbeddingResponse) Embeddings() []EmbeddingVector {
@@ -98,20 +100,23 @@ func WithEmbeddingEncodingFormat(encoding EmbeddingEncodingFormat) EmbeddingRequ
 }
 
 func (c *clientImpl) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
-	if c.limiter != nil {
-		if err := c.limiter.Wait(ctx); err != nil {
-			return nil, err
-		}
+	url, err := c.endpointURL(EndpointEmbeddings, req.Model, false)
+	if err != nil {
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/v1/embeddings", c.baseURL)
-
-	jsonValue, err := json.Marshal(req)
+	jsonValue, err := c.encodeBody(EndpointEmbeddings, req.Model, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal req body: %w", err)
 	}
 
-	response, lat, err := c.sendRequest(ctx, http.MethodPost, url, jsonValue)
+	call, err := c.acquire(ctx, EndpointEmbeddings, req.Model, estimateEmbeddingTokens(req))
+	if err != nil {
+		return nil, err
+	}
+
+	response, lat, meta, err := c.sendHedged(ctx, EndpointEmbeddings, req.Model, http.MethodPost, url, jsonValue)
+	call.finish(err)
 	if err != nil {
 		return nil, err
 	}
@@ -121,12 +126,19 @@ func (c *clientImpl) Embeddings(ctx context.Context, req *EmbeddingRequest) (*Em
 		logger.Println("POST /v1/embeddings called")
 	}
 
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
 	var resp EmbeddingResponse
-	if err = unmarshallBody(response, &resp); err != nil {
+	if err = c.decodeBody(EndpointEmbeddings, body, &resp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
 	}
 
 	resp.Latency = lat
+	resp.Metadata = meta
+	call.reconcileUsage(&resp.Usage)
+	call.observeQuota(response.Header)
 
 	return &resp, nil
 }
@@ -1,10 +1,37 @@
 package mistral
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 )
 
+var (
+	// ErrRateLimited matches the errors of the requests rejected by the rate limits of the API (HTTP 429).
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrUnauthorized matches the errors of the requests rejected because of an invalid API key (HTTP 401).
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrContextLengthExceeded matches the errors of the requests whose prompt exceeds the context window of the model.
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+
+	// ErrServerError matches the errors of the requests which failed on the server side (HTTP 5xx).
+	ErrServerError = errors.New("server error")
+
+	// ErrRetriesExhausted matches the errors of the requests which still failed after all their retries (see RetriesExhaustedError).
+	ErrRetriesExhausted = errors.New("retries exhausted")
+)
+
+// contextLengthMarkers are the parts of the error messages telling that the context length is exceeded.
+var contextLengthMarkers = []string{"context length", "context_length", "too large for model", "context window"}
+
+// ApiError is the error returned when the API answers with an error status.
+// It matches ErrRateLimited, ErrUnauthorized, ErrContextLengthExceeded or ErrServerError with errors.Is,
+// depending on the status and the message.
 type ApiError interface {
 	error
 
@@ -13,11 +40,19 @@ type ApiError interface {
 
 	// Content returns the original JSON response body or nil otherwise.
 	Content() map[string]any
+
+	// RequestID returns the ID given to the request by the API, if any.
+	RequestID() string
+
+	// Retryable tells whether sending the request again may succeed (rate limits, timeouts and server errors).
+	Retryable() bool
 }
 
 type apiError struct {
-	code    int
-	content map[string]any
+	code      int
+	content   map[string]any
+	body      string
+	requestID string
 }
 
 // NewApiError creates a new ApiError instance.
@@ -25,6 +60,20 @@ func NewApiError(code int, content map[string]any) ApiError {
 	return &apiError{code: code, content: content}
 }
 
+// newApiErrorFromResponse reads the error response. The body is kept as text when it isn't a JSON object.
+func newApiErrorFromResponse(resp *http.Response) ApiError {
+	e := &apiError{code: resp.StatusCode, requestID: requestIdFromHeaders(resp.Header)}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return e
+	}
+	if err := json.Unmarshal(data, &e.content); err != nil {
+		e.content = nil
+		e.body = strings.TrimSpace(string(data))
+	}
+	return e
+}
+
 func (e *apiError) Error() string {
 	msg := strings.Builder{}
 	if e.code > 0 {
@@ -32,6 +81,7 @@ func (e *apiError) Error() string {
 	}
 
 	if e.content == nil {
+		msg.WriteString(e.body)
 		return strings.TrimSpace(msg.String())
 	}
 
@@ -76,6 +126,89 @@ func (e *apiError) Content() map[string]any {
 	return e.content
 }
 
+func (e *apiError) RequestID() string {
+	return e.requestID
+}
+
+func (e *apiError) Retryable() bool {
+	switch {
+	case e.code == http.StatusRequestTimeout, e.code == http.StatusTooManyRequests:
+		return true
+	case e.code >= 500:
+		return e.code != http.StatusNotImplemented
+	default:
+		return false
+	}
+}
+
+func (e *apiError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.code == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.code == http.StatusUnauthorized
+	case ErrServerError:
+		return e.code >= 500
+	case ErrContextLengthExceeded:
+		return e.isContextLengthExceeded()
+	default:
+		return false
+	}
+}
+
+func (e *apiError) isContextLengthExceeded() bool {
+	if e.code < 400 || e.code >= 500 {
+		return false
+	}
+	msg := strings.ToLower(e.Error())
+	if code, ok := e.content["code"].(string); ok {
+		msg += " " + strings.ToLower(code)
+	}
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetriesExhaustedError is returned when a request still fails after all its retries.
+// It matches ErrRetriesExhausted with errors.Is, and wraps the last failure.
+type RetriesExhaustedError struct {
+	// Attempts is the number of requests made.
+	Attempts int
+
+	// Err is the failure of the last attempt.
+	Err error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("exhausted retries after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetriesExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetriesExhaustedError) Is(target error) bool {
+	return target == ErrRetriesExhausted
+}
+
+// Retryable tells whether the last failure is retryable, i.e. whether retrying later may succeed.
+func (e *RetriesExhaustedError) Retryable() bool {
+	return IsRetryable(e.Err)
+}
+
+// IsRetryable tells whether sending the request which failed with the error again may succeed:
+// rate limits, timeouts, server errors and transient network errors are retryable.
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return isRetryableErr(err)
+}
+
 func extractApiErrorDetails(raw any) []string {
 	var details []string
 	switch v := raw.(type) {
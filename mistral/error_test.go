@@ -1,9 +1,13 @@
 package mistral_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thomas-marquis/mistral-client/mistral"
@@ -135,3 +139,140 @@ func TestApiError(t *testing.T) {
 		assert.Equal(t, "[400] invalid_request_invalid_args: This model does not support output_dimension.", err.Error())
 	})
 }
+
+func TestApiError_Is(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       mistral.ApiError
+		target    error
+		expected  bool
+		retryable bool
+	}{
+		{
+			name:      "should match ErrRateLimited on 429",
+			err:       mistral.NewApiError(http.StatusTooManyRequests, nil),
+			target:    mistral.ErrRateLimited,
+			expected:  true,
+			retryable: true,
+		},
+		{
+			name:     "should match ErrUnauthorized on 401",
+			err:      mistral.NewApiError(http.StatusUnauthorized, map[string]any{"detail": "Unauthorized"}),
+			target:   mistral.ErrUnauthorized,
+			expected: true,
+		},
+		{
+			name:      "should match ErrServerError on 5xx",
+			err:       mistral.NewApiError(http.StatusBadGateway, nil),
+			target:    mistral.ErrServerError,
+			expected:  true,
+			retryable: true,
+		},
+		{
+			name: "should match ErrContextLengthExceeded when the prompt is too large",
+			err: mistral.NewApiError(http.StatusBadRequest, map[string]any{
+				"object":  "error",
+				"message": "Prompt contains 40000 tokens and 0 draft tokens, too large for model with 32768 maximum context length",
+				"type":    "invalid_request_message_order",
+			}),
+			target:   mistral.ErrContextLengthExceeded,
+			expected: true,
+		},
+		{
+			name:     "should not match ErrContextLengthExceeded on other bad requests",
+			err:      mistral.NewApiError(http.StatusBadRequest, map[string]any{"message": "This model does not support output_dimension."}),
+			target:   mistral.ErrContextLengthExceeded,
+			expected: false,
+		},
+		{
+			name:     "should not match ErrRateLimited on other statuses",
+			err:      mistral.NewApiError(http.StatusForbidden, nil),
+			target:   mistral.ErrRateLimited,
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, errors.Is(tc.err, tc.target))
+			assert.Equal(t, tc.retryable, tc.err.Retryable())
+			assert.Equal(t, tc.retryable, mistral.IsRetryable(tc.err))
+		})
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	ctx := context.Background()
+	inputMsgs := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	t.Run("should wrap the last error when the retries are exhausted", func(t *testing.T) {
+		// Given
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.Header().Set("X-Request-Id", "req-429")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"object": "error", "message": "Requests rate limit exceeded", "type": "rate_limited", "code": "1300"}`))
+		}))
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(2, time.Millisecond, time.Millisecond))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.Equal(t, 3, attempts)
+		assert.ErrorIs(t, err, mistral.ErrRetriesExhausted)
+		assert.ErrorIs(t, err, mistral.ErrRateLimited)
+		assert.True(t, mistral.IsRetryable(err))
+
+		var exhausted *mistral.RetriesExhaustedError
+		assert.ErrorAs(t, err, &exhausted)
+		assert.Equal(t, 3, exhausted.Attempts)
+
+		var apiErr mistral.ApiError
+		assert.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusTooManyRequests, apiErr.Code())
+		assert.Equal(t, "req-429", apiErr.RequestID())
+		assert.Equal(t, "1300", apiErr.Content()["code"])
+	})
+
+	t.Run("should return a typed error for server errors", func(t *testing.T) {
+		// Given
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "upstream connect error", http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(0, time.Millisecond, time.Millisecond))
+
+		// When
+		_, err := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrServerError)
+		assert.NotErrorIs(t, err, mistral.ErrRetriesExhausted)
+		assert.EqualError(t, err, "[500] upstream connect error")
+	})
+
+	t.Run("should not retry nor wrap non retryable errors", func(t *testing.T) {
+		// Given
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"detail": "Unauthorized"}`))
+		}))
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(2, time.Millisecond, time.Millisecond))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.Equal(t, 1, attempts)
+		assert.ErrorIs(t, err, mistral.ErrUnauthorized)
+		assert.NotErrorIs(t, err, mistral.ErrRetriesExhausted)
+		assert.False(t, mistral.IsRetryable(err))
+	})
+}
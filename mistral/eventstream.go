@@ -0,0 +1,167 @@
+package mistral
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// streamReader reads the JSON payloads of the chunks of a stream. It returns io.EOF at the end of the stream.
+type streamReader interface {
+	next() ([]byte, error)
+}
+
+func (d *Deployment) newStreamReader(r io.Reader) streamReader {
+	if d.eventStream {
+		return &eventStreamReader{r: bufio.NewReader(r)}
+	}
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// sseReader reads server-sent events, whose data lines carry the chunks until a [DONE] line.
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func (s *sseReader) next() ([]byte, error) {
+	for {
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to read response line: %w", err)
+		}
+
+		if !bytes.HasPrefix(line, []byte("data: ")) {
+			continue
+		}
+		payload := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data: ")))
+		if string(payload) == "[DONE]" {
+			return nil, io.EOF
+		}
+		return payload, nil
+	}
+}
+
+const (
+	// eventStreamPreludeLen is the length of the prelude of an event stream message:
+	// total length, headers length and prelude CRC.
+	eventStreamPreludeLen = 12
+
+	// eventStreamMaxMessageLen is the maximum length of an event stream message.
+	eventStreamMaxMessageLen = 16 << 20
+)
+
+// eventStreamReader reads an AWS event stream (application/vnd.amazon.eventstream), as sent by Bedrock.
+// Each chunk is the base64 encoded bytes field of the JSON payload of a message.
+type eventStreamReader struct {
+	r *bufio.Reader
+}
+
+func (s *eventStreamReader) next() ([]byte, error) {
+	headers, payload, err := s.readMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if headers[":message-type"] != "event" {
+		var exception struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(payload, &exception)
+		return nil, fmt.Errorf("stream exception %s: %s", headers[":exception-type"], exception.Message)
+	}
+
+	var event struct {
+		Bytes string `json:"bytes"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event stream payload: %w", err)
+	}
+	chunk, err := base64.StdEncoding.DecodeString(event.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode event stream payload: %w", err)
+	}
+	return chunk, nil
+}
+
+// readMessage reads a message, checking its CRCs, and returns its string headers and its payload.
+func (s *eventStreamReader) readMessage() (map[string]string, []byte, error) {
+	prelude := make([]byte, eventStreamPreludeLen)
+	if _, err := io.ReadFull(s.r, prelude); err != nil {
+		if err == io.EOF {
+			return nil, nil, io.EOF
+		}
+		return nil, nil, fmt.Errorf("failed to read event stream prelude: %w", err)
+	}
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, nil, errors.New("invalid event stream prelude checksum")
+	}
+	if totalLen > eventStreamMaxMessageLen || uint64(headersLen)+eventStreamPreludeLen+4 > uint64(totalLen) {
+		return nil, nil, fmt.Errorf("invalid event stream message length %d", totalLen)
+	}
+
+	message := make([]byte, totalLen)
+	copy(message, prelude)
+	if _, err := io.ReadFull(s.r, message[eventStreamPreludeLen:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to read event stream message: %w", err)
+	}
+	if crc32.ChecksumIEEE(message[:totalLen-4]) != binary.BigEndian.Uint32(message[totalLen-4:]) {
+		return nil, nil, errors.New("invalid event stream message checksum")
+	}
+
+	headers, err := parseEventStreamHeaders(message[eventStreamPreludeLen : eventStreamPreludeLen+headersLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, message[eventStreamPreludeLen+headersLen : totalLen-4], nil
+}
+
+// eventStreamValueLen are the lengths of the fixed size header values, by type.
+var eventStreamValueLen = map[byte]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 4, 5: 8, 8: 8, 9: 16}
+
+// parseEventStreamHeaders returns the headers whose value is a string; the others are skipped.
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	errInvalid := errors.New("invalid event stream headers")
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, errInvalid
+		}
+		name := string(b[1 : 1+nameLen])
+		valueType := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		switch valueType {
+		case 6, 7: // byte array, string
+			if len(b) < 2 {
+				return nil, errInvalid
+			}
+			valueLen := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+valueLen {
+				return nil, errInvalid
+			}
+			if valueType == 7 {
+				headers[name] = string(b[2 : 2+valueLen])
+			}
+			b = b[2+valueLen:]
+		default:
+			valueLen, ok := eventStreamValueLen[valueType]
+			if !ok || len(b) < valueLen {
+				return nil, errInvalid
+			}
+			b = b[valueLen:]
+		}
+	}
+	return headers, nil
+}
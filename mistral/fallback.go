@@ -0,0 +1,228 @@
+package mistral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type fallbackClientDecorator struct {
+	Client
+
+	chains         map[string][]string
+	shouldFallback func(err error) bool
+
+	mu       sync.Mutex
+	cards    map[string]fallbackCard
+	cardsTTL time.Duration
+}
+
+// fallbackCard is the outcome of the lookup of a model card, kept until it expires.
+type fallbackCard struct {
+	card      *BaseModelCard
+	err       error
+	expiresAt time.Time
+}
+
+var _ Client = (*fallbackClientDecorator)(nil)
+
+type FallbackOption func(c *fallbackClientDecorator)
+
+// WithFallbackChain sets the models to try, in order, when the given model is unavailable.
+// It is used for the requests which don't set their own FallbackModels.
+func WithFallbackChain(model string, fallbacks ...string) FallbackOption {
+	return func(c *fallbackClientDecorator) {
+		c.chains[model] = fallbacks
+	}
+}
+
+// WithFallbackPredicate replaces the function telling which errors make the request fall back to the next model.
+func WithFallbackPredicate(shouldFallback func(err error) bool) FallbackOption {
+	return func(c *fallbackClientDecorator) {
+		c.shouldFallback = shouldFallback
+	}
+}
+
+// NewFallback decorates a client to fall back to other models when the model of a chat completion request is
+// unavailable: rate limited (ErrRateLimited), failing (ErrServerError) or behind an open circuit (ErrCircuitOpen),
+// once the retries of the underlying client are exhausted.
+//
+// The models are tried in order: the model of the request, then its FallbackModels, or the chain configured
+// with WithFallbackChain. The fallback models lacking the capabilities required by the request (vision, tools,
+// audio) are skipped; the model of the request is always tried, unless the API doesn't know it, in which case
+// ErrModelNotFound is returned. The model which served the answer is reported in ResponseMetadata.ServedBy.
+// Available options are:
+//   - WithFallbackChain
+//   - WithFallbackPredicate
+func NewFallback(client Client, opts ...FallbackOption) Client {
+	c := &fallbackClientDecorator{
+		Client:         client,
+		chains:         make(map[string][]string),
+		shouldFallback: isModelUnavailable,
+		cards:          make(map[string]fallbackCard),
+		cardsTTL:       DefaultModelsCacheTTL,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *fallbackClientDecorator) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	models, err := c.candidates(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, model := range models {
+		res, err := c.Client.ChatCompletion(ctx, withModel(req, model))
+		if err == nil {
+			// The response may be shared with other callers by the cache: copy it
+			served := *res
+			served.Metadata.ServedBy = model
+			return &served, nil
+		}
+		if !c.shouldFallback(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (c *fallbackClientDecorator) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (<-chan *CompletionChunk, error) {
+	models, err := c.candidates(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, model := range models {
+		chunks, err := c.Client.ChatCompletionStream(ctx, withModel(req, model))
+		if err == nil {
+			return servedBy(ctx, chunks, model), nil
+		}
+		if !c.shouldFallback(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// candidates returns the models to try for the request: its model, then the fallback models having
+// the required capabilities.
+func (c *fallbackClientDecorator) candidates(ctx context.Context, req *ChatCompletionRequest) ([]string, error) {
+	// A typo in the model of the request must not silently switch to another model
+	if _, err := c.card(ctx, req.Model); errors.Is(err, ErrModelNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, req.Model)
+	}
+
+	chain := req.FallbackModels
+	if chain == nil {
+		chain = c.chains[req.Model]
+	}
+
+	required := req.RequiredCapabilities()
+	seen := map[string]struct{}{req.Model: {}}
+	models := []string{req.Model}
+	for _, model := range chain {
+		if _, ok := seen[model]; ok {
+			continue
+		}
+		seen[model] = struct{}{}
+
+		card, err := c.card(ctx, model)
+		if err != nil && !errors.Is(err, ErrModelNotFound) {
+			// The capabilities are unknown: let the API decide
+			models = append(models, model)
+			continue
+		}
+		if card != nil && card.Match(required) {
+			models = append(models, model)
+		}
+	}
+	return models, nil
+}
+
+// card returns the card of the model, remembering it for the next requests as long as the models metadata
+// are cached (DefaultModelsCacheTTL). Failed lookups are remembered too, so that a deployment which can't
+// look up the models (ErrNotSupportedByDeployment) doesn't cost an extra round trip per request.
+func (c *fallbackClientDecorator) card(ctx context.Context, model string) (*BaseModelCard, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.cards[model]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.card, entry.err
+	}
+
+	card, err := c.Client.GetModel(ctx, model)
+	if err != nil && ctx.Err() != nil {
+		// The lookup was interrupted, not answered
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cards[model] = fallbackCard{card: card, err: err, expiresAt: now.Add(c.cardsTTL)}
+	c.mu.Unlock()
+	return card, err
+}
+
+// RequiredCapabilities returns the capabilities a model needs to answer the request:
+// vision for images, audio for input audio and function calling for tools.
+func (r *ChatCompletionRequest) RequiredCapabilities() *ModelCapabilities {
+	caps := &ModelCapabilities{FunctionCalling: len(r.Tools) > 0}
+	for _, msg := range r.Messages {
+		if msg == nil || msg.Content() == nil {
+			continue
+		}
+		for _, chunk := range msg.Content().Chunks() {
+			switch chunk.Type() {
+			case ContentTypeImageURL:
+				caps.Vision = true
+			case ContentTypeAudio:
+				caps.Audio = true
+			}
+		}
+	}
+	return caps
+}
+
+// isModelUnavailable tells whether the error shows that the model can't serve the request for now.
+func isModelUnavailable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) || errors.Is(err, ErrCircuitOpen)
+}
+
+// withModel returns a copy of the request targeting the model.
+func withModel(req *ChatCompletionRequest, model string) *ChatCompletionRequest {
+	r := *req
+	r.Model = model
+	r.FallbackModels = nil
+	return &r
+}
+
+// servedBy forwards the chunks, reporting the model which serves them.
+func servedBy(ctx context.Context, chunks <-chan *CompletionChunk, model string) <-chan *CompletionChunk {
+	out := make(chan *CompletionChunk)
+	go func() {
+		defer close(out)
+		for chunk := range chunks {
+			// Chunks may be shared with other subscribers by the cache: copy them
+			c := *chunk
+			c.Metadata.ServedBy = model
+			select {
+			case out <- &c:
+			case <-ctx.Done():
+				// The reader is gone: drain the stream, which ends with the context
+				for range chunks {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
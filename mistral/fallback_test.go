@@ -0,0 +1,256 @@
+package mistral_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestFallbackClientDecorator_ChatCompletion(t *testing.T) {
+	ctx := context.TODO()
+	cards := map[string]*mistral.BaseModelCard{
+		"mistral-large-latest":  {Id: "mistral-large-latest", Capabilities: mistral.ModelCapabilities{CompletionChat: true, FunctionCalling: true, Vision: true}},
+		"mistral-medium-latest": {Id: "mistral-medium-latest", Capabilities: mistral.ModelCapabilities{CompletionChat: true, FunctionCalling: true}},
+		"mistral-small-latest":  {Id: "mistral-small-latest", Capabilities: mistral.ModelCapabilities{CompletionChat: true, FunctionCalling: true, Vision: true}},
+	}
+
+	// newMockClient answers with the model cards, and fails the chat completions of the given models.
+	newMockClient := func(t *testing.T, failures map[string]error) (*mocks.MockClient, *[]string) {
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		var calledModels []string
+
+		mockClient.EXPECT().
+			GetModel(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, id string) (*mistral.BaseModelCard, error) {
+				if card, ok := cards[id]; ok {
+					return card, nil
+				}
+				return nil, mistral.ErrModelNotFound
+			}).
+			AnyTimes()
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+				calledModels = append(calledModels, req.Model)
+				if err := failures[req.Model]; err != nil {
+					return nil, err
+				}
+				return &mistral.ChatCompletionResponse{
+					Model:   req.Model,
+					Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Hello")}},
+				}, nil
+			}).
+			AnyTimes()
+
+		return mockClient, &calledModels
+	}
+
+	messages := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	t.Run("should fall back to the next models of the request", func(t *testing.T) {
+		// Given
+		mockClient, calledModels := newMockClient(t, map[string]error{
+			"mistral-large-latest":  &mistral.RetriesExhaustedError{Attempts: 4, Err: mistral.NewApiError(http.StatusTooManyRequests, nil)},
+			"mistral-medium-latest": mistral.NewApiError(http.StatusServiceUnavailable, nil),
+		})
+		c := mistral.NewFallback(mockClient)
+		req := mistral.NewChatCompletionRequest("mistral-large-latest", messages,
+			mistral.WithFallbackModels("mistral-medium-latest", "mistral-small-latest"))
+
+		// When
+		res, err := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "mistral-small-latest", res.Metadata.ServedBy)
+		assert.Equal(t, []string{"mistral-large-latest", "mistral-medium-latest", "mistral-small-latest"}, *calledModels)
+		assert.Equal(t, "mistral-large-latest", req.Model, "the request of the caller must not be modified")
+	})
+
+	t.Run("should use the configured chain", func(t *testing.T) {
+		// Given
+		mockClient, calledModels := newMockClient(t, map[string]error{
+			"mistral-large-latest": mistral.NewApiError(http.StatusInternalServerError, nil),
+		})
+		c := mistral.NewFallback(mockClient, mistral.WithFallbackChain("mistral-large-latest", "mistral-medium-latest"))
+
+		// When
+		res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large-latest", messages))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "mistral-medium-latest", res.Metadata.ServedBy)
+		assert.Equal(t, []string{"mistral-large-latest", "mistral-medium-latest"}, *calledModels)
+	})
+
+	t.Run("should skip the models lacking the required capabilities", func(t *testing.T) {
+		// Given
+		mockClient, calledModels := newMockClient(t, map[string]error{
+			"mistral-large-latest": mistral.NewApiError(http.StatusTooManyRequests, nil),
+		})
+		c := mistral.NewFallback(mockClient)
+		req := mistral.NewChatCompletionRequest("mistral-large-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessage(mistral.ContentChunks{
+				mistral.NewTextChunk("What's in this image?"),
+				mistral.NewImageUrlChunk("https://example.com/image.png"),
+			})},
+			mistral.WithFallbackModels("mistral-medium-latest", "unknown-model", "mistral-small-latest"))
+
+		// When
+		res, err := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "mistral-small-latest", res.Metadata.ServedBy)
+		assert.Equal(t, []string{"mistral-large-latest", "mistral-small-latest"}, *calledModels)
+	})
+
+	t.Run("should not fall back on other errors", func(t *testing.T) {
+		// Given
+		mockClient, calledModels := newMockClient(t, map[string]error{
+			"mistral-large-latest": mistral.NewApiError(http.StatusBadRequest, nil),
+		})
+		c := mistral.NewFallback(mockClient)
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large-latest", messages,
+			mistral.WithFallbackModels("mistral-small-latest")))
+
+		// Then
+		assert.Error(t, err)
+		assert.Equal(t, []string{"mistral-large-latest"}, *calledModels)
+	})
+
+	t.Run("should return the last error when all the models fail", func(t *testing.T) {
+		// Given
+		mockClient, _ := newMockClient(t, map[string]error{
+			"mistral-large-latest": mistral.NewApiError(http.StatusTooManyRequests, nil),
+			"mistral-small-latest": mistral.NewApiError(http.StatusBadGateway, nil),
+		})
+		c := mistral.NewFallback(mockClient)
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large-latest", messages,
+			mistral.WithFallbackModels("mistral-small-latest")))
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrServerError)
+	})
+
+	t.Run("should always try the model of the request", func(t *testing.T) {
+		// Given
+		mockClient, calledModels := newMockClient(t, nil)
+		c := mistral.NewFallback(mockClient)
+		req := mistral.NewChatCompletionRequest("mistral-medium-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessage(mistral.ContentChunks{mistral.NewAudioChunk("https://example.com/audio.mp3")})},
+			mistral.WithFallbackModels("mistral-small-latest"))
+
+		// When
+		res, err := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "mistral-medium-latest", res.Metadata.ServedBy)
+		assert.Equal(t, []string{"mistral-medium-latest"}, *calledModels)
+	})
+
+	t.Run("should fail when the model of the request does not exist", func(t *testing.T) {
+		// Given
+		mockClient, calledModels := newMockClient(t, nil)
+		c := mistral.NewFallback(mockClient)
+		req := mistral.NewChatCompletionRequest("mistral-larg-latest", messages,
+			mistral.WithFallbackModels("mistral-large-latest"))
+
+		// When
+		_, err := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrModelNotFound)
+		assert.ErrorContains(t, err, "mistral-larg-latest")
+		assert.Empty(t, *calledModels)
+	})
+
+	t.Run("should not modify the response of the decorated client", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		shared := &mistral.ChatCompletionResponse{
+			Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Hello")}},
+		}
+		mockClient.EXPECT().GetModel(gomock.Any(), gomock.Any()).Return(&mistral.BaseModelCard{}, nil).AnyTimes()
+		mockClient.EXPECT().ChatCompletion(gomock.Any(), gomock.Any()).Return(shared, nil)
+		c := mistral.NewFallback(mockClient)
+
+		// When
+		res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large-latest", messages))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "mistral-large-latest", res.Metadata.ServedBy)
+		assert.Empty(t, shared.Metadata.ServedBy, "the response may be shared by the cache")
+	})
+
+	t.Run("should remember the failed model lookups", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			GetModel(gomock.Any(), "mistral-large-latest").
+			Return(nil, mistral.ErrNotSupportedByDeployment).
+			Times(1)
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			Return(&mistral.ChatCompletionResponse{}, nil).
+			Times(2)
+		c := mistral.NewFallback(mockClient)
+		req := mistral.NewChatCompletionRequest("mistral-large-latest", messages)
+
+		// When
+		_, err1 := c.ChatCompletion(ctx, req)
+		_, err2 := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+	})
+}
+
+func TestFallbackClientDecorator_ChatCompletionStream(t *testing.T) {
+	// Given
+	ctx := context.TODO()
+	ctrl := gomock.NewController(t)
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().GetModel(gomock.Any(), gomock.Any()).Return(&mistral.BaseModelCard{}, nil).AnyTimes()
+	mockClient.EXPECT().
+		ChatCompletionStream(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+			if req.Model == "mistral-large-latest" {
+				return nil, mistral.NewApiError(http.StatusTooManyRequests, nil)
+			}
+			out := make(chan *mistral.CompletionChunk, 1)
+			out <- &mistral.CompletionChunk{Model: req.Model}
+			close(out)
+			return out, nil
+		}).
+		Times(2)
+	c := mistral.NewFallback(mockClient)
+
+	// When
+	stream, err := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-large-latest",
+		[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}, mistral.WithFallbackModels("mistral-small-latest")))
+
+	// Then
+	assert.NoError(t, err)
+	var chunks []*mistral.CompletionChunk
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	assert.Len(t, chunks, 1)
+	assert.Equal(t, "mistral-small-latest", chunks[0].Metadata.ServedBy)
+}
@@ -0,0 +1,160 @@
+package mistral
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// hedgeLatencyWindow is the number of latencies remembered per endpoint and model to compute the hedge delay.
+	hedgeLatencyWindow = 100
+
+	// hedgeMinSamples is the number of latencies needed before using the percentile instead of the initial delay.
+	hedgeMinSamples = 10
+)
+
+// hedger computes when to send a hedge request from the latencies observed per endpoint and model.
+type hedger struct {
+	percentile   float64
+	initialDelay time.Duration
+
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+}
+
+func newHedger(percentile float64, initialDelay time.Duration) *hedger {
+	return &hedger{
+		percentile:   min(max(percentile, 0), 1),
+		initialDelay: initialDelay,
+		latencies:    make(map[string][]time.Duration),
+	}
+}
+
+// delay returns the configured percentile of the latencies observed for the key, or the initial delay
+// while there are not enough of them.
+func (h *hedger) delay(key string) time.Duration {
+	h.mu.Lock()
+	latencies := slices.Clone(h.latencies[key])
+	h.mu.Unlock()
+
+	if len(latencies) < hedgeMinSamples {
+		return h.initialDelay
+	}
+	slices.Sort(latencies)
+	i := int(math.Ceil(h.percentile*float64(len(latencies)))) - 1
+	return latencies[min(max(i, 0), len(latencies)-1)]
+}
+
+func (h *hedger) observe(key string, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	latencies := append(h.latencies[key], latency)
+	if len(latencies) > hedgeLatencyWindow {
+		latencies = latencies[len(latencies)-hedgeLatencyWindow:]
+	}
+	h.latencies[key] = latencies
+}
+
+type hedgeResult struct {
+	resp    *http.Response
+	latency time.Duration
+	meta    ResponseMetadata
+	err     error
+	elapsed time.Duration
+	cancel  context.CancelFunc
+
+	// index is 0 for the first request, 1 for the hedge request.
+	index int
+}
+
+// sendHedged sends the request like sendRequest. With WithHedgedRequests, a second identical request is sent
+// if the first one hasn't answered within the hedge delay: the first success wins and the other request is canceled.
+// Both requests go through the same admission (circuit breaker and limiters), so the hedge is not counted twice.
+func (c *clientImpl) sendHedged(ctx context.Context, endpoint Endpoint, model, method, url string, body []byte) (*http.Response, time.Duration, ResponseMetadata, error) {
+	if c.hedger == nil {
+		return c.sendRequest(ctx, method, url, body)
+	}
+
+	key := string(endpoint) + " " + model
+	results := make(chan hedgeResult, 2)
+	var cancels [2]context.CancelFunc
+	launch := func(index int) {
+		reqCtx, cancel := context.WithCancel(ctx)
+		cancels[index] = cancel
+		go func() {
+			t0 := time.Now()
+			resp, lat, meta, err := c.sendRequest(reqCtx, method, url, body)
+			results <- hedgeResult{resp: resp, latency: lat, meta: meta, err: err, elapsed: time.Since(t0), cancel: cancel, index: index}
+		}()
+	}
+
+	delay := c.hedger.delay(key)
+	launch(0)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	inFlight, hedged := 1, false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if c.verbose {
+				logger.Printf("No response after %v, sending a hedge request to %s", delay, url)
+			}
+			hedged = true
+			inFlight++
+			launch(1)
+
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				c.hedger.observe(key, r.elapsed)
+				if inFlight > 0 {
+					cancels[1-r.index]()
+					go discardHedgeLoser(results)
+				}
+				r.meta.Hedged = r.index == 1
+				// The request context is canceled once the body is closed
+				r.resp.Body = &closeHook{ReadCloser: r.resp.Body, hook: r.cancel}
+				return r.resp, r.latency, r.meta, nil
+			}
+
+			r.cancel()
+			if !hedged {
+				// Don't hedge a request which already failed after its retries
+				return nil, 0, ResponseMetadata{}, r.err
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if inFlight == 0 {
+				return nil, 0, ResponseMetadata{}, firstErr
+			}
+		}
+	}
+}
+
+// discardHedgeLoser releases the response of the request which lost the race.
+func discardHedgeLoser(results <-chan hedgeResult) {
+	r := <-results
+	if r.resp != nil {
+		r.resp.Body.Close() //nolint:errcheck
+	}
+}
+
+// closeHook calls the hook once the body is closed.
+type closeHook struct {
+	io.ReadCloser
+	hook func()
+	once sync.Once
+}
+
+func (b *closeHook) Close() error {
+	defer b.once.Do(b.hook)
+	return b.ReadCloser.Close()
+}
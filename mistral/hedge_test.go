@@ -0,0 +1,106 @@
+package mistral_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// makeSlowFirstServer makes the first request hang until it is canceled, and answers the next ones immediately.
+func makeSlowFirstServer(t *testing.T, calls, canceled *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Read the body, so that the server notices when the client goes away
+		_, _ = io.ReadAll(r.Body)
+		if atomic.AddInt32(calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(canceled, 1)
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}],
+			"data": [{"embedding": [0.1, 0.2]}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 8, "total_tokens": 20}}`))
+	}))
+}
+
+func TestClient_HedgedRequests(t *testing.T) {
+	ctx := context.Background()
+	inputMsgs := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	t.Run("should send a hedge request when the first one is slow", func(t *testing.T) {
+		// Given
+		var calls, canceled int32
+		srv := makeSlowFirstServer(t, &calls, &canceled)
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithHedgedRequests(0.95, 50*time.Millisecond))
+
+		// When
+		start := time.Now()
+		res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+		elapsed := time.Since(start)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello", res.AssistantMessage().Content().String())
+		assert.True(t, res.Metadata.Hedged)
+		assert.Less(t, elapsed, 2*time.Second)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&canceled) == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should not send a hedge request when the first one is fast", func(t *testing.T) {
+		// Given
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+		}))
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithHedgedRequests(0.95, time.Second))
+
+		// When
+		res, err := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))
+
+		// Then
+		assert.NoError(t, err)
+		assert.False(t, res.Metadata.Hedged)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("should not count nor cache the hedge request twice", func(t *testing.T) {
+		// Given
+		var calls, canceled int32
+		srv := makeSlowFirstServer(t, &calls, &canceled)
+		defer srv.Close()
+		limiter := mistral.NewTokenLimiter(600)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL),
+			mistral.WithHedgedRequests(0.95, 50*time.Millisecond),
+			mistral.WithTokenLimiter(limiter),
+			mistral.WithLocalCache(), mistral.WithCacheDir(t.TempDir()))
+
+		// When
+		first, err1 := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+		second, err2 := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.True(t, first.Metadata.Hedged)
+		assert.True(t, second.Metadata.FromCache)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		assert.InDelta(t, 600-20, limiter.Available(mistral.EndpointChatCompletions, "mistral-large"), 5)
+	})
+}
@@ -0,0 +1,489 @@
+package mistral
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ContextLengthExceededError is returned by the HistoryManager, without calling the API, when the prompt still
+// exceeds the context window once the history is trimmed, for instance because the last message alone is too long.
+// It matches ErrContextLengthExceeded with errors.Is.
+type ContextLengthExceededError struct {
+	// Tokens is the number of tokens of the trimmed prompt.
+	Tokens int
+
+	// Budget is the number of tokens the prompt may use: the context length minus MaxTokens.
+	Budget int
+}
+
+func (e *ContextLengthExceededError) Error() string {
+	return fmt.Sprintf("context window exceeded: the prompt has %d tokens for a budget of %d", e.Tokens, e.Budget)
+}
+
+func (e *ContextLengthExceededError) Is(target error) bool {
+	return target == ErrContextLengthExceeded
+}
+
+// approxBudgetRatio is the share of the budget used when the tokens are counted by an approximate tokenizer,
+// to make up for its estimation error.
+const approxBudgetRatio = 0.9
+
+// HistoryBudget is the number of tokens the messages may use, given to the HistoryStrategy.
+type HistoryBudget struct {
+	// Tokens is the number of tokens the prompt may use.
+	Tokens int
+
+	count func(messages []ChatMessage) (int, error)
+}
+
+// Count returns the number of tokens of the prompt made of the messages, with the tools of the request.
+func (b HistoryBudget) Count(messages []ChatMessage) (int, error) {
+	return b.count(messages)
+}
+
+// Fits tells whether the prompt made of the messages fits in the budget.
+func (b HistoryBudget) Fits(messages []ChatMessage) (bool, error) {
+	n, err := b.count(messages)
+	return n <= b.Tokens, err
+}
+
+// HistoryStrategy chooses the messages sent when the conversation doesn't fit in the context window anymore.
+type HistoryStrategy interface {
+	// Trim returns the messages to send, which should fit in the budget.
+	// An assistant message with ToolCalls must be kept with the ToolMessage results which follow it.
+	Trim(ctx context.Context, messages []ChatMessage, budget HistoryBudget) ([]ChatMessage, error)
+}
+
+// SlidingWindow drops the oldest messages, the system messages included, until the conversation fits.
+func SlidingWindow() HistoryStrategy {
+	return slidingWindow{}
+}
+
+type slidingWindow struct{}
+
+func (slidingWindow) Trim(_ context.Context, messages []ChatMessage, budget HistoryBudget) ([]ChatMessage, error) {
+	groups := historyGroups(messages)
+	first, err := fitSuffix(len(groups), func(i int) []ChatMessage {
+		return flatten(groups[i:])
+	}, budget, 0)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(groups[first:]), nil
+}
+
+// KeepSystemAndLastN keeps the system messages, at their position, and, at most, the last n other messages.
+// Older messages are dropped further if the conversation still doesn't fit.
+// Fewer messages are kept rather than splitting a tool call from its results.
+func KeepSystemAndLastN(n int) HistoryStrategy {
+	return keepSystemAndLastN{n: n}
+}
+
+type keepSystemAndLastN struct {
+	n int
+}
+
+func (s keepSystemAndLastN) Trim(_ context.Context, messages []ChatMessage, budget HistoryBudget) ([]ChatMessage, error) {
+	groups := historyGroups(messages)
+	droppable := droppableGroups(groups)
+	if len(droppable) == 0 {
+		return messages, nil
+	}
+	first, kept := len(droppable)-1, len(groups[droppable[len(droppable)-1]])
+	for first > 0 && kept+len(groups[droppable[first-1]]) <= s.n {
+		first--
+		kept += len(groups[droppable[first]])
+	}
+
+	more, err := fitSuffix(len(droppable)-first, func(i int) []ChatMessage {
+		return keepGroups(groups, droppable, first+i)
+	}, budget, 0)
+	if err != nil {
+		return nil, err
+	}
+	return keepGroups(groups, droppable, first+more), nil
+}
+
+// summaryPrompt is the instruction given to the model summarizing the history.
+const summaryPrompt = "Summarize the following conversation between a user and an assistant. " +
+	"Keep the facts, the decisions and the open questions needed to go on with it. Answer with the summary only."
+
+// summaryPrefix introduces the summary in the system message replacing the oldest messages.
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// SummarizeHistory replaces the oldest messages with a summary, written by the given model, which should be cheaper
+// than the model of the conversation. The summary is sent as a system message in place of the oldest message,
+// and is kept to maxTokens tokens. The system messages are kept at their position.
+//
+// The last summary is remembered: when the conversation grows, only the messages dropped since are summarized,
+// with the previous summary.
+func SummarizeHistory(client Client, model string, maxTokens int) HistoryStrategy {
+	return &summarizeHistory{client: client, model: model, maxTokens: maxTokens}
+}
+
+type summarizeHistory struct {
+	client    Client
+	model     string
+	maxTokens int
+
+	mu          sync.Mutex
+	summarized  int
+	fingerprint [sha256.Size]byte
+	summary     string
+}
+
+func (s *summarizeHistory) Trim(ctx context.Context, messages []ChatMessage, budget HistoryBudget) ([]ChatMessage, error) {
+	groups := historyGroups(messages)
+	droppable := droppableGroups(groups)
+	first, err := fitSuffix(len(droppable), func(i int) []ChatMessage {
+		return keepGroups(groups, droppable, i)
+	}, budget, s.maxTokens+summaryOverhead)
+	if err != nil {
+		return nil, err
+	}
+	if first == 0 {
+		return messages, nil
+	}
+
+	var dropped []ChatMessage
+	for _, i := range droppable[:first] {
+		dropped = append(dropped, groups[i]...)
+	}
+	summary, err := s.summarize(ctx, dropped)
+	if err != nil {
+		return nil, err
+	}
+
+	// The summary takes the place of the oldest message
+	var summarized [][]ChatMessage
+	for i, group := range groups {
+		if i == droppable[0] {
+			summarized = append(summarized, []ChatMessage{NewSystemMessageFromString(summaryPrefix + summary)})
+		}
+		if isSystemGroup(group) || (first < len(droppable) && i >= droppable[first]) {
+			summarized = append(summarized, group)
+		}
+	}
+
+	// The summary may be longer than expected
+	groups, droppable = summarized, droppableGroups(summarized)
+	first, err = fitSuffix(len(droppable), func(i int) []ChatMessage {
+		return keepGroups(groups, droppable, i)
+	}, budget, 0)
+	if err != nil {
+		return nil, err
+	}
+	return keepGroups(groups, droppable, first), nil
+}
+
+// summaryOverhead is the number of tokens of the summary message beyond the summary itself.
+const summaryOverhead = 16
+
+// summarize returns the summary of the messages, starting from the last summary if it covers their beginning.
+func (s *summarizeHistory) summarize(ctx context.Context, messages []ChatMessage) (string, error) {
+	s.mu.Lock()
+	previous, from := "", 0
+	if s.summarized > 0 && s.summarized <= len(messages) {
+		if fp, err := fingerprint(messages[:s.summarized]); err == nil && fp == s.fingerprint {
+			previous, from = s.summary, s.summarized
+		}
+	}
+	s.mu.Unlock()
+
+	if from == len(messages) {
+		return previous, nil
+	}
+
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString(summaryPrefix + previous + "\n\n")
+	}
+	writeTranscript(&transcript, messages[from:])
+
+	req := NewChatCompletionRequest(s.model, []ChatMessage{
+		NewSystemMessageFromString(summaryPrompt),
+		NewUserMessageFromString(transcript.String()),
+	})
+	req.MaxTokens = s.maxTokens
+	res, err := s.client.ChatCompletion(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize the history: %w", err)
+	}
+	msg := res.AssistantMessage()
+	if msg == nil {
+		return "", errors.New("failed to summarize the history: no answer")
+	}
+	summary := contentText(msg.Content())
+
+	if fp, err := fingerprint(messages); err == nil {
+		s.mu.Lock()
+		s.summarized, s.fingerprint, s.summary = len(messages), fp, summary
+		s.mu.Unlock()
+	}
+	return summary, nil
+}
+
+// writeTranscript writes the messages as plain text, one per paragraph.
+func writeTranscript(sb *strings.Builder, messages []ChatMessage) {
+	for _, msg := range messages {
+		if text := contentText(msg.Content()); text != "" {
+			sb.WriteString(string(msg.Role()) + ": " + text + "\n\n")
+		}
+		if m, ok := msg.(*AssistantMessage); ok {
+			for _, call := range m.ToolCalls {
+				args, _ := json.Marshal(call.Function.Arguments)
+				fmt.Fprintf(sb, "assistant called %s(%s)\n\n", call.Function.Name, args)
+			}
+		}
+	}
+}
+
+func fingerprint(messages []ChatMessage) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// historyGroups splits the messages into the groups which can't be separated:
+// an assistant message with tool calls and the tool results following it, or a single message.
+func historyGroups(messages []ChatMessage) [][]ChatMessage {
+	var groups [][]ChatMessage
+	for i := 0; i < len(messages); {
+		end := i + 1
+		if m, ok := messages[i].(*AssistantMessage); ok && len(m.ToolCalls) > 0 {
+			for end < len(messages) && messages[end].Role() == RoleTool {
+				end++
+			}
+		}
+		groups = append(groups, messages[i:end])
+		i = end
+	}
+	return groups
+}
+
+func isSystemGroup(group []ChatMessage) bool {
+	return group[0].Role() == RoleSystem
+}
+
+// droppableGroups returns the indexes of the groups which aren't system messages.
+func droppableGroups(groups [][]ChatMessage) []int {
+	var droppable []int
+	for i, group := range groups {
+		if !isSystemGroup(group) {
+			droppable = append(droppable, i)
+		}
+	}
+	return droppable
+}
+
+// keepGroups returns the messages of the system groups, and of the droppable groups from the first-th one,
+// in their original order.
+func keepGroups(groups [][]ChatMessage, droppable []int, first int) []ChatMessage {
+	from := len(groups)
+	if first < len(droppable) {
+		from = droppable[first]
+	}
+	var messages []ChatMessage
+	for i, group := range groups {
+		if i >= from || isSystemGroup(group) {
+			messages = append(messages, group...)
+		}
+	}
+	return messages
+}
+
+func flatten(groups [][]ChatMessage) []ChatMessage {
+	var messages []ChatMessage
+	for _, group := range groups {
+		messages = append(messages, group...)
+	}
+	return messages
+}
+
+// fitSuffix returns the number of the n droppable groups to drop so that the messages kept, returned by keep,
+// fit in the budget minus the reserved tokens. The last group is always kept.
+func fitSuffix(n int, keep func(first int) []ChatMessage, budget HistoryBudget, reserve int) (int, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	var err error
+	first := sort.Search(n-1, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var tokens int
+		tokens, err = budget.Count(keep(i))
+		return tokens+reserve <= budget.Tokens
+	})
+	return first, err
+}
+
+// HistoryManager trims the history of the chat completion requests which don't fit in the context window of their
+// model anymore, leaving room for the MaxTokens of the completion.
+type HistoryManager struct {
+	client        Client
+	strategy      HistoryStrategy
+	tokenizer     *Tokenizer
+	contextLength int
+
+	mu      sync.Mutex
+	lengths map[string]int
+}
+
+type HistoryOption func(h *HistoryManager)
+
+// WithHistoryStrategy sets the strategy choosing the messages to keep. The default one is SlidingWindow.
+func WithHistoryStrategy(strategy HistoryStrategy) HistoryOption {
+	return func(h *HistoryManager) {
+		h.strategy = strategy
+	}
+}
+
+// WithHistoryTokenizer sets the tokenizer counting the tokens of the prompts,
+// instead of the one returned by TokenizerForModel for the model of each request.
+func WithHistoryTokenizer(tokenizer *Tokenizer) HistoryOption {
+	return func(h *HistoryManager) {
+		h.tokenizer = tokenizer
+	}
+}
+
+// WithContextLength sets the context length of the models, instead of looking up their MaxContextLength.
+func WithContextLength(tokens int) HistoryOption {
+	return func(h *HistoryManager) {
+		h.contextLength = tokens
+	}
+}
+
+// NewHistoryManager returns a manager fitting the requests in the context window of their model.
+// The client looks up the MaxContextLength of the models: it may be nil when WithContextLength is set.
+//
+// When the tokenizer is approximate, only 90% of the context window is used, to make up for its estimation error.
+// Available options are:
+//   - WithHistoryStrategy
+//   - WithHistoryTokenizer
+//   - WithContextLength
+func NewHistoryManager(client Client, opts ...HistoryOption) *HistoryManager {
+	h := &HistoryManager{
+		client:   client,
+		strategy: SlidingWindow(),
+		lengths:  make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Fit returns the request if it fits in the context window of its model, or a copy of it with its messages trimmed
+// by the strategy. It returns a ContextLengthExceededError if the trimmed messages still don't fit.
+// The request is returned as is when the context length of the model is unknown.
+func (h *HistoryManager) Fit(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionRequest, error) {
+	if len(req.Messages) == 0 {
+		return req, nil
+	}
+	length, err := h.contextLengthOf(ctx, req.Model)
+	if err != nil || length == 0 {
+		return req, err
+	}
+
+	tokenizer := h.tokenizer
+	if tokenizer == nil {
+		tokenizer = TokenizerForModel(req.Model)
+	}
+	if tokenizer.Approximate() {
+		length = int(float64(length) * approxBudgetRatio)
+	}
+	budget := HistoryBudget{
+		Tokens: length - req.MaxTokens,
+		count: func(messages []ChatMessage) (int, error) {
+			return tokenizer.CountMessages(messages, req.Tools)
+		},
+	}
+
+	if fits, err := budget.Fits(req.Messages); err != nil || fits {
+		return req, err
+	}
+
+	messages, err := h.strategy.Trim(ctx, req.Messages, budget)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := budget.Count(messages)
+	if err != nil {
+		return nil, err
+	}
+	if tokens > budget.Tokens {
+		return nil, &ContextLengthExceededError{Tokens: tokens, Budget: budget.Tokens}
+	}
+
+	r := *req
+	r.Messages = messages
+	return &r, nil
+}
+
+// contextLengthOf returns the context length of the model, remembering it for the next requests.
+func (h *HistoryManager) contextLengthOf(ctx context.Context, model string) (int, error) {
+	if h.contextLength > 0 || h.client == nil {
+		return h.contextLength, nil
+	}
+
+	h.mu.Lock()
+	length, ok := h.lengths[model]
+	h.mu.Unlock()
+	if ok {
+		return length, nil
+	}
+
+	card, err := h.client.GetModel(ctx, model)
+	if err != nil {
+		if errors.Is(err, ErrModelNotFound) || errors.Is(err, ErrNotSupportedByDeployment) {
+			// The context length is unknown: let the API decide
+			err = nil
+		}
+		return 0, err
+	}
+
+	h.mu.Lock()
+	h.lengths[model] = card.MaxContextLength
+	h.mu.Unlock()
+	return card.MaxContextLength, nil
+}
+
+type historyClientDecorator struct {
+	Client
+
+	manager *HistoryManager
+}
+
+var _ Client = (*historyClientDecorator)(nil)
+
+// NewHistoryManaged decorates a client to fit the chat completion requests in the context window of their model,
+// with a HistoryManager looking up the context lengths with the client. The messages of the requests given by the
+// caller are not modified. It takes the options of NewHistoryManager.
+func NewHistoryManaged(client Client, opts ...HistoryOption) Client {
+	return &historyClientDecorator{Client: client, manager: NewHistoryManager(client, opts...)}
+}
+
+func (c *historyClientDecorator) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req, err := c.manager.Fit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.ChatCompletion(ctx, req)
+}
+
+func (c *historyClientDecorator) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (<-chan *CompletionChunk, error) {
+	req, err := c.manager.Fit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.ChatCompletionStream(ctx, req)
+}
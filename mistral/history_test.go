@@ -0,0 +1,239 @@
+package mistral_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestHistoryManager_Fit(t *testing.T) {
+	ctx := context.TODO()
+
+	// The tokenizer counts one token per byte, so that the budgets are easy to set
+	tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v7"))
+	assert.NoError(t, err)
+	count := func(messages ...mistral.ChatMessage) int {
+		n, err := tok.CountMessages(messages, nil)
+		assert.NoError(t, err)
+		return n
+	}
+
+	system := mistral.NewSystemMessageFromString("You are a weather assistant")
+	first := mistral.NewUserMessageFromString("What's the weather in Paris?")
+	call := mistral.NewAssistantMessageFromString("",
+		mistral.NewToolCall("call1", 0, "get_weather", mistral.JsonMap{"city": "Paris"}),
+		mistral.NewToolCall("call2", 1, "get_forecast", mistral.JsonMap{"city": "Paris"}))
+	result1 := mistral.NewToolMessage("get_weather", "call1", mistral.ContentString("sunny"))
+	result2 := mistral.NewToolMessage("get_forecast", "call2", mistral.ContentString("rainy tomorrow"))
+	answer := mistral.NewAssistantMessageFromString("It's sunny, and it will rain tomorrow.")
+	last := mistral.NewUserMessageFromString("And in Lyon?")
+	messages := []mistral.ChatMessage{system, first, call, result1, result2, answer, last}
+
+	t.Run("should return the request when it fits", func(t *testing.T) {
+		// Given
+		h := mistral.NewHistoryManager(nil, mistral.WithHistoryTokenizer(tok), mistral.WithContextLength(count(messages...)+100))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", messages)
+		req.MaxTokens = 100
+
+		// When
+		res, err := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Same(t, req, res)
+	})
+
+	t.Run("should drop the oldest messages with a sliding window", func(t *testing.T) {
+		// Given
+		h := mistral.NewHistoryManager(nil, mistral.WithHistoryTokenizer(tok), mistral.WithContextLength(count(answer, last)+100))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", messages)
+		req.MaxTokens = 100
+
+		// When
+		res, err := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.ChatMessage{answer, last}, res.Messages)
+		assert.Len(t, req.Messages, len(messages), "the request of the caller must not be modified")
+	})
+
+	t.Run("should not split the tool calls from their results", func(t *testing.T) {
+		// Given
+		h := mistral.NewHistoryManager(nil, mistral.WithHistoryTokenizer(tok),
+			mistral.WithContextLength(count(result1, result2, answer, last)))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", messages)
+
+		// When
+		res, err := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.ChatMessage{answer, last}, res.Messages)
+	})
+
+	t.Run("should keep the system messages and the last messages", func(t *testing.T) {
+		// Given
+		h := mistral.NewHistoryManager(nil,
+			mistral.WithHistoryTokenizer(tok),
+			mistral.WithHistoryStrategy(mistral.KeepSystemAndLastN(4)),
+			mistral.WithContextLength(count(messages...)-1))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", messages)
+
+		// When
+		res, err := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.ChatMessage{system, answer, last}, res.Messages,
+			"the tool call group doesn't fit in the last 4 messages")
+	})
+
+	t.Run("should replace the oldest messages with a summary", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+				assert.Equal(t, "mistral-small-latest", req.Model)
+				assert.Equal(t, 20, req.MaxTokens)
+				transcript := req.Messages[1].Content().String()
+				assert.Contains(t, transcript, "user: What's the weather in Paris?")
+				assert.Contains(t, transcript, `assistant called get_weather({"city":"Paris"})`)
+				return &mistral.ChatCompletionResponse{
+					Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Paris")}},
+				}, nil
+			}).
+			Times(1)
+
+		summary := mistral.NewSystemMessageFromString("Summary of the earlier conversation:\nParis")
+		h := mistral.NewHistoryManager(nil,
+			mistral.WithHistoryTokenizer(tok),
+			mistral.WithHistoryStrategy(mistral.SummarizeHistory(mockClient, "mistral-small-latest", 20)),
+			mistral.WithContextLength(count(system, summary, answer, last)+20))
+		req := mistral.NewChatCompletionRequest("mistral-large-latest", messages)
+
+		// When
+		res, err := h.Fit(ctx, req)
+		again, errAgain := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.ChatMessage{system, summary, answer, last}, res.Messages)
+		assert.NoError(t, errAgain)
+		assert.Equal(t, res.Messages, again.Messages, "the summary must be reused")
+	})
+
+	t.Run("should keep the system messages at their position", func(t *testing.T) {
+		// Given
+		reminder := mistral.NewSystemMessageFromString("Answer in French")
+		conversation := []mistral.ChatMessage{system, first, answer, reminder, last}
+		h := mistral.NewHistoryManager(nil,
+			mistral.WithHistoryTokenizer(tok),
+			mistral.WithHistoryStrategy(mistral.KeepSystemAndLastN(2)),
+			mistral.WithContextLength(count(conversation...)+100))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", conversation)
+		req.MaxTokens = 101
+
+		// When
+		res, err := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.ChatMessage{system, answer, reminder, last}, res.Messages)
+	})
+
+	t.Run("should keep the system messages at their position with a summary", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			Return(&mistral.ChatCompletionResponse{
+				Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Paris")}},
+			}, nil).
+			Times(1)
+
+		reminder := mistral.NewSystemMessageFromString("Answer in French")
+		summary := mistral.NewSystemMessageFromString("Summary of the earlier conversation:\nParis")
+		h := mistral.NewHistoryManager(nil,
+			mistral.WithHistoryTokenizer(tok),
+			mistral.WithHistoryStrategy(mistral.SummarizeHistory(mockClient, "mistral-small-latest", 20)),
+			mistral.WithContextLength(count(system, summary, answer, reminder, last)))
+		req := mistral.NewChatCompletionRequest("mistral-large-latest",
+			[]mistral.ChatMessage{system, first, call, result1, result2, answer, reminder, last})
+
+		// When
+		res, err := h.Fit(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, []mistral.ChatMessage{system, summary, answer, reminder, last}, res.Messages)
+	})
+
+	t.Run("should fail when the last message doesn't fit", func(t *testing.T) {
+		// Given
+		h := mistral.NewHistoryManager(nil, mistral.WithHistoryTokenizer(tok), mistral.WithContextLength(100))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", []mistral.ChatMessage{
+			first,
+			mistral.NewUserMessageFromString(strings.Repeat("a", 200)),
+		})
+
+		// When
+		_, err := h.Fit(ctx, req)
+
+		// Then
+		assert.ErrorIs(t, err, mistral.ErrContextLengthExceeded)
+		var exceeded *mistral.ContextLengthExceededError
+		assert.ErrorAs(t, err, &exceeded)
+		assert.Equal(t, 100, exceeded.Budget)
+	})
+}
+
+func TestNewHistoryManaged(t *testing.T) {
+	t.Run("should fit the requests in the context length of the model", func(t *testing.T) {
+		// Given
+		ctx := context.TODO()
+		tok := mistral.NewApproximateTokenizer(mistral.TokenizerV7)
+		messages := []mistral.ChatMessage{
+			mistral.NewUserMessageFromString(strings.Repeat("Tell me a long story. ", 100)),
+			mistral.NewAssistantMessageFromString(strings.Repeat("Once upon a time. ", 100)),
+			mistral.NewUserMessageFromString("Shorter, please."),
+		}
+		lastTokens, err := tok.CountMessages(messages[2:], nil)
+		assert.NoError(t, err)
+
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			GetModel(gomock.Any(), "mistral-small-latest").
+			Return(&mistral.BaseModelCard{Id: "mistral-small-latest", MaxContextLength: lastTokens * 2}, nil).
+			Times(1)
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+				assert.Equal(t, messages[2:], req.Messages)
+				return &mistral.ChatCompletionResponse{
+					Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Fine.")}},
+				}, nil
+			}).
+			Times(2)
+		c := mistral.NewHistoryManaged(mockClient)
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", messages)
+
+		// When
+		_, err = c.ChatCompletion(ctx, req)
+		_, errAgain := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.NoError(t, errAgain)
+		assert.Len(t, req.Messages, 3, "the request of the caller must not be modified")
+	})
+}
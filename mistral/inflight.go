@@ -0,0 +1,208 @@
+package mistral
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// flightCall is an in-flight or completed flightGroup.Do call.
+type flightCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// flightGroup coalesces concurrent calls sharing the same key so that only one of them
+// actually runs, the others waiting for its result.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+// Do executes fn for the given key, making sure only one execution is in-flight at a time.
+// If a call for the same key is already running, Do waits for it and returns its result instead.
+//
+// fn runs with a context which is not canceled with the one of the caller starting it, so that the callers
+// sharing its result don't fail when that first caller gives up. Every caller, the first one included,
+// stops waiting when its own context is done, but the call goes on.
+func (g *flightGroup[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[T])
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &flightCall[T]{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(context.WithoutCancel(ctx), key, call, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (g *flightGroup[T]) run(ctx context.Context, key string, call *flightCall[T], fn func(ctx context.Context) (T, error)) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.val, call.err = fn(ctx)
+}
+
+// chunkFanOut broadcasts a single stream of completion chunks to many subscribers.
+// Every chunk published is kept so late subscribers receive the whole stream from the start.
+type chunkFanOut struct {
+	mu     sync.Mutex
+	chunks []*CompletionChunk
+	closed bool
+	notify chan struct{}
+
+	// delays, when set, are the times to wait before sending each chunk to replay them with their original pacing.
+	delays []time.Duration
+}
+
+func newChunkFanOut() *chunkFanOut {
+	return &chunkFanOut{notify: make(chan struct{})}
+}
+
+// newClosedChunkFanOut creates an already completed fan-out replaying the given chunks.
+func newClosedChunkFanOut(chunks []*CompletionChunk) *chunkFanOut {
+	f := newChunkFanOut()
+	f.chunks = chunks
+	f.close()
+	return f
+}
+
+func (f *chunkFanOut) publish(chunk *CompletionChunk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunks = append(f.chunks, chunk)
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+func (f *chunkFanOut) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.notify)
+}
+
+// subscribe returns a channel receiving a copy of all the chunks published so far, then of the next ones.
+// The channel is closed once the fan-out is closed or the context is done.
+// If speed is positive and the fan-out has delays, each chunk is sent after its delay divided by speed.
+func (f *chunkFanOut) subscribe(ctx context.Context, speed float64) <-chan *CompletionChunk {
+	out := make(chan *CompletionChunk)
+
+	go func() {
+		defer close(out)
+		i := 0
+		for {
+			f.mu.Lock()
+			if i < len(f.chunks) {
+				chunk := f.chunks[i]
+				var delay time.Duration
+				if speed > 0 && i < len(f.delays) {
+					delay = time.Duration(float64(f.delays[i]) / speed)
+				}
+				f.mu.Unlock()
+				i++
+				if delay > 0 {
+					timer := time.NewTimer(delay)
+					select {
+					case <-timer.C:
+					case <-ctx.Done():
+						timer.Stop()
+						return
+					}
+				}
+				select {
+				case out <- copyCompletionChunk(chunk):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			if f.closed {
+				f.mu.Unlock()
+				return
+			}
+			notify := f.notify
+			f.mu.Unlock()
+
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// The results shared by coalesced calls are copied for each caller, so that a caller modifying its result,
+// for instance its Metadata, doesn't change the result of the others.
+
+func copyChatCompletionResponse(res *ChatCompletionResponse) *ChatCompletionResponse {
+	if res == nil {
+		return nil
+	}
+	cp := *res
+	cp.Choices = slices.Clone(res.Choices)
+	for i, choice := range cp.Choices {
+		if choice.Message != nil {
+			msg := *choice.Message
+			cp.Choices[i].Message = &msg
+		}
+	}
+	cp.Usage = copyUsage(res.Usage)
+	return &cp
+}
+
+func copyCompletionChunk(chunk *CompletionChunk) *CompletionChunk {
+	if chunk == nil {
+		return nil
+	}
+	cp := *chunk
+	cp.Choices = slices.Clone(chunk.Choices)
+	for i, choice := range cp.Choices {
+		if choice.Delta != nil {
+			delta := *choice.Delta
+			cp.Choices[i].Delta = &delta
+		}
+	}
+	cp.Usage = copyUsage(chunk.Usage)
+	return &cp
+}
+
+func copyEmbeddingResponse(res *EmbeddingResponse) *EmbeddingResponse {
+	if res == nil {
+		return nil
+	}
+	cp := *res
+	cp.Data = slices.Clone(res.Data)
+	return &cp
+}
+
+func copyUsage(usage *UsageInfo) *UsageInfo {
+	if usage == nil {
+		return nil
+	}
+	cp := *usage
+	return &cp
+}
@@ -13,3 +13,20 @@ type Engine interface {
 	Get(ctx context.Context, key string) ([]byte, error)
 	Set(ctx context.Context, key string, data []byte) error
 }
+
+// Lister is implemented by the engines able to enumerate and remove their entries.
+type Lister interface {
+	Engine
+
+	// Keys returns the keys of all the stored entries.
+	Keys(ctx context.Context) ([]string, error)
+
+	// Delete removes the entry stored with the given key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Migrator is implemented by the engines able to upgrade the layout of the entries written by previous versions.
+type Migrator interface {
+	// Migrate upgrades the stored entries and returns how many were migrated.
+	Migrate(ctx context.Context) (int, error)
+}
@@ -1,38 +1,366 @@
 package cache
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm used to compress the entries stored on the file system.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
 )
 
+const (
+	jsonExt     = ".json"
+	gzipExt     = ".json.gz"
+	zstdExt     = ".json.zst"
+	tmpPrefix   = ".tmp-"
+	lockName    = ".lock"
+	shardLength = 2
+)
+
+// LocalFsOption configures the local file system engine.
+type LocalFsOption func(e *localFsEngine)
+
+// WithCompression compresses the entries written from now on with the given algorithm.
+// Entries written with another compression remain readable.
+func WithCompression(c Compression) LocalFsOption {
+	return func(e *localFsEngine) {
+		e.compression = c
+	}
+}
+
+// localFsEngine stores each entry in its own file, sharded in two levels of directories
+// named after the first characters of the key: <cacheDir>/ab/cd/abcd....json
+//
+// Entries are written to a temporary file renamed once complete, so a crash never leaves a truncated entry.
+// Writes are serialized with a lock file, shared by all the processes using the same directory.
+// Entries written by the previous flat layout (<cacheDir>/<key>.json) are still read, and can be moved
+// to the sharded layout with Migrate.
 type localFsEngine struct {
-	cacheDir string
+	cacheDir    string
+	compression Compression
+
+	mu sync.Mutex
 }
 
-func NewLocalFsEngine(cacheDir string) (Engine, error) {
+var _ Lister = (*localFsEngine)(nil)
+var _ Migrator = (*localFsEngine)(nil)
+
+func NewLocalFsEngine(cacheDir string, opts ...LocalFsOption) (Lister, error) {
 	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("cache dir creation failed: %w", err)
 	}
-	return &localFsEngine{cacheDir: cacheDir}, nil
+
+	e := &localFsEngine{cacheDir: cacheDir}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if _, ok := compressionExts[e.compression]; !ok {
+		return nil, fmt.Errorf("unsupported cache compression: %q", e.compression)
+	}
+
+	return e, nil
 }
 
 func (e *localFsEngine) Get(ctx context.Context, key string) ([]byte, error) {
-	data, err := os.ReadFile(filepath.Join(e.cacheDir, key+".json"))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrCacheMiss
+	for _, path := range e.candidatePaths(key) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read cache file: %w", err)
 		}
-		return nil, fmt.Errorf("failed to read cache file: %w", err)
+		return decompress(path, data)
 	}
-	return data, nil
+	return nil, ErrCacheMiss
 }
 
 func (e *localFsEngine) Set(ctx context.Context, key string, data []byte) error {
-	err := os.WriteFile(filepath.Join(e.cacheDir, key+".json"), data, 0644)
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return e.write(key, data)
+}
+
+func (e *localFsEngine) Keys(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	err := filepath.WalkDir(e.cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if key, ok := keyFromFileName(d.Name()); ok {
+			seen[key] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache dir: %w", err)
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (e *localFsEngine) Delete(ctx context.Context, key string) error {
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return e.remove(key, "")
+}
+
+// Migrate moves the entries of the previous flat layout to the sharded one,
+// compressing them if a compression is configured. It returns the number of migrated entries.
+func (e *localFsEngine) Migrate(ctx context.Context) (int, error) {
+	unlock, err := e.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(e.cacheDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache dir: %w", err)
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		key, ok := keyFromFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		legacyPath := filepath.Join(e.cacheDir, entry.Name())
+		data, err := os.ReadFile(legacyPath)
+		if err != nil {
+			return count, fmt.Errorf("failed to read cache file: %w", err)
+		}
+		if data, err = decompress(legacyPath, data); err != nil {
+			return count, err
+		}
+		if err := e.write(key, data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// write stores the entry atomically, the lock being held by the caller.
+func (e *localFsEngine) write(key string, data []byte) error {
+	dir := e.shardDir(key)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create cache shard dir: %w", err)
+	}
+
+	ext := compressionExts[e.compression]
+	data, err := compress(e.compression, data)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, tmpPrefix+"*")
 	if err != nil {
 		return fmt.Errorf("failed to write cache file: %w", err)
 	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close() //nolint:errcheck
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	finalPath := filepath.Join(dir, key+ext)
+	if err := os.Rename(tmpName, finalPath); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	// Remove the other versions of the entry so they are never read again
+	return e.remove(key, finalPath)
+}
+
+// remove deletes every file storing the entry, except the one to keep.
+func (e *localFsEngine) remove(key, keep string) error {
+	for _, path := range e.candidatePaths(key) {
+		if path == keep {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete cache file: %w", err)
+		}
+	}
 	return nil
 }
+
+// candidatePaths lists the files which may store the entry, the preferred one first.
+func (e *localFsEngine) candidatePaths(key string) []string {
+	dir := e.shardDir(key)
+	preferred := compressionExts[e.compression]
+	paths := []string{filepath.Join(dir, key+preferred)}
+	for _, ext := range entryExts {
+		if ext != preferred {
+			paths = append(paths, filepath.Join(dir, key+ext))
+		}
+	}
+	for _, ext := range entryExts {
+		paths = append(paths, filepath.Join(e.cacheDir, key+ext))
+	}
+	return paths
+}
+
+func (e *localFsEngine) shardDir(key string) string {
+	if len(key) < 2*shardLength {
+		return filepath.Join(e.cacheDir, "_")
+	}
+	return filepath.Join(e.cacheDir, key[:shardLength], key[shardLength:2*shardLength])
+}
+
+// lock serializes the writes between goroutines and, where supported, between processes.
+func (e *localFsEngine) lock() (func(), error) {
+	e.mu.Lock()
+
+	f, err := os.OpenFile(filepath.Join(e.cacheDir, lockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("failed to open cache lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close() //nolint:errcheck
+		e.mu.Unlock()
+		return nil, fmt.Errorf("failed to lock cache: %w", err)
+	}
+
+	return func() {
+		unlockFile(f) //nolint:errcheck
+		f.Close()     //nolint:errcheck
+		e.mu.Unlock()
+	}, nil
+}
+
+func keyFromFileName(name string) (string, bool) {
+	if strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	for _, ext := range entryExts {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+	return "", false
+}
+
+// compressionExts are the file extensions of the entries for each compression.
+var compressionExts = map[Compression]string{
+	CompressionNone: jsonExt,
+	CompressionGzip: gzipExt,
+	CompressionZstd: zstdExt,
+}
+
+// entryExts are the file extensions of the entries, whatever their compression.
+var entryExts = []string{jsonExt, gzipExt, zstdExt}
+
+// The zstd encoder and decoder are safe for concurrent use with EncodeAll and DecodeAll.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		return gzipData(data)
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return data, nil
+	}
+}
+
+// decompress decodes the content of the entry file, according to its extension.
+func decompress(path string, data []byte) ([]byte, error) {
+	switch {
+	case strings.HasSuffix(path, gzipExt):
+		return gunzip(data)
+	case strings.HasSuffix(path, zstdExt):
+		res, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress cache entry: %w", err)
+		}
+		return res, nil
+	default:
+		return data, nil
+	}
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress cache entry: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress cache entry: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cache entry: %w", err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	res, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cache entry: %w", err)
+	}
+	return res, nil
+}
@@ -2,8 +2,10 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,8 +27,8 @@ func TestLocalFsEngine(t *testing.T) {
 		err := engine.Set(ctx, key, data)
 		assert.NoError(t, err)
 
-		// Check if file exists with .json extension
-		expectedFile := filepath.Join(cacheDir, key+".json")
+		// Check if file exists with .json extension in its shard directory
+		expectedFile := filepath.Join(cacheDir, "te", "st", key+".json")
 		assert.FileExists(t, expectedFile)
 
 		received, err := engine.Get(ctx, key)
@@ -34,16 +36,206 @@ func TestLocalFsEngine(t *testing.T) {
 		assert.Equal(t, data, received)
 	})
 
+	t.Run("Set overwrites and leaves no temporary file", func(t *testing.T) {
+		assert.NoError(t, engine.Set(ctx, key, []byte("first")))
+		assert.NoError(t, engine.Set(ctx, key, data))
+
+		files, err := os.ReadDir(filepath.Join(cacheDir, "te", "st"))
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+
+		received, err := engine.Get(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+	})
+
 	t.Run("Get Cache Miss", func(t *testing.T) {
 		received, err := engine.Get(ctx, "non-existent")
 		assert.ErrorIs(t, err, ErrCacheMiss)
 		assert.Nil(t, received)
 	})
 
+	t.Run("Keys and Delete", func(t *testing.T) {
+		dir := t.TempDir()
+		engine, err := NewLocalFsEngine(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, engine.Set(ctx, "b", data))
+		assert.NoError(t, engine.Set(ctx, "a", data))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "not-an-entry.txt"), data, 0644))
+
+		keys, err := engine.Keys(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, keys)
+
+		assert.NoError(t, engine.Delete(ctx, "a"))
+		assert.NoError(t, engine.Delete(ctx, "non-existent"))
+
+		keys, err = engine.Keys(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b"}, keys)
+	})
+
 	t.Run("NewLocalFsEngine creates dir", func(t *testing.T) {
 		newDir := filepath.Join(cacheDir, "nested", "cache")
 		_, err := NewLocalFsEngine(newDir)
 		assert.NoError(t, err)
 		assert.DirExists(t, newDir)
 	})
+
+	t.Run("NewLocalFsEngine rejects unknown compression", func(t *testing.T) {
+		_, err := NewLocalFsEngine(t.TempDir(), WithCompression("lz4"))
+		assert.Error(t, err)
+	})
+}
+
+func TestLocalFsEngine_Compression(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := []byte(`{"some": "json"}`)
+
+	t.Run("should write and read gzipped entries", func(t *testing.T) {
+		engine, err := NewLocalFsEngine(dir, WithCompression(CompressionGzip))
+		assert.NoError(t, err)
+
+		assert.NoError(t, engine.Set(ctx, "abcdef", data))
+		assert.FileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json.gz"))
+
+		received, err := engine.Get(ctx, "abcdef")
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+	})
+
+	t.Run("should read entries written with another compression", func(t *testing.T) {
+		engine, err := NewLocalFsEngine(dir)
+		assert.NoError(t, err)
+
+		received, err := engine.Get(ctx, "abcdef")
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+
+		// Rewriting it removes the compressed version
+		assert.NoError(t, engine.Set(ctx, "abcdef", data))
+		assert.FileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json"))
+		assert.NoFileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json.gz"))
+	})
+
+	t.Run("should write and read zstd entries", func(t *testing.T) {
+		engine, err := NewLocalFsEngine(dir, WithCompression(CompressionZstd))
+		assert.NoError(t, err)
+
+		assert.NoError(t, engine.Set(ctx, "abcdef", data))
+		assert.FileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json.zst"))
+		assert.NoFileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json"))
+
+		received, err := engine.Get(ctx, "abcdef")
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+
+		keys, err := engine.Keys(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"abcdef"}, keys)
+	})
+
+	t.Run("should read zstd entries with another compression", func(t *testing.T) {
+		engine, err := NewLocalFsEngine(dir, WithCompression(CompressionGzip))
+		assert.NoError(t, err)
+
+		received, err := engine.Get(ctx, "abcdef")
+		assert.NoError(t, err)
+		assert.Equal(t, data, received)
+	})
+}
+
+func TestLocalFsEngine_Migrate(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := []byte(`{"some": "json"}`)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "abcdef.json"), data, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "012345.json"), data, 0644))
+
+	engine, err := NewLocalFsEngine(dir, WithCompression(CompressionGzip))
+	assert.NoError(t, err)
+
+	// Legacy entries are readable before migration
+	received, err := engine.Get(ctx, "abcdef")
+	assert.NoError(t, err)
+	assert.Equal(t, data, received)
+
+	// When
+	n, err := engine.(Migrator).Migrate(ctx)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoFileExists(t, filepath.Join(dir, "abcdef.json"))
+	assert.FileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json.gz"))
+	assert.FileExists(t, filepath.Join(dir, "01", "23", "012345.json.gz"))
+
+	keys, err := engine.Keys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"012345", "abcdef"}, keys)
+
+	received, err = engine.Get(ctx, "abcdef")
+	assert.NoError(t, err)
+	assert.Equal(t, data, received)
+}
+
+func TestLocalFsEngine_MigrateZstd(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := []byte(`{"some": "json"}`)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "abcdef.json"), data, 0644))
+
+	engine, err := NewLocalFsEngine(dir, WithCompression(CompressionZstd))
+	assert.NoError(t, err)
+
+	// When
+	n, err := engine.(Migrator).Migrate(ctx)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoFileExists(t, filepath.Join(dir, "abcdef.json"))
+	assert.FileExists(t, filepath.Join(dir, "ab", "cd", "abcdef.json.zst"))
+
+	received, err := engine.Get(ctx, "abcdef")
+	assert.NoError(t, err)
+	assert.Equal(t, data, received)
+}
+
+func TestLocalFsEngine_ConcurrentWriters(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Two engines on the same directory, as two processes would do
+	engines := make([]Lister, 2)
+	for i := range engines {
+		e, err := NewLocalFsEngine(dir)
+		assert.NoError(t, err)
+		engines[i] = e
+	}
+
+	// When
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := []byte(fmt.Sprintf(`{"writer": %d, "padding": "%0512d"}`, i, i))
+			assert.NoError(t, engines[i%2].Set(ctx, "same-key", payload))
+		}(i)
+	}
+	wg.Wait()
+
+	// Then
+	received, err := engines[0].Get(ctx, "same-key")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\{"writer": \d+, "padding": "\d{512}"\}$`, string(received))
+
+	files, err := os.ReadDir(filepath.Join(dir, "sa", "me"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
 }
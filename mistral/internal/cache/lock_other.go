@@ -0,0 +1,15 @@
+//go:build !unix
+
+package cache
+
+import "os"
+
+// On platforms without flock, writes are only serialized within the current process.
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,290 @@
+package mistral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultKeyCooldown = time.Minute
+
+// ErrNoApiKeyAvailable matches the errors of the calls made while all the keys of the pool are sidelined
+// (see NoApiKeyAvailableError).
+var ErrNoApiKeyAvailable = errors.New("no API key available")
+
+// NoApiKeyAvailableError is returned, without calling the API, when all the keys of the KeyPool are sidelined.
+// It matches ErrNoApiKeyAvailable with errors.Is.
+type NoApiKeyAvailableError struct {
+	// RetryIn is the time left before a key is back in the pool.
+	RetryIn time.Duration
+}
+
+func (e *NoApiKeyAvailableError) Error() string {
+	return fmt.Sprintf("no API key available, retry in %v", e.RetryIn.Round(time.Millisecond))
+}
+
+func (e *NoApiKeyAvailableError) Is(target error) bool {
+	return target == ErrNoApiKeyAvailable
+}
+
+// Retryable returns true: the call may succeed once a key is back in the pool.
+func (e *NoApiKeyAvailableError) Retryable() bool {
+	return true
+}
+
+// KeyPoolStrategy tells how a KeyPool chooses the key of each request.
+type KeyPoolStrategy int
+
+const (
+	// KeyPoolRoundRobin uses the keys in turn.
+	KeyPoolRoundRobin KeyPoolStrategy = iota
+
+	// KeyPoolLeastLoaded uses the key with the fewest requests in flight, in turn among the equally loaded ones.
+	KeyPoolLeastLoaded
+)
+
+func (s KeyPoolStrategy) String() string {
+	switch s {
+	case KeyPoolRoundRobin:
+		return "round-robin"
+	case KeyPoolLeastLoaded:
+		return "least-loaded"
+	default:
+		return fmt.Sprintf("KeyPoolStrategy(%d)", int(s))
+	}
+}
+
+// KeyUsage is the usage of a key of a KeyPool.
+type KeyUsage struct {
+	// Key is the masked key: only its last 4 characters are shown.
+	Key string
+
+	// Requests is the number of HTTP requests sent with the key, retries included.
+	Requests int
+
+	// InFlight is the number of requests whose response has not been fully read yet.
+	InFlight int
+
+	// Errors is the number of requests which failed: network errors and non-200 responses.
+	Errors int
+
+	// Unauthorized is the number of requests rejected with a 401 status code.
+	Unauthorized int
+
+	// RateLimited is the number of requests rejected with a 429 status code.
+	RateLimited int
+
+	// SidelinedUntil is the end of the cooldown of the key, or the zero time if it is in the pool.
+	SidelinedUntil time.Time
+
+	// RateLimit is the last rate-limit quota reported for the key, or nil if none was.
+	RateLimit *RateLimitState
+}
+
+type pooledKey struct {
+	pool  *KeyPool
+	value string
+	usage KeyUsage
+}
+
+// KeyPool spreads the requests of a client over several API keys, for instance workspace keys with separate quotas.
+// It is a CredentialProvider. The keys are sent in the header of the deployment of the client: api-key for Azure
+// deployments, "Authorization: Bearer" otherwise.
+//
+// A key rejected with a 401 or 429 status code is sidelined for a cooldown: the pool doesn't use it until
+// the cooldown is over. Meanwhile, the client retries the request at once with another key.
+// When all the keys are sidelined, the calls fail with a NoApiKeyAvailableError.
+type KeyPool struct {
+	strategy KeyPoolStrategy
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	keys []*pooledKey
+	next int
+}
+
+type KeyPoolOption func(p *KeyPool)
+
+// WithKeyPoolStrategy sets how the key of each request is chosen. Defaults to KeyPoolRoundRobin.
+func WithKeyPoolStrategy(strategy KeyPoolStrategy) KeyPoolOption {
+	return func(p *KeyPool) {
+		p.strategy = strategy
+	}
+}
+
+// WithKeyPoolCooldown sets how long a key rejected with a 401 or 429 status code is sidelined.
+// Defaults to DefaultKeyCooldown.
+func WithKeyPoolCooldown(cooldown time.Duration) KeyPoolOption {
+	return func(p *KeyPool) {
+		p.cooldown = cooldown
+	}
+}
+
+// NewKeyPool creates a pool of API keys, to use with WithApiKeyPool. Empty and duplicated keys are ignored.
+// Available options are:
+//   - WithKeyPoolStrategy
+//   - WithKeyPoolCooldown
+func NewKeyPool(keys []string, opts ...KeyPoolOption) *KeyPool {
+	p := &KeyPool{
+		strategy: KeyPoolRoundRobin,
+		cooldown: DefaultKeyCooldown,
+	}
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok || key == "" {
+			continue
+		}
+		seen[key] = struct{}{}
+		p.keys = append(p.keys, &pooledKey{pool: p, value: key, usage: KeyUsage{Key: maskKey(key)}})
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+var _ CredentialProvider = (*KeyPool)(nil)
+
+// Credential picks the key of the next request.
+func (p *KeyPool) Credential(_ context.Context) (Credential, error) {
+	k, err := p.pick()
+	if err != nil {
+		return Credential{}, err
+	}
+	cred := BearerCredential(k.value)
+	cred.key = k
+	cred.apiKey = k.value
+	return cred, nil
+}
+
+// Refresh returns true if another key is available: the rejected key has been sidelined.
+func (p *KeyPool) Refresh(_ context.Context, _ Credential) bool {
+	return p.Available() > 0
+}
+
+// Usage returns the usage of each key, in the order they were given to NewKeyPool.
+func (p *KeyPool) Usage() []KeyUsage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	usages := make([]KeyUsage, len(p.keys))
+	for i, k := range p.keys {
+		usages[i] = k.usage
+		if !usages[i].SidelinedUntil.After(now) {
+			usages[i].SidelinedUntil = time.Time{}
+		}
+		if k.usage.RateLimit != nil {
+			state := *k.usage.RateLimit
+			usages[i].RateLimit = &state
+		}
+	}
+	return usages
+}
+
+// Available returns the number of keys which are not sidelined.
+func (p *KeyPool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, k := range p.keys {
+		if !k.usage.SidelinedUntil.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// pick chooses the key of the next request, and counts the request in flight until release is called.
+func (p *KeyPool) pick() (*pooledKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var chosen, soonest *pooledKey
+	chosenIdx := 0
+	for i := range p.keys {
+		idx := (p.next + i) % len(p.keys)
+		k := p.keys[idx]
+		if k.usage.SidelinedUntil.After(now) {
+			if soonest == nil || k.usage.SidelinedUntil.Before(soonest.usage.SidelinedUntil) {
+				soonest = k
+			}
+			continue
+		}
+		if chosen == nil || (p.strategy == KeyPoolLeastLoaded && k.usage.InFlight < chosen.usage.InFlight) {
+			chosen, chosenIdx = k, idx
+			if p.strategy == KeyPoolRoundRobin {
+				break
+			}
+		}
+	}
+
+	if chosen == nil {
+		var retryIn time.Duration
+		if soonest != nil {
+			retryIn = soonest.usage.SidelinedUntil.Sub(now)
+		}
+		return nil, &NoApiKeyAvailableError{RetryIn: retryIn}
+	}
+
+	p.next = (chosenIdx + 1) % len(p.keys)
+	chosen.usage.Requests++
+	chosen.usage.InFlight++
+	return chosen, nil
+}
+
+// record counts the outcome of a request sent with the key: resp is nil if the request failed without response.
+// The key is sidelined if the response rejected it. It returns the cooldown of the key, or 0 if it was not sidelined.
+func (p *KeyPool) record(k *pooledKey, resp *http.Response) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if resp == nil {
+		k.usage.Errors++
+		return 0
+	}
+	if state, ok := ParseRateLimitHeaders(resp.Header); ok {
+		k.usage.RateLimit = &state
+	}
+	if resp.StatusCode == http.StatusOK {
+		return 0
+	}
+
+	k.usage.Errors++
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		k.usage.Unauthorized++
+	case http.StatusTooManyRequests:
+		k.usage.RateLimited++
+	default:
+		return 0
+	}
+	k.usage.SidelinedUntil = time.Now().Add(p.cooldown)
+	return p.cooldown
+}
+
+// release ends a request started with pick.
+func (p *KeyPool) release(k *pooledKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k.usage.InFlight--
+}
+
+// isKeyRejected tells whether the status code shows that the key can't be used for now.
+func isKeyRejected(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusTooManyRequests
+}
+
+// maskKey hides the key but its last 4 characters, or entirely if it is too short.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
@@ -0,0 +1,192 @@
+package mistral_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// makeKeyServer answers with the given status code for each key, 200 by default, and records the keys it receives.
+func makeKeyServer(t *testing.T, statuses map[string]int) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+
+		if status, ok := statuses[key]; ok {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"message": "rejected"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ratelimitbysize-remaining", "1000")
+		_, _ = w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+	}))
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+}
+
+func TestClient_ApiKeyPool(t *testing.T) {
+	ctx := context.Background()
+	req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
+
+	t.Run("should use the keys in turn", func(t *testing.T) {
+		// Given
+		srv, receivedKeys := makeKeyServer(t, nil)
+		defer srv.Close()
+		pool := mistral.NewKeyPool([]string{"first-api-key", "second-api-key"})
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithApiKeyPool(pool))
+
+		// When
+		for range 3 {
+			_, err := c.Embeddings(ctx, req)
+			assert.NoError(t, err)
+		}
+
+		// Then
+		assert.Equal(t, []string{"first-api-key", "second-api-key", "first-api-key"}, receivedKeys())
+		usage := pool.Usage()
+		assert.Equal(t, "****-key", usage[0].Key)
+		assert.Equal(t, 2, usage[0].Requests)
+		assert.Equal(t, 1, usage[1].Requests)
+		assert.Equal(t, 0, usage[0].InFlight)
+		assert.Equal(t, 1000, usage[0].RateLimit.Remaining)
+	})
+
+	t.Run("should sideline a rejected key and retry with another one", func(t *testing.T) {
+		// Given
+		srv, receivedKeys := makeKeyServer(t, map[string]int{
+			"revoked-api-key":   http.StatusUnauthorized,
+			"exhausted-api-key": http.StatusTooManyRequests,
+		})
+		defer srv.Close()
+		pool := mistral.NewKeyPool([]string{"revoked-api-key", "exhausted-api-key", "valid-api-key"})
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithApiKeyPool(pool),
+			mistral.WithRetry(3, time.Second, time.Second))
+
+		// When
+		start := time.Now()
+		_, err1 := c.Embeddings(ctx, req)
+		_, err2 := c.Embeddings(ctx, req)
+		elapsed := time.Since(start)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Less(t, elapsed, 500*time.Millisecond, "the request must be retried at once with another key")
+		assert.Equal(t, []string{"revoked-api-key", "exhausted-api-key", "valid-api-key", "valid-api-key"}, receivedKeys())
+		assert.Equal(t, 1, pool.Available())
+		usage := pool.Usage()
+		assert.Equal(t, 1, usage[0].Unauthorized)
+		assert.Equal(t, 1, usage[1].RateLimited)
+		assert.False(t, usage[0].SidelinedUntil.IsZero())
+		assert.True(t, usage[2].SidelinedUntil.IsZero())
+	})
+
+	t.Run("should fail when all the keys are sidelined", func(t *testing.T) {
+		// Given
+		srv, receivedKeys := makeKeyServer(t, map[string]int{"revoked-api-key": http.StatusUnauthorized})
+		defer srv.Close()
+		pool := mistral.NewKeyPool([]string{"revoked-api-key"}, mistral.WithKeyPoolCooldown(time.Hour))
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithApiKeyPool(pool))
+
+		// When
+		_, err1 := c.Embeddings(ctx, req)
+		_, err2 := c.Embeddings(ctx, req)
+
+		// Then
+		assert.ErrorIs(t, err1, mistral.ErrUnauthorized)
+		assert.ErrorIs(t, err2, mistral.ErrNoApiKeyAvailable)
+		var noKeyErr *mistral.NoApiKeyAvailableError
+		if assert.ErrorAs(t, err2, &noKeyErr) {
+			assert.Greater(t, noKeyErr.RetryIn, 59*time.Minute)
+		}
+		assert.Len(t, receivedKeys(), 1)
+	})
+
+	t.Run("should bring a key back after its cooldown", func(t *testing.T) {
+		// Given
+		var rejected atomic.Bool
+		rejected.Store(true)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rejected.Load() {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+		}))
+		defer srv.Close()
+		pool := mistral.NewKeyPool([]string{"flaky-api-key"}, mistral.WithKeyPoolCooldown(50*time.Millisecond))
+		c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithApiKeyPool(pool))
+		_, err := c.Embeddings(ctx, req)
+		assert.ErrorIs(t, err, mistral.ErrRateLimited)
+		rejected.Store(false)
+
+		// When
+		time.Sleep(100 * time.Millisecond)
+		_, err = c.Embeddings(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 1, pool.Available())
+	})
+}
+
+func TestClient_ApiKeyPool_LeastLoaded(t *testing.T) {
+	// Given
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+		if key == "slow-api-key" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	pool := mistral.NewKeyPool([]string{"slow-api-key", "fast-api-key"}, mistral.WithKeyPoolStrategy(mistral.KeyPoolLeastLoaded))
+	c := mistral.New("", mistral.WithBaseApiUrl(srv.URL), mistral.WithApiKeyPool(pool))
+	req := mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"})
+	go func() { _, _ = c.Embeddings(context.Background(), req) }()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(keys) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, pool.Usage()[0].InFlight)
+
+	// When
+	for range 3 {
+		_, err := c.Embeddings(context.Background(), req)
+		assert.NoError(t, err)
+	}
+
+	// Then
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"slow-api-key", "fast-api-key", "fast-api-key", "fast-api-key"}, keys)
+}
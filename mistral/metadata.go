@@ -0,0 +1,64 @@
+package mistral
+
+import (
+	"net/http"
+	"strings"
+)
+
+// requestIdHeaders are the headers carrying the ID of the request, by order of preference.
+var requestIdHeaders = []string{"X-Request-Id", "Mistral-Correlation-Id", "X-Kong-Request-Id"}
+
+// ResponseMetadata describes the HTTP exchange which produced a response.
+// It is not serialized, so it is empty on the responses read from JSON, except for FromCache.
+type ResponseMetadata struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Attempts is the number of HTTP requests made, retries included.
+	Attempts int
+
+	// RequestID is the ID given to the request by the API, if any.
+	RequestID string
+
+	// Headers are the raw headers of the response. They are shared by the chunks of a stream and must not be modified.
+	Headers http.Header
+
+	// RateLimit is the rate-limit quota reported by the response headers, or nil if they don't report any.
+	RateLimit *RateLimitState
+
+	// FromCache tells whether the response was served by the cache instead of the API.
+	FromCache bool
+
+	// PartiallyCached tells whether some inputs of an embeddings request were served by the cache, the others
+	// being sent to the API. The usage of the response only counts the inputs sent to the API.
+	PartiallyCached bool
+
+	// Hedged tells whether the answer came from the hedge request sent because the first one was slow
+	// (see WithHedgedRequests).
+	Hedged bool
+
+	// ServedBy is the model which served the answer, set by the client decorator created with NewFallback.
+	ServedBy string
+}
+
+func newResponseMetadata(resp *http.Response, attempts int) ResponseMetadata {
+	meta := ResponseMetadata{
+		StatusCode: resp.StatusCode,
+		Attempts:   attempts,
+		RequestID:  requestIdFromHeaders(resp.Header),
+		Headers:    resp.Header,
+	}
+	if state, ok := ParseRateLimitHeaders(resp.Header); ok {
+		meta.RateLimit = &state
+	}
+	return meta
+}
+
+func requestIdFromHeaders(h http.Header) string {
+	for _, name := range requestIdHeaders {
+		if id := strings.TrimSpace(h.Get(name)); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package mistral_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+func TestClient_ResponseMetadata(t *testing.T) {
+	ctx := context.Background()
+	inputMsgs := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	// newServer fails the first attempt of each request with a 503, then answers with the body.
+	newServer := func(contentType, body string) *httptest.Server {
+		var attempts int32
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1)%2 == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("X-Request-Id", "req-123")
+			w.Header().Set("ratelimitbysize-limit", "1000")
+			w.Header().Set("ratelimitbysize-remaining", "900")
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+
+	assertMetadata := func(t *testing.T, meta mistral.ResponseMetadata) {
+		t.Helper()
+		assert.Equal(t, http.StatusOK, meta.StatusCode)
+		assert.Equal(t, 2, meta.Attempts)
+		assert.Equal(t, "req-123", meta.RequestID)
+		assert.Equal(t, "900", meta.Headers.Get("ratelimitbysize-remaining"))
+		if assert.NotNil(t, meta.RateLimit) {
+			assert.Equal(t, 1000, meta.RateLimit.Limit)
+			assert.Equal(t, 900, meta.RateLimit.Remaining)
+		}
+		assert.False(t, meta.FromCache)
+	}
+
+	t.Run("should expose the metadata of a chat completion", func(t *testing.T) {
+		// Given
+		srv := newServer("application/json", `{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`)
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(1, time.Millisecond, time.Millisecond))
+
+		// When
+		res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		assertMetadata(t, res.Metadata)
+	})
+
+	t.Run("should expose the metadata on every chunk of a stream", func(t *testing.T) {
+		// Given
+		srv := newServer("text/event-stream",
+			"data: {\"choices\": [{\"delta\": {\"role\": \"assistant\", \"content\": \"Hello\"}}]}\n\n"+
+				"data: {\"choices\": [{\"delta\": {\"role\": \"assistant\", \"content\": \"\"}, \"finish_reason\": \"stop\"}]}\n\n"+
+				"data: [DONE]\n\n")
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(1, time.Millisecond, time.Millisecond))
+
+		// When
+		stream, err := c.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		var count int
+		for chunk := range stream {
+			assert.NoError(t, chunk.Error)
+			assertMetadata(t, chunk.Metadata)
+			count++
+		}
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("should expose the metadata of embeddings", func(t *testing.T) {
+		// Given
+		srv := newServer("application/json", `{"data": [{"embedding": [0.1, 0.2]}]}`)
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(1, time.Millisecond, time.Millisecond))
+
+		// When
+		res, err := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))
+
+		// Then
+		assert.NoError(t, err)
+		assertMetadata(t, res.Metadata)
+	})
+
+	t.Run("should expose the metadata of the models", func(t *testing.T) {
+		// Given
+		srv := newServer("application/json", `{"data": [{"id": "mistral-small-latest"}, {"id": "mistral-large-latest"}]}`)
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(1, time.Millisecond, time.Millisecond))
+
+		// When
+		models, err := c.ListModels(ctx)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Len(t, models, 2)
+		for _, model := range models {
+			assertMetadata(t, model.Metadata)
+		}
+	})
+
+	t.Run("should expose the metadata of a model card", func(t *testing.T) {
+		// Given
+		srv := newServer("application/json", `{"id": "mistral-small-latest"}`)
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(1, time.Millisecond, time.Millisecond))
+
+		// When
+		model, err := c.GetModel(ctx, "mistral-small-latest")
+
+		// Then
+		assert.NoError(t, err)
+		assertMetadata(t, model.Metadata)
+	})
+
+	t.Run("should tell when the response comes from the cache", func(t *testing.T) {
+		// Given
+		srv := newServer("application/json", `{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`)
+		defer srv.Close()
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRetry(1, time.Millisecond, time.Millisecond),
+			mistral.WithLocalCache(), mistral.WithCacheDir(t.TempDir()))
+
+		// When
+		first, err1 := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+		second, err2 := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assertMetadata(t, first.Metadata)
+		assert.True(t, second.Metadata.FromCache)
+		assert.Equal(t, 0, second.Metadata.Attempts)
+	})
+}
@@ -0,0 +1,136 @@
+package mistraltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorReply is an error response sent by the Server, in one of the formats returned by the Mistral API.
+type ErrorReply struct {
+	Status int
+
+	// Body is sent as JSON. Leave it nil to send Text instead.
+	Body map[string]any
+
+	// Text is sent as plain text when there is no Body.
+	Text string
+
+	Headers http.Header
+
+	// Latency is waited before answering.
+	Latency time.Duration
+}
+
+// ValidationDetail is one of the details of a validation error.
+type ValidationDetail struct {
+	Type string
+	Loc  []string
+	Msg  string
+}
+
+// WithRetryAfter returns a copy of the error with a Retry-After header.
+func (e ErrorReply) WithRetryAfter(d time.Duration) ErrorReply {
+	e.Headers = e.Headers.Clone()
+	if e.Headers == nil {
+		e.Headers = make(http.Header)
+	}
+	e.Headers.Set("Retry-After", strconv.Itoa(int(d.Round(time.Second)/time.Second)))
+	return e
+}
+
+// RateLimited returns a 429 error.
+func RateLimited() ErrorReply {
+	return ErrorReply{
+		Status: http.StatusTooManyRequests,
+		Body: map[string]any{
+			"object":  "error",
+			"message": "Requests rate limit exceeded",
+			"type":    "rate_limited",
+			"param":   nil,
+			"code":    "1300",
+		},
+	}
+}
+
+// Unauthorized returns a 401 error.
+func Unauthorized() ErrorReply {
+	return ErrorReply{
+		Status: http.StatusUnauthorized,
+		Body:   map[string]any{"detail": "Unauthorized"},
+	}
+}
+
+// InvalidRequest returns a 400 error with the given message.
+func InvalidRequest(message string) ErrorReply {
+	return ErrorReply{
+		Status: http.StatusBadRequest,
+		Body: map[string]any{
+			"object":  "error",
+			"message": message,
+			"type":    "invalid_request_invalid_args",
+			"param":   nil,
+			"code":    nil,
+		},
+	}
+}
+
+// ValidationError returns a 422 error with the given details.
+func ValidationError(details ...ValidationDetail) ErrorReply {
+	items := make([]map[string]any, len(details))
+	for i, d := range details {
+		items[i] = map[string]any{"type": d.Type, "loc": d.Loc, "msg": d.Msg}
+	}
+	return ErrorReply{
+		Status: http.StatusUnprocessableEntity,
+		Body: map[string]any{
+			"object":  "error",
+			"message": map[string]any{"detail": items},
+			"type":    "invalid_request_error",
+			"param":   nil,
+			"code":    nil,
+		},
+	}
+}
+
+// NotFound returns a 404 error with the given message.
+func NotFound(message string) ErrorReply {
+	return ErrorReply{
+		Status: http.StatusNotFound,
+		Body: map[string]any{
+			"object":  "error",
+			"message": message,
+			"type":    "invalid_request_error",
+			"param":   nil,
+			"code":    nil,
+		},
+	}
+}
+
+// ServerError returns a 5xx error with a plain text body.
+func ServerError(status int) ErrorReply {
+	return ErrorReply{
+		Status: status,
+		Text:   http.StatusText(status),
+	}
+}
+
+func (e ErrorReply) write(w http.ResponseWriter) {
+	for name, values := range e.Headers {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+
+	if e.Body == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(e.Status)
+		_, _ = w.Write([]byte(e.Text))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(e.Body)
+}
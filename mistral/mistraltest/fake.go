@@ -0,0 +1,327 @@
+package mistraltest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomas-marquis/mistral-client/internal"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+const DefaultFakeWordCount = 20
+
+// Matcher tells whether a rule of the FakeClient applies to a chat completion request.
+type Matcher func(req *mistral.ChatCompletionRequest) bool
+
+// LastUserMessageContains matches the requests whose last user message contains the given text, ignoring the case.
+func LastUserMessageContains(text string) Matcher {
+	text = strings.ToLower(text)
+	return func(req *mistral.ChatCompletionRequest) bool {
+		return strings.Contains(strings.ToLower(lastUserMessage(req)), text)
+	}
+}
+
+// ToolAvailable matches the requests offering the given tool, unless the last message is already a tool result.
+func ToolAvailable(name string) Matcher {
+	return func(req *mistral.ChatCompletionRequest) bool {
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role() == mistral.RoleTool {
+			return false
+		}
+		for _, tool := range req.Tools {
+			if tool.Function.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type fakeRule struct {
+	match Matcher
+	reply Reply
+}
+
+// FakeClient is a deterministic implementation of mistral.Client which never reaches the network.
+//
+// Chat completions are answered with the reply of the first matching rule, or with lorem ipsum text
+// derived from the request: the same request always gets the same answer.
+// Embeddings are pseudo-embeddings derived from the input texts (see PseudoEmbedding).
+type FakeClient struct {
+	wordCount          int
+	embeddingDimension int
+	models             []*mistral.BaseModelCard
+	rules              []fakeRule
+
+	mu           sync.Mutex
+	chatRequests []*mistral.ChatCompletionRequest
+}
+
+var _ mistral.Client = (*FakeClient)(nil)
+
+// FakeOption configures the FakeClient.
+type FakeOption func(c *FakeClient)
+
+// WithFakeWordCount sets the number of words of the lorem ipsum answers (DefaultFakeWordCount by default).
+func WithFakeWordCount(n int) FakeOption {
+	return func(c *FakeClient) {
+		c.wordCount = n
+	}
+}
+
+// WithFakeEmbeddingDimension sets the dimension of the embeddings when the request doesn't set one.
+func WithFakeEmbeddingDimension(dim int) FakeOption {
+	return func(c *FakeClient) {
+		c.embeddingDimension = dim
+	}
+}
+
+// WithFakeModels replaces the models returned by the models methods (DefaultModels by default).
+func WithFakeModels(models ...*mistral.BaseModelCard) FakeOption {
+	return func(c *FakeClient) {
+		c.models = models
+	}
+}
+
+// WhenRequest answers the requests matching the rule with the given reply.
+// Rules are evaluated in the order they are given. A reply without content nor tool calls gets a lorem ipsum content.
+func WhenRequest(match Matcher, reply Reply) FakeOption {
+	return func(c *FakeClient) {
+		c.rules = append(c.rules, fakeRule{match: match, reply: reply})
+	}
+}
+
+// WithFakeToolCall makes the client call the tool with the given arguments whenever it is offered
+// (see ToolAvailable), and answer normally once the tool result is sent back.
+func WithFakeToolCall(name string, args mistral.JsonMap) FakeOption {
+	return WhenRequest(ToolAvailable(name), ToolCallsReply(mistral.NewToolCall("", 0, name, args)))
+}
+
+// NewFakeClient creates a deterministic fake client.
+func NewFakeClient(opts ...FakeOption) *FakeClient {
+	c := &FakeClient{
+		wordCount:          DefaultFakeWordCount,
+		embeddingDimension: DefaultEmbeddingDimension,
+		models:             DefaultModels(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ChatRequests returns the chat completion requests received.
+func (c *FakeClient) ChatRequests() []*mistral.ChatCompletionRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*mistral.ChatCompletionRequest{}, c.chatRequests...)
+}
+
+func (c *FakeClient) ChatCompletion(ctx context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+	reply, err := c.reply(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := sleep(ctx, reply.Latency); err != nil {
+		return nil, err
+	}
+
+	return &mistral.ChatCompletionResponse{
+		Id:      responseId(req),
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Created: time.Now(),
+		Choices: []mistral.ChatCompletionChoice{{
+			Index:        0,
+			FinishReason: reply.FinishReason,
+			Message:      mistral.NewAssistantMessageFromString(reply.Content, reply.ToolCalls...),
+		}},
+		Usage:   reply.Usage,
+		Latency: reply.Latency,
+	}, nil
+}
+
+func (c *FakeClient) ChatCompletionStream(ctx context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+	if !req.Stream {
+		return nil, fmt.Errorf("the method ChatCompletionStream requires streaming")
+	}
+	reply, err := c.reply(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := sleep(ctx, reply.Latency); err != nil {
+		return nil, err
+	}
+
+	chunks := reply.chunks()
+	id, created := responseId(req), time.Now()
+	out := make(chan *mistral.CompletionChunk)
+	go func() {
+		defer close(out)
+
+		totalLatency := reply.Latency
+		for i, chunk := range chunks {
+			if err := sleep(ctx, reply.ChunkLatency); err != nil {
+				return
+			}
+			chunk.Id, chunk.Object, chunk.Model, chunk.Created = id, "chat.completion.chunk", req.Model, created
+			chunk.ChunkLatency = reply.ChunkLatency
+			totalLatency += reply.ChunkLatency
+			if i == len(chunks)-1 {
+				chunk.IsLastChunk = true
+				chunk.TotalLatency = totalLatency
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (c *FakeClient) Embeddings(ctx context.Context, req *mistral.EmbeddingRequest) (*mistral.EmbeddingResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dim := req.OutputDimension
+	if dim <= 0 {
+		dim = c.embeddingDimension
+	}
+
+	res := &mistral.EmbeddingResponse{
+		ID:     "fake-" + hashText(strings.Join(req.Input, "\x00"))[:16],
+		Object: "list",
+		Model:  req.Model,
+		Data:   make([]mistral.EmbeddingData, len(req.Input)),
+	}
+	for i, input := range req.Input {
+		res.Data[i] = mistral.EmbeddingData{Object: "embedding", Index: i, Embedding: PseudoEmbedding(input, dim)}
+		res.Usage.PromptTokens += countTokens(input)
+	}
+	res.Usage.TotalTokens = res.Usage.PromptTokens
+	return res, nil
+}
+
+func (c *FakeClient) ListModels(ctx context.Context) ([]*mistral.BaseModelCard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return append([]*mistral.BaseModelCard{}, c.models...), nil
+}
+
+func (c *FakeClient) SearchModels(ctx context.Context, capabilities *mistral.ModelCapabilities) ([]*mistral.BaseModelCard, error) {
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []*mistral.BaseModelCard
+	for _, model := range models {
+		if model.Match(capabilities) {
+			filtered = append(filtered, model)
+		}
+	}
+	return filtered, nil
+}
+
+func (c *FakeClient) GetModel(ctx context.Context, modelId string) (*mistral.BaseModelCard, error) {
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		if m.Id == modelId {
+			return m, nil
+		}
+		for _, alias := range m.Aliases {
+			if alias == modelId {
+				return m, nil
+			}
+		}
+	}
+	return nil, mistral.ErrModelNotFound
+}
+
+// reply records the request and returns the completed reply of the first matching rule, or the lorem ipsum one.
+func (c *FakeClient) reply(req *mistral.ChatCompletionRequest) (Reply, error) {
+	c.mu.Lock()
+	c.chatRequests = append(c.chatRequests, req)
+	c.mu.Unlock()
+
+	var reply Reply
+	for _, rule := range c.rules {
+		if rule.match(req) {
+			reply = rule.reply
+			break
+		}
+	}
+
+	if reply.Content == "" && len(reply.ToolCalls) == 0 {
+		seed := sha256.Sum256([]byte(lastUserMessage(req)))
+		content, err := internal.FakeTextFrom(int(binary.LittleEndian.Uint32(seed[:4])), c.wordCount)
+		if err != nil {
+			return Reply{}, err
+		}
+		reply.Content = content
+	}
+
+	if len(reply.ToolCalls) > 0 {
+		toolCalls := make([]mistral.ToolCall, len(reply.ToolCalls))
+		for i, tc := range reply.ToolCalls {
+			if tc.ID == "" {
+				tc.ID = hashText(fmt.Sprintf("%s/%d/%s", responseId(req), i, tc.Function.Name))[:9]
+			}
+			tc.Index = i
+			toolCalls[i] = tc
+		}
+		reply.ToolCalls = toolCalls
+	}
+
+	return reply.complete(req), nil
+}
+
+func lastUserMessage(req *mistral.ChatCompletionRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if msg := req.Messages[i]; msg.Role() == mistral.RoleUser && msg.Content() != nil {
+			return msg.Content().String()
+		}
+	}
+	return ""
+}
+
+func responseId(req *mistral.ChatCompletionRequest) string {
+	var sb strings.Builder
+	sb.WriteString(req.Model)
+	for _, msg := range req.Messages {
+		sb.WriteString("\x00")
+		sb.WriteString(string(msg.Role()))
+		if msg.Content() != nil {
+			sb.WriteString(msg.Content().String())
+		}
+	}
+	return "fake-" + hashText(sb.String())[:16]
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
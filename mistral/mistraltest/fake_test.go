@@ -0,0 +1,170 @@
+package mistraltest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mistral/mistraltest"
+)
+
+func TestFakeClient_ChatCompletion(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("should answer deterministic lorem ipsum", func(t *testing.T) {
+		// Given
+		client := mistraltest.NewFakeClient(mistraltest.WithFakeWordCount(5))
+		req := mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")})
+
+		// When
+		res1, err1 := client.ChatCompletion(ctx, req)
+		res2, err2 := client.ChatCompletion(ctx, req)
+		other, _ := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Goodbye")}))
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		content := res1.AssistantMessage().Content().String()
+		assert.Equal(t, content, res2.AssistantMessage().Content().String())
+		assert.NotEqual(t, content, other.AssistantMessage().Content().String())
+		assert.Len(t, res1.Choices, 1)
+		assert.Equal(t, mistral.FinishReasonStop, res1.Choices[0].FinishReason)
+		assert.Equal(t, 1, res1.Usage.PromptTokens)
+		assert.Equal(t, 5, res1.Usage.CompletionTokens)
+		assert.Equal(t, res1.Id, res2.Id)
+		assert.Len(t, client.ChatRequests(), 3)
+	})
+
+	t.Run("should answer with the first matching rule", func(t *testing.T) {
+		// Given
+		client := mistraltest.NewFakeClient(
+			mistraltest.WhenRequest(mistraltest.LastUserMessageContains("france"), mistraltest.TextReply("Paris")),
+			mistraltest.WhenRequest(mistraltest.LastUserMessageContains("capital"), mistraltest.TextReply("I don't know")),
+		)
+
+		// When
+		france, _ := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("What is the capital of France?")}))
+		italy, _ := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("What is the capital of Italy?")}))
+
+		// Then
+		assert.Equal(t, "Paris", france.AssistantMessage().Content().String())
+		assert.Equal(t, "I don't know", italy.AssistantMessage().Content().String())
+	})
+
+	t.Run("should call the configured tools", func(t *testing.T) {
+		// Given
+		client := mistraltest.NewFakeClient(mistraltest.WithFakeToolCall("get_weather", mistral.JsonMap{"city": "Paris"}))
+		tools := []mistral.Tool{mistral.NewTool("get_weather", "Get the weather", mistral.NewObjectPropertyDefinition(nil))}
+		messages := []mistral.ChatMessage{mistral.NewUserMessageFromString("What's the weather in Paris?")}
+
+		// When
+		res, err := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", messages,
+			mistral.WithTools(tools)))
+		assert.NoError(t, err)
+		toolCall := res.AssistantMessage().ToolCalls[0]
+		messages = append(messages, res.AssistantMessage(),
+			mistral.NewToolMessage(toolCall.Function.Name, toolCall.ID, mistral.ContentString("sunny")))
+		final, err := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", messages,
+			mistral.WithTools(tools)))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, mistral.FinishReasonToolCalls, res.Choices[0].FinishReason)
+		assert.Equal(t, "get_weather", toolCall.Function.Name)
+		assert.Equal(t, "Paris", toolCall.Function.Arguments["city"])
+		assert.Len(t, toolCall.ID, 9)
+		assert.Equal(t, mistral.FinishReasonStop, final.Choices[0].FinishReason)
+		assert.NotEmpty(t, final.AssistantMessage().Content().String())
+	})
+
+	t.Run("should not call tools which are not offered", func(t *testing.T) {
+		client := mistraltest.NewFakeClient(mistraltest.WithFakeToolCall("get_weather", nil))
+
+		res, err := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")}))
+
+		assert.NoError(t, err)
+		assert.Empty(t, res.AssistantMessage().ToolCalls)
+	})
+}
+
+func TestFakeClient_ChatCompletionStream(t *testing.T) {
+	// Given
+	ctx := context.TODO()
+	client := mistraltest.NewFakeClient(mistraltest.WhenRequest(
+		mistraltest.LastUserMessageContains("hello"),
+		mistraltest.Reply{Content: "Hello world!", ChunkLatency: time.Millisecond},
+	))
+
+	// When
+	stream, err := client.ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-small-latest",
+		[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")}))
+
+	// Then
+	assert.NoError(t, err)
+	var chunks []*mistral.CompletionChunk
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, "Hello ", chunks[0].Choices[0].Delta.Content().String())
+	assert.Equal(t, "world!", chunks[1].Choices[0].Delta.Content().String())
+	assert.False(t, chunks[1].IsLastChunk)
+	assert.Nil(t, chunks[1].Usage)
+
+	last := chunks[2]
+	assert.True(t, last.IsLastChunk)
+	assert.Equal(t, mistral.FinishReasonStop, last.Choices[0].FinishReason)
+	assert.Equal(t, 2, last.Usage.CompletionTokens)
+	assert.Equal(t, 3*time.Millisecond, last.TotalLatency)
+	for _, chunk := range chunks {
+		assert.Equal(t, chunks[0].Id, chunk.Id)
+		assert.Equal(t, "mistral-small-latest", chunk.Model)
+	}
+
+	t.Run("should require a streaming request", func(t *testing.T) {
+		_, err := client.ChatCompletionStream(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", nil))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestFakeClient_Embeddings(t *testing.T) {
+	// Given
+	ctx := context.TODO()
+	client := mistraltest.NewFakeClient(mistraltest.WithFakeEmbeddingDimension(64))
+
+	// When
+	res, err := client.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello", "world", "hello"}))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Len(t, res.Data, 3)
+	assert.Len(t, res.Data[0].Embedding, 64)
+	assert.Equal(t, res.Data[0].Embedding, res.Data[2].Embedding)
+	assert.NotEqual(t, res.Data[0].Embedding, res.Data[1].Embedding)
+	assert.Equal(t, 2, res.Data[2].Index)
+}
+
+func TestFakeClient_Models(t *testing.T) {
+	ctx := context.TODO()
+	client := mistraltest.NewFakeClient()
+
+	vision, err := client.SearchModels(ctx, &mistral.ModelCapabilities{Vision: true})
+	assert.NoError(t, err)
+	assert.Len(t, vision, 1)
+	assert.Equal(t, "mistral-large-latest", vision[0].Id)
+
+	model, err := client.GetModel(ctx, "mistral-small-2506")
+	assert.NoError(t, err)
+	assert.Equal(t, "mistral-small-latest", model.Id)
+
+	_, err = client.GetModel(ctx, "unknown")
+	assert.ErrorIs(t, err, mistral.ErrModelNotFound)
+}
@@ -0,0 +1,94 @@
+package mistraltest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// Reply is a scripted chat completion answer.
+type Reply struct {
+	// Content is the text of the assistant message. Streamed, it is sent word by word.
+	Content string
+
+	// ToolCalls are the tools the model decides to call.
+	ToolCalls []mistral.ToolCall
+
+	// FinishReason defaults to FinishReasonToolCalls if there are tool calls, FinishReasonStop otherwise.
+	FinishReason mistral.FinishReason
+
+	// Usage is estimated from the number of words of the request and of the reply if nil.
+	Usage *mistral.UsageInfo
+
+	// Latency is waited before answering.
+	Latency time.Duration
+
+	// ChunkLatency is waited before sending each streamed chunk.
+	ChunkLatency time.Duration
+}
+
+// TextReply returns a reply with the given content.
+func TextReply(content string) Reply {
+	return Reply{Content: content}
+}
+
+// ToolCallsReply returns a reply calling the given tools.
+func ToolCallsReply(toolCalls ...mistral.ToolCall) Reply {
+	return Reply{ToolCalls: toolCalls}
+}
+
+// ChatHandler computes the reply to a chat completion request.
+type ChatHandler func(req *mistral.ChatCompletionRequest) Reply
+
+// complete sets the default finish reason and usage.
+func (r Reply) complete(req *mistral.ChatCompletionRequest) Reply {
+	if r.FinishReason == "" {
+		r.FinishReason = mistral.FinishReasonStop
+		if len(r.ToolCalls) > 0 {
+			r.FinishReason = mistral.FinishReasonToolCalls
+		}
+	}
+	if r.Usage == nil {
+		r.Usage = estimateUsage(req, r)
+	}
+	return r
+}
+
+// chunks splits the completed reply into stream chunks: one per word of the content,
+// then a last one with the tool calls, the finish reason and the usage.
+func (r Reply) chunks() []*mistral.CompletionChunk {
+	var chunks []*mistral.CompletionChunk
+	for _, word := range strings.SplitAfter(r.Content, " ") {
+		if word == "" {
+			continue
+		}
+		chunks = append(chunks, &mistral.CompletionChunk{Choices: []mistral.CompletionResponseStreamChoice{{
+			Delta: mistral.NewAssistantMessageFromString(word),
+		}}})
+	}
+	return append(chunks, &mistral.CompletionChunk{
+		Choices: []mistral.CompletionResponseStreamChoice{{
+			Delta:        mistral.NewAssistantMessageFromString("", r.ToolCalls...),
+			FinishReason: r.FinishReason,
+		}},
+		Usage: r.Usage,
+	})
+}
+
+func estimateUsage(req *mistral.ChatCompletionRequest, reply Reply) *mistral.UsageInfo {
+	usage := &mistral.UsageInfo{}
+	for _, msg := range req.Messages {
+		if msg.Content() != nil {
+			usage.PromptTokens += countTokens(msg.Content().String())
+		}
+	}
+	usage.CompletionTokens = countTokens(reply.Content) + 10*len(reply.ToolCalls)
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// countTokens roughly estimates the number of tokens as one per word.
+func countTokens(text string) int {
+	return len(strings.Fields(text))
+}
@@ -0,0 +1,460 @@
+// Package mistraltest provides utilities to test code using the mistral client without reaching the Mistral API.
+//
+// Server is a programmable fake of the API, serving chat completions (sync and streamed), embeddings and models,
+// with scripted replies, injected latency and error sequences. It records the requests it receives for assertions.
+//
+// FakeClient is a deterministic implementation of mistral.Client, for the code which only needs a client
+// giving plausible answers without network.
+package mistraltest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// Endpoint identifies an API endpoint served by the Server.
+type Endpoint string
+
+const (
+	EndpointChatCompletions Endpoint = "POST /v1/chat/completions"
+	EndpointEmbeddings      Endpoint = "POST /v1/embeddings"
+	EndpointListModels      Endpoint = "GET /v1/models"
+	EndpointGetModel        Endpoint = "GET /v1/models/{id}"
+)
+
+const (
+	DefaultApiKey             = "mistraltest-api-key"
+	DefaultReplyContent       = "This is a fake answer from the mistraltest server."
+	DefaultEmbeddingDimension = 1024
+)
+
+// Server is a fake of the Mistral API, built on httptest.Server.
+//
+// Chat completion requests are answered with the replies scripted with ReplyWith, in order,
+// then with the chat handler (DefaultReplyContent by default).
+// Errors scripted with FailNext are sent before any reply, to exercise the retries.
+type Server struct {
+	*httptest.Server
+
+	apiKey             string
+	latency            time.Duration
+	embeddingDimension int
+	chatHandler        ChatHandler
+
+	mu                sync.Mutex
+	models            []*mistral.BaseModelCard
+	replies           []Reply
+	failures          map[Endpoint][]ErrorReply
+	calls             map[Endpoint]int
+	chatRequests      []*mistral.ChatCompletionRequest
+	embeddingRequests []*mistral.EmbeddingRequest
+}
+
+// Option configures the Server.
+type Option func(s *Server)
+
+// WithApiKey makes the server answer 401 to the requests not using this API key. Any key is accepted by default.
+func WithApiKey(apiKey string) Option {
+	return func(s *Server) {
+		s.apiKey = apiKey
+	}
+}
+
+// WithLatency adds a latency to every response.
+func WithLatency(latency time.Duration) Option {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+// WithEmbeddingDimension sets the dimension of the embeddings when the request doesn't set one.
+func WithEmbeddingDimension(dim int) Option {
+	return func(s *Server) {
+		s.embeddingDimension = dim
+	}
+}
+
+// WithModels replaces the models served by the models endpoints.
+func WithModels(models ...*mistral.BaseModelCard) Option {
+	return func(s *Server) {
+		s.models = models
+	}
+}
+
+// WithChatHandler sets how the chat completion requests are answered once the scripted replies are used.
+func WithChatHandler(handler ChatHandler) Option {
+	return func(s *Server) {
+		s.chatHandler = handler
+	}
+}
+
+// NewServer starts a fake server, closed at the end of the test.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	s := &Server{
+		embeddingDimension: DefaultEmbeddingDimension,
+		chatHandler: func(*mistral.ChatCompletionRequest) Reply {
+			return TextReply(DefaultReplyContent)
+		},
+		models:   DefaultModels(),
+		failures: make(map[Endpoint][]ErrorReply),
+		calls:    make(map[Endpoint]int),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(string(EndpointChatCompletions), s.handleChatCompletions)
+	mux.HandleFunc(string(EndpointEmbeddings), s.handleEmbeddings)
+	mux.HandleFunc(string(EndpointListModels), s.handleListModels)
+	mux.HandleFunc(string(EndpointGetModel), s.handleGetModel)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Client returns a client calling this server, with retries disabled unless set again in the options.
+func (s *Server) Client(opts ...mistral.Option) mistral.Client {
+	apiKey := s.apiKey
+	if apiKey == "" {
+		apiKey = DefaultApiKey
+	}
+	return mistral.New(apiKey, append([]mistral.Option{
+		mistral.WithBaseApiUrl(s.URL),
+		mistral.WithRetry(0, 0, 0),
+	}, opts...)...)
+}
+
+// ReplyWith appends replies to the chat completion script.
+func (s *Server) ReplyWith(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// FailNext makes the next calls to the endpoint fail with the given errors, in order.
+func (s *Server) FailNext(endpoint Endpoint, errs ...ErrorReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], errs...)
+}
+
+// Calls returns the number of requests received by the endpoint, failed ones included.
+func (s *Server) Calls(endpoint Endpoint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+// ChatRequests returns the chat completion requests received, failed ones included.
+func (s *Server) ChatRequests() []*mistral.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*mistral.ChatCompletionRequest{}, s.chatRequests...)
+}
+
+// LastChatRequest returns the last chat completion request received, or nil.
+func (s *Server) LastChatRequest() *mistral.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.chatRequests) == 0 {
+		return nil
+	}
+	return s.chatRequests[len(s.chatRequests)-1]
+}
+
+// EmbeddingRequests returns the embedding requests received, failed ones included.
+func (s *Server) EmbeddingRequests() []*mistral.EmbeddingRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*mistral.EmbeddingRequest{}, s.embeddingRequests...)
+}
+
+// AssertCalls reports an error to t if the endpoint did not receive exactly n requests.
+func (s *Server) AssertCalls(t testing.TB, endpoint Endpoint, n int) bool {
+	t.Helper()
+	if got := s.Calls(endpoint); got != n {
+		t.Errorf("expected %d calls to %s, got %d", n, endpoint, got)
+		return false
+	}
+	return true
+}
+
+// AssertChatRequest calls assertFn with the i-th chat completion request received,
+// or reports an error to t if there is no such request.
+func (s *Server) AssertChatRequest(t testing.TB, i int, assertFn func(req *mistral.ChatCompletionRequest)) bool {
+	t.Helper()
+	requests := s.ChatRequests()
+	if i < 0 || i >= len(requests) {
+		t.Errorf("expected at least %d chat completion requests, got %d", i+1, len(requests))
+		return false
+	}
+	assertFn(requests[i])
+	return true
+}
+
+// begin records the call, waits for the latency, and sends the scripted error if any.
+// It returns false if the response has been sent.
+func (s *Server) begin(w http.ResponseWriter, r *http.Request, endpoint Endpoint) bool {
+	s.mu.Lock()
+	s.calls[endpoint]++
+	var failure *ErrorReply
+	if queue := s.failures[endpoint]; len(queue) > 0 {
+		failure = &queue[0]
+		s.failures[endpoint] = queue[1:]
+	}
+	s.mu.Unlock()
+
+	if !wait(r, s.latency) {
+		return false
+	}
+
+	if s.apiKey != "" && r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		Unauthorized().write(w)
+		return false
+	}
+	if failure != nil {
+		if !wait(r, failure.Latency) {
+			return false
+		}
+		failure.write(w)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req mistral.ChatCompletionRequest
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		InvalidRequest(fmt.Sprintf("Invalid request body: %v", err)).write(w)
+		return
+	}
+
+	s.mu.Lock()
+	s.chatRequests = append(s.chatRequests, &req)
+	s.mu.Unlock()
+
+	if !s.begin(w, r, EndpointChatCompletions) {
+		return
+	}
+
+	s.mu.Lock()
+	var reply Reply
+	if len(s.replies) > 0 {
+		reply = s.replies[0]
+		s.replies = s.replies[1:]
+	} else {
+		reply = s.chatHandler(&req)
+	}
+	s.mu.Unlock()
+
+	reply = reply.complete(&req)
+	if !wait(r, reply.Latency) {
+		return
+	}
+
+	if req.Stream {
+		s.streamReply(w, r, &req, reply)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &mistral.ChatCompletionResponse{
+		Id:      "mistraltest-" + fmt.Sprint(s.Calls(EndpointChatCompletions)),
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Created: time.Now(),
+		Choices: []mistral.ChatCompletionChoice{{
+			Index:        0,
+			FinishReason: reply.FinishReason,
+			Message:      mistral.NewAssistantMessageFromString(reply.Content, reply.ToolCalls...),
+		}},
+		Usage: reply.Usage,
+	})
+}
+
+func (s *Server) streamReply(w http.ResponseWriter, r *http.Request, req *mistral.ChatCompletionRequest, reply Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	id := "mistraltest-" + fmt.Sprint(s.Calls(EndpointChatCompletions))
+	created := time.Now()
+	send := func(chunk *mistral.CompletionChunk) bool {
+		if !wait(r, reply.ChunkLatency) {
+			return false
+		}
+		chunk.Id, chunk.Object, chunk.Model, chunk.Created = id, "chat.completion.chunk", req.Model, created
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return true
+	}
+
+	for _, chunk := range reply.chunks() {
+		if !send(chunk) {
+			return
+		}
+	}
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req mistral.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidRequest(fmt.Sprintf("Invalid request body: %v", err)).write(w)
+		return
+	}
+
+	s.mu.Lock()
+	s.embeddingRequests = append(s.embeddingRequests, &req)
+	s.mu.Unlock()
+
+	if !s.begin(w, r, EndpointEmbeddings) {
+		return
+	}
+
+	dim := req.OutputDimension
+	if dim <= 0 {
+		dim = s.embeddingDimension
+	}
+
+	res := &mistral.EmbeddingResponse{
+		ID:     "mistraltest-" + fmt.Sprint(s.Calls(EndpointEmbeddings)),
+		Object: "list",
+		Model:  req.Model,
+		Data:   make([]mistral.EmbeddingData, len(req.Input)),
+	}
+	for i, input := range req.Input {
+		res.Data[i] = mistral.EmbeddingData{Object: "embedding", Index: i, Embedding: PseudoEmbedding(input, dim)}
+		res.Usage.PromptTokens += countTokens(input)
+	}
+	res.Usage.TotalTokens = res.Usage.PromptTokens
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
+	if !s.begin(w, r, EndpointListModels) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": s.models})
+}
+
+func (s *Server) handleGetModel(w http.ResponseWriter, r *http.Request) {
+	if !s.begin(w, r, EndpointGetModel) {
+		return
+	}
+
+	id := r.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.models {
+		if m.Id == id {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+		for _, alias := range m.Aliases {
+			if alias == id {
+				writeJSON(w, http.StatusOK, m)
+				return
+			}
+		}
+	}
+	NotFound(fmt.Sprintf("Model '%s' not found", id)).write(w)
+}
+
+// DefaultModels returns the models served by default: a chat model with all capabilities, a small chat model
+// without vision and an embedding model.
+func DefaultModels() []*mistral.BaseModelCard {
+	return []*mistral.BaseModelCard{
+		{
+			Id: "mistral-large-latest", Name: "mistral-large-2411", Object: "model", ModelType: "base", OwnedBy: "mistralai",
+			Aliases: []string{"mistral-large-2411"}, MaxContextLength: 131072, DefaultModelTemperature: 0.7,
+			Capabilities: mistral.ModelCapabilities{CompletionChat: true, FunctionCalling: true, Vision: true, FineTuning: true},
+		},
+		{
+			Id: "mistral-small-latest", Name: "mistral-small-2506", Object: "model", ModelType: "base", OwnedBy: "mistralai",
+			Aliases: []string{"mistral-small-2506"}, MaxContextLength: 131072, DefaultModelTemperature: 0.3,
+			Capabilities: mistral.ModelCapabilities{CompletionChat: true, FunctionCalling: true},
+		},
+		{
+			Id: "mistral-embed", Name: "mistral-embed", Object: "model", ModelType: "base", OwnedBy: "mistralai",
+			MaxContextLength: 8192,
+		},
+	}
+}
+
+// PseudoEmbedding returns a deterministic unit vector of the given dimension derived from the text:
+// the same text always gets the same embedding.
+func PseudoEmbedding(text string, dim int) mistral.EmbeddingVector {
+	vector := make(mistral.EmbeddingVector, dim)
+	seed := sha256.Sum256([]byte(text))
+	state := binary.LittleEndian.Uint64(seed[:8])
+
+	var norm float64
+	for i := range vector {
+		// xorshift64*
+		state ^= state >> 12
+		state ^= state << 25
+		state ^= state >> 27
+		v := float64(state*2685821657736338717>>11)/float64(1<<53)*2 - 1
+		vector[i] = float32(v)
+		norm += v * v
+	}
+
+	norm = math.Sqrt(norm)
+	if norm > 0 {
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector
+}
+
+// wait sleeps for the given duration, and returns false if the client went away in the meantime.
+func wait(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,278 @@
+package mistraltest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mistral/mistraltest"
+)
+
+func TestServer_ChatCompletion(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("should answer with the scripted replies then the default one", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t)
+		server.ReplyWith(mistraltest.TextReply("Paris"), mistraltest.TextReply("Rome"))
+		client := server.Client()
+		req := mistral.NewChatCompletionRequest("mistral-small-latest", []mistral.ChatMessage{
+			mistral.NewUserMessageFromString("What is the capital of France?"),
+		})
+
+		// When
+		res1, err1 := client.ChatCompletion(ctx, req)
+		res2, err2 := client.ChatCompletion(ctx, req)
+		res3, err3 := client.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.NoError(t, err3)
+		assert.Equal(t, "Paris", res1.AssistantMessage().Content().String())
+		assert.Equal(t, "Rome", res2.AssistantMessage().Content().String())
+		assert.Equal(t, mistraltest.DefaultReplyContent, res3.AssistantMessage().Content().String())
+		assert.Equal(t, mistral.FinishReasonStop, res1.Choices[0].FinishReason)
+		assert.Equal(t, 6, res1.Usage.PromptTokens)
+		assert.Equal(t, "mistral-small-latest", res1.Model)
+
+		server.AssertCalls(t, mistraltest.EndpointChatCompletions, 3)
+		server.AssertChatRequest(t, 0, func(req *mistral.ChatCompletionRequest) {
+			assert.Equal(t, "mistral-small-latest", req.Model)
+			assert.Equal(t, "What is the capital of France?", req.Messages[0].Content().String())
+		})
+	})
+
+	t.Run("should script a tool call scenario", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t)
+		server.ReplyWith(
+			mistraltest.ToolCallsReply(mistral.NewToolCall("call-1", 0, "get_weather", mistral.JsonMap{"city": "Paris"})),
+			mistraltest.TextReply("It is sunny in Paris"),
+		)
+		client := server.Client()
+		messages := []mistral.ChatMessage{mistral.NewUserMessageFromString("What's the weather in Paris?")}
+
+		// When
+		res, err := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", messages))
+		assert.NoError(t, err)
+		toolCall := res.AssistantMessage().ToolCalls[0]
+		messages = append(messages, res.AssistantMessage(),
+			mistral.NewToolMessage(toolCall.Function.Name, toolCall.ID, mistral.ContentString("sunny")))
+		final, err := client.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest", messages))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, mistral.FinishReasonToolCalls, res.Choices[0].FinishReason)
+		assert.Equal(t, "get_weather", toolCall.Function.Name)
+		assert.Equal(t, "Paris", toolCall.Function.Arguments["city"])
+		assert.Equal(t, "It is sunny in Paris", final.AssistantMessage().Content().String())
+
+		last := server.LastChatRequest()
+		assert.Len(t, last.Messages, 3)
+		assert.Equal(t, mistral.RoleTool, last.Messages[2].Role())
+	})
+
+	t.Run("should answer with the chat handler", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t, mistraltest.WithChatHandler(func(req *mistral.ChatCompletionRequest) mistraltest.Reply {
+			return mistraltest.TextReply("echo: " + req.Messages[len(req.Messages)-1].Content().String())
+		}))
+
+		// When
+		res, err := server.Client().ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")}))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "echo: Hello", res.AssistantMessage().Content().String())
+	})
+
+	t.Run("should stream the reply word by word", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t)
+		server.ReplyWith(mistraltest.Reply{
+			Content:   "Hello world!",
+			ToolCalls: []mistral.ToolCall{mistral.NewToolCall("call-1", 0, "greet", mistral.JsonMap{})},
+		})
+
+		// When
+		stream, err := server.Client().ChatCompletionStream(ctx, mistral.NewChatCompletionStreamRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")}))
+
+		// Then
+		assert.NoError(t, err)
+		var chunks []*mistral.CompletionChunk
+		for chunk := range stream {
+			assert.NoError(t, chunk.Error)
+			chunks = append(chunks, chunk)
+		}
+		assert.Len(t, chunks, 3)
+		assert.Equal(t, "Hello ", chunks[0].Choices[0].Delta.Content().String())
+		assert.Equal(t, "world!", chunks[1].Choices[0].Delta.Content().String())
+		assert.False(t, chunks[1].IsLastChunk)
+
+		last := chunks[2]
+		assert.True(t, last.IsLastChunk)
+		assert.Equal(t, mistral.FinishReasonToolCalls, last.Choices[0].FinishReason)
+		assert.Equal(t, "greet", last.Choices[0].Delta.ToolCalls[0].Function.Name)
+		assert.Equal(t, 1, last.Usage.PromptTokens)
+		assert.Equal(t, 12, last.Usage.CompletionTokens)
+	})
+
+	t.Run("should wait for the injected latency", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t, mistraltest.WithLatency(200*time.Millisecond))
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		// When
+		_, err := server.Client().ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-small-latest",
+			[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")}))
+
+		// Then
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestServer_Errors(t *testing.T) {
+	ctx := context.TODO()
+	req := mistral.NewChatCompletionRequest("mistral-small-latest",
+		[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hello")})
+
+	t.Run("should send errors parsed by the client", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			reply    mistraltest.ErrorReply
+			expected string
+		}{
+			{"rate limited", mistraltest.RateLimited(), "[429] rate_limited: Requests rate limit exceeded"},
+			{"unauthorized", mistraltest.Unauthorized(), "[401] Unauthorized"},
+			{"invalid request", mistraltest.InvalidRequest("Invalid model"), "[400] invalid_request_invalid_args: Invalid model"},
+			{"validation", mistraltest.ValidationError(mistraltest.ValidationDetail{
+				Type: "missing", Loc: []string{"body", "messages"}, Msg: "Field required",
+			}), "[422] invalid_request_error: missing: Field required (body.messages)"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Given
+				server := mistraltest.NewServer(t)
+				server.FailNext(mistraltest.EndpointChatCompletions, tc.reply)
+
+				// When
+				_, err := server.Client().ChatCompletion(ctx, req)
+
+				// Then
+				var apiErr mistral.ApiError
+				assert.True(t, errors.As(err, &apiErr))
+				assert.Equal(t, tc.reply.Status, apiErr.Code())
+				assert.Equal(t, tc.expected, apiErr.Error())
+			})
+		}
+	})
+
+	t.Run("should exercise the retries with a sequence of errors", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t)
+		server.FailNext(mistraltest.EndpointChatCompletions,
+			mistraltest.RateLimited(),
+			mistraltest.ServerError(http.StatusServiceUnavailable))
+		server.ReplyWith(mistraltest.TextReply("Finally"))
+		client := server.Client(mistral.WithRetry(2, time.Millisecond, 2*time.Millisecond))
+
+		// When
+		res, err := client.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "Finally", res.AssistantMessage().Content().String())
+		server.AssertCalls(t, mistraltest.EndpointChatCompletions, 3)
+		assert.Len(t, server.ChatRequests(), 3)
+	})
+
+	t.Run("should reject other API keys", func(t *testing.T) {
+		// Given
+		server := mistraltest.NewServer(t, mistraltest.WithApiKey("good-key"))
+		client := mistral.New("bad-key", mistral.WithBaseApiUrl(server.URL))
+
+		// When
+		_, errBad := client.ChatCompletion(ctx, req)
+		_, errGood := server.Client().ChatCompletion(ctx, req)
+
+		// Then
+		var apiErr mistral.ApiError
+		assert.True(t, errors.As(errBad, &apiErr))
+		assert.Equal(t, http.StatusUnauthorized, apiErr.Code())
+		assert.NoError(t, errGood)
+	})
+}
+
+func TestServer_Embeddings(t *testing.T) {
+	// Given
+	ctx := context.TODO()
+	server := mistraltest.NewServer(t, mistraltest.WithEmbeddingDimension(8))
+	client := server.Client()
+
+	// When
+	res1, err1 := client.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello", "world"}))
+	res2, err2 := client.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"},
+		mistral.WithEmbeddingOutputDimension(16)))
+
+	// Then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Len(t, res1.Data, 2)
+	assert.Len(t, res1.Data[0].Embedding, 8)
+	assert.Equal(t, mistraltest.PseudoEmbedding("hello", 8), res1.Data[0].Embedding)
+	assert.NotEqual(t, res1.Data[0].Embedding, res1.Data[1].Embedding)
+	assert.Equal(t, 2, res1.Usage.PromptTokens)
+	assert.Len(t, res2.Data[0].Embedding, 16)
+	assert.Len(t, server.EmbeddingRequests(), 2)
+}
+
+func TestServer_Models(t *testing.T) {
+	ctx := context.TODO()
+	server := mistraltest.NewServer(t)
+	client := server.Client()
+
+	t.Run("should list the models", func(t *testing.T) {
+		models, err := client.ListModels(ctx)
+
+		assert.NoError(t, err)
+		assert.Len(t, models, len(mistraltest.DefaultModels()))
+	})
+
+	t.Run("should get a model by id or alias", func(t *testing.T) {
+		model, errId := client.GetModel(ctx, "mistral-large-latest")
+		alias, errAlias := client.GetModel(ctx, "mistral-small-2506")
+
+		assert.NoError(t, errId)
+		assert.NoError(t, errAlias)
+		assert.True(t, model.Capabilities.Vision)
+		assert.Equal(t, "mistral-small-latest", alias.Id)
+	})
+
+	t.Run("should not find unknown models", func(t *testing.T) {
+		_, err := client.GetModel(ctx, "unknown")
+
+		assert.ErrorIs(t, err, mistral.ErrModelNotFound)
+	})
+}
+
+func TestPseudoEmbedding(t *testing.T) {
+	v := mistraltest.PseudoEmbedding("hello", 32)
+
+	assert.Len(t, v, 32)
+	assert.Equal(t, v, mistraltest.PseudoEmbedding("hello", 32))
+
+	var norm float32
+	for _, x := range v {
+		norm += x * x
+	}
+	assert.InDelta(t, 1, norm, 1e-4)
+}
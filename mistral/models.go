@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -40,6 +39,9 @@ type BaseModelCard struct {
 	Created                 int               `json:"created"`
 	Aliases                 []string          `json:"aliases"`
 	Capabilities            ModelCapabilities `json:"capabilities"`
+
+	// Metadata describes the HTTP exchange which returned the card. The cards of a models list share it.
+	Metadata ResponseMetadata `json:"-"`
 }
 
 func (m *BaseModelCard) Match(cap *ModelCapabilities) bool {
@@ -67,9 +69,18 @@ type listModelResponse struct {
 }
 
 func (c *clientImpl) ListModels(ctx context.Context) ([]*BaseModelCard, error) {
-	url := fmt.Sprintf("%s/v1/models", c.baseURL)
+	url, err := c.endpointURL(EndpointModels, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	call, err := c.acquire(ctx, EndpointModels, "", 1)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, _, err := c.sendRequest(ctx, http.MethodGet, url, nil)
+	resp, _, meta, err := c.sendRequest(ctx, http.MethodGet, url, nil)
+	call.finish(err)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +98,9 @@ func (c *clientImpl) ListModels(ctx context.Context) ([]*BaseModelCard, error) {
 	if err := json.Unmarshal(bodyContent, &response); err != nil {
 		return nil, err
 	}
+	for _, model := range response.Data {
+		model.Metadata = meta
+	}
 
 	return response.Data, nil
 }
@@ -107,9 +121,23 @@ func (c *clientImpl) SearchModels(ctx context.Context, capabilities *ModelCapabi
 }
 
 func (c *clientImpl) GetModel(ctx context.Context, modelId string) (*BaseModelCard, error) {
-	url := fmt.Sprintf("%s/v1/models/%s", c.baseURL, modelId)
+	if c.deployment.modelsFromList {
+		return c.getModelFromList(ctx, modelId)
+	}
+
+	url, err := c.endpointURL(EndpointModels, "", false)
+	if err != nil {
+		return nil, err
+	}
+	url += "/" + modelId
 
-	resp, _, err := c.sendRequest(ctx, http.MethodGet, url, nil)
+	call, err := c.acquire(ctx, EndpointModels, "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, meta, err := c.sendRequest(ctx, http.MethodGet, url, nil)
+	call.finish(err)
 	if err != nil {
 		var apiErr ApiError
 		if ok := errors.As(err, &apiErr); ok && apiErr.Code() == http.StatusNotFound {
@@ -136,6 +164,23 @@ func (c *clientImpl) GetModel(ctx context.Context, modelId string) (*BaseModelCa
 	if err := json.Unmarshal(bodyContent, &response); err != nil {
 		return nil, err
 	}
+	if response != nil {
+		response.Metadata = meta
+	}
 
 	return response, nil
 }
+
+// getModelFromList finds the model in the models list, for the deployments which don't get a model by ID.
+func (c *clientImpl) getModelFromList(ctx context.Context, modelId string) (*BaseModelCard, error) {
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range models {
+		if model.Id == modelId {
+			return model, nil
+		}
+	}
+	return nil, ErrModelNotFound
+}
@@ -341,6 +341,8 @@ func TestClientImpl_GetModel(t *testing.T) {
 
 		// Then
 		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.Metadata.StatusCode)
+		res.Metadata = mistral.ResponseMetadata{}
 		assert.Equal(t, expectedModel, res)
 	})
 
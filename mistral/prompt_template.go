@@ -0,0 +1,418 @@
+package mistral
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ErrMissingVariable matches the errors of the prompt templates rendered without some of their variables
+// (see MissingVariablesError).
+var ErrMissingVariable = errors.New("missing template variable")
+
+// MissingVariablesError is returned when the variables given to a PromptTemplate lack some of the ones it uses.
+// It matches ErrMissingVariable with errors.Is.
+type MissingVariablesError struct {
+	Template string
+	Names    []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("missing variables in prompt template %s: %s", e.Template, strings.Join(e.Names, ", "))
+}
+
+func (e *MissingVariablesError) Is(target error) bool {
+	return target == ErrMissingVariable
+}
+
+// PromptTemplate is a prompt made of several messages, written with text/template, and rendered with variables of
+// type T, a struct or a map with string keys. Each message starts with one of the {{system}}, {{user}} or
+// {{assistant}} actions, and its content runs until the next one:
+//
+//	{{system}}You translate from {{.From}} to {{.To}}.
+//	{{range .Examples}}
+//	{{user}}{{.Source}}
+//	{{assistant}}{{.Translation}}
+//	{{end}}
+//	{{user}}{{.Text}}{{image .ImageURL}}
+//
+// The {{image url}} action inserts an ImageUrlChunk in the message; it is only allowed in user messages. The spaces around the content of the messages
+// are trimmed. The partials are defined with {{define}} in the template, or added with WithPartial and
+// WithPartialFiles, and included with {{template "name" .}}.
+//
+// A PromptTemplate is safe for concurrent use.
+type PromptTemplate[T any] struct {
+	name      string
+	tmpl      *template.Template
+	variables []string
+}
+
+type promptTemplateConfig struct {
+	funcs    template.FuncMap
+	partials []func(t *template.Template) (*template.Template, error)
+}
+
+type PromptTemplateOption func(c *promptTemplateConfig)
+
+// WithTemplateFuncs adds functions to the template. They can't replace the message actions.
+func WithTemplateFuncs(funcs template.FuncMap) PromptTemplateOption {
+	return func(c *promptTemplateConfig) {
+		for name, fn := range funcs {
+			c.funcs[name] = fn
+		}
+	}
+}
+
+// WithPartial adds a partial template, included with {{template "name" .}}.
+func WithPartial(name, text string) PromptTemplateOption {
+	return func(c *promptTemplateConfig) {
+		c.partials = append(c.partials, func(t *template.Template) (*template.Template, error) {
+			return t.New(name).Parse(text)
+		})
+	}
+}
+
+// WithPartialFiles adds the partial templates of the files matching the patterns, such as the files of an embed.FS.
+// Each file is included with its base name, as in {{template "signature.tmpl" .}}.
+func WithPartialFiles(fsys fs.FS, patterns ...string) PromptTemplateOption {
+	return func(c *promptTemplateConfig) {
+		c.partials = append(c.partials, func(t *template.Template) (*template.Template, error) {
+			return t.ParseFS(fsys, patterns...)
+		})
+	}
+}
+
+// messageActions are the functions of the template writing the messages. They write markers, which are replaced
+// at render time by the ones of the rendering, so that the variables can't forge them.
+var messageActions = []string{"system", "user", "assistant", "image"}
+
+// NewPromptTemplate parses the template. When T is a struct, the variables used by the template are checked against
+// its fields.
+// Available options are:
+//   - WithTemplateFuncs
+//   - WithPartial
+//   - WithPartialFiles
+func NewPromptTemplate[T any](name, text string, opts ...PromptTemplateOption) (*PromptTemplate[T], error) {
+	cfg := promptTemplateConfig{funcs: make(template.FuncMap)}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	for _, action := range messageActions {
+		if _, ok := cfg.funcs[action]; ok {
+			return nil, fmt.Errorf("function %s of prompt template %s is reserved", action, name)
+		}
+	}
+
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(messageFuncs("")).
+		Funcs(cfg.funcs).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+	for _, partial := range cfg.partials {
+		if _, err := partial(tmpl); err != nil {
+			return nil, fmt.Errorf("failed to parse partial of prompt template %s: %w", name, err)
+		}
+	}
+
+	t := &PromptTemplate[T]{name: name, tmpl: tmpl, variables: templateVariables(tmpl)}
+	if typ := derefType(reflect.TypeFor[T]()); typ.Kind() == reflect.Struct {
+		if missing := missingFields(typ, t.variables); len(missing) > 0 {
+			return nil, &MissingVariablesError{Template: name, Names: missing}
+		}
+	}
+	return t, nil
+}
+
+// NewPromptTemplateFS parses the template of the file, such as a file of an embed.FS. The template is named
+// after the base name of the file.
+func NewPromptTemplateFS[T any](fsys fs.FS, file string, opts ...PromptTemplateOption) (*PromptTemplate[T], error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template: %w", err)
+	}
+	return NewPromptTemplate[T](path.Base(file), string(data), opts...)
+}
+
+// Name returns the name of the template.
+func (t *PromptTemplate[T]) Name() string {
+	return t.name
+}
+
+// Variables returns the names of the variables used by the template, partials included.
+func (t *PromptTemplate[T]) Variables() []string {
+	return slices.Clone(t.variables)
+}
+
+// Render renders the template with the variables into messages. It returns a MissingVariablesError when the
+// variables lack some of the ones used by the template.
+func (t *PromptTemplate[T]) Render(vars T) ([]ChatMessage, error) {
+	if missing := missingVariables(reflect.ValueOf(vars), t.variables); len(missing) > 0 {
+		return nil, &MissingVariablesError{Template: t.name, Names: missing}
+	}
+
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	sep := "\x00" + hex.EncodeToString(nonce) + "\x00"
+
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render prompt template %s: %w", t.name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(messageFuncs(sep)).Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("failed to render prompt template %s: %w", t.name, err)
+	}
+
+	messages, err := splitMessages(buf.String(), sep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render prompt template %s: %w", t.name, err)
+	}
+	return messages, nil
+}
+
+// messageFuncs returns the message actions, writing directives between the separators.
+func messageFuncs(sep string) template.FuncMap {
+	directive := func(role Role) func() string {
+		return func() string {
+			return sep + string(role) + sep
+		}
+	}
+	return template.FuncMap{
+		"system":    directive(RoleSystem),
+		"user":      directive(RoleUser),
+		"assistant": directive(RoleAssistant),
+		"image": func(url string) string {
+			return sep + "image:" + url + sep
+		},
+	}
+}
+
+// splitMessages builds the messages from the rendered template: the directives and the text alternate between the
+// separators.
+func splitMessages(out, sep string) ([]ChatMessage, error) {
+	parts := strings.Split(out, sep)
+	if strings.TrimSpace(parts[0]) != "" {
+		return nil, errors.New("text outside of a message: start it with {{system}}, {{user}} or {{assistant}}")
+	}
+
+	var messages []ChatMessage
+	var role Role
+	var chunks []ContentChunk
+	flush := func() {
+		if role != "" {
+			messages = append(messages, newTemplateMessage(role, chunks))
+		}
+	}
+	for i := 1; i+1 < len(parts); i += 2 {
+		directive, text := parts[i], parts[i+1]
+		switch {
+		case strings.HasPrefix(directive, "image:"):
+			if role == "" {
+				return nil, errors.New("image outside of a message")
+			}
+			if role != RoleUser {
+				return nil, fmt.Errorf("image in a %s message: images are only allowed in user messages", role)
+			}
+			chunks = append(chunks, NewImageUrlChunk(strings.TrimPrefix(directive, "image:")))
+		default:
+			flush()
+			role, chunks = Role(directive), nil
+		}
+		if text != "" {
+			chunks = append(chunks, NewTextChunk(text))
+		}
+	}
+	flush()
+
+	if len(messages) == 0 {
+		return nil, errors.New("no message")
+	}
+	return messages, nil
+}
+
+// newTemplateMessage returns the message, with the spaces around its content trimmed.
+// Its content is a string, unless it has other chunks than text.
+func newTemplateMessage(role Role, chunks []ContentChunk) ChatMessage {
+	var content Content
+	var text strings.Builder
+	textOnly := true
+	for _, chunk := range chunks {
+		if c, ok := chunk.(*TextChunk); ok {
+			text.WriteString(c.Text)
+		} else {
+			textOnly = false
+		}
+	}
+	if textOnly {
+		content = ContentString(strings.TrimSpace(text.String()))
+	} else {
+		content = trimChunks(chunks)
+	}
+
+	switch role {
+	case RoleSystem:
+		return NewSystemMessage(content)
+	case RoleAssistant:
+		return NewAssistantMessage(content)
+	default:
+		return NewUserMessage(content)
+	}
+}
+
+// trimChunks merges the consecutive text chunks, trims the spaces around the content and drops the empty texts.
+func trimChunks(chunks []ContentChunk) ContentChunks {
+	var merged ContentChunks
+	for _, chunk := range chunks {
+		merged = appendChunk(merged, chunk)
+	}
+	if c, ok := merged[0].(*TextChunk); ok {
+		merged[0] = NewTextChunk(strings.TrimLeft(c.Text, " \t\r\n"))
+	}
+	if c, ok := merged[len(merged)-1].(*TextChunk); ok {
+		merged[len(merged)-1] = NewTextChunk(strings.TrimRight(c.Text, " \t\r\n"))
+	}
+	return slices.DeleteFunc(merged, func(chunk ContentChunk) bool {
+		c, ok := chunk.(*TextChunk)
+		return ok && strings.TrimSpace(c.Text) == ""
+	})
+}
+
+// templateVariables returns the top-level variables used by the template and its partials:
+// the fields of the dot outside of range and with, and the fields of $.
+func templateVariables(tmpl *template.Template) []string {
+	seen := make(map[string]struct{})
+	visited := make(map[string]struct{})
+	var walk func(node parse.Node, root bool)
+	walkTemplate := func(name string) {
+		if _, ok := visited[name]; ok {
+			return
+		}
+		visited[name] = struct{}{}
+		if t := tmpl.Lookup(name); t != nil && t.Tree != nil {
+			walk(t.Tree.Root, true)
+		}
+	}
+	walk = func(node parse.Node, root bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child, root)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, root)
+		case *parse.IfNode:
+			walk(n.Pipe, root)
+			walk(n.List, root)
+			walk(n.ElseList, root)
+		case *parse.RangeNode:
+			walk(n.Pipe, root)
+			walk(n.List, false)
+			walk(n.ElseList, root)
+		case *parse.WithNode:
+			walk(n.Pipe, root)
+			walk(n.List, false)
+			walk(n.ElseList, root)
+		case *parse.TemplateNode:
+			walk(n.Pipe, root)
+			if root && n.Pipe != nil && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+				if _, ok := n.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
+					walkTemplate(n.Name)
+				}
+			}
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd, root)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, root)
+			}
+		case *parse.ChainNode:
+			walk(n.Node, root)
+		case *parse.FieldNode:
+			if root {
+				seen[n.Ident[0]] = struct{}{}
+			}
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				seen[n.Ident[1]] = struct{}{}
+			}
+		}
+	}
+	walkTemplate(tmpl.Name())
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// missingVariables returns the names the variables lack: the keys of a map, or the fields and methods of a struct.
+func missingVariables(v reflect.Value, names []string) []string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return names
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		var missing []string
+		for _, name := range names {
+			if !v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())).IsValid() {
+				missing = append(missing, name)
+			}
+		}
+		return missing
+	case reflect.Struct:
+		return missingFields(v.Type(), names)
+	case reflect.Invalid:
+		return names
+	default:
+		return nil
+	}
+}
+
+func missingFields(typ reflect.Type, names []string) []string {
+	var missing []string
+	for _, name := range names {
+		if _, ok := typ.FieldByName(name); ok {
+			continue
+		}
+		if _, ok := reflect.PointerTo(typ).MethodByName(name); ok {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	return missing
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
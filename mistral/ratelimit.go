@@ -0,0 +1,148 @@
+package mistral
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitState is the rate-limit quota reported by the API in the response headers.
+// Mistral reports a quota by size (tokens) with the ratelimitbysize-* headers; the generic
+// x-ratelimit-* and ratelimit-* headers are also read, for OpenAI compatible deployments.
+type RateLimitState struct {
+	// Limit is the quota over the current window, or -1 if unknown.
+	Limit int
+
+	// Remaining is the quota left over the current window, or -1 if unknown.
+	Remaining int
+
+	// Reset is the time left before the quota is reset, or 0 if unknown.
+	Reset time.Duration
+
+	// QueryCost is the part of the quota consumed by the request, or 0 if unknown.
+	QueryCost int
+
+	// BySize is true when the quota is a number of tokens (ratelimitbysize-* headers)
+	// rather than a number of requests.
+	BySize bool
+}
+
+var rateLimitHeaderPrefixes = []string{"ratelimitbysize-", "x-ratelimit-", "ratelimit-"}
+
+// ParseRateLimitHeaders reads the rate-limit quota from the response headers.
+// It returns false if the headers don't report any.
+func ParseRateLimitHeaders(h http.Header) (RateLimitState, bool) {
+	for _, prefix := range rateLimitHeaderPrefixes {
+		state := RateLimitState{
+			Limit:     headerInt(h, prefix+"limit", -1),
+			Remaining: headerInt(h, prefix+"remaining", -1),
+			QueryCost: headerInt(h, prefix+"query-cost", 0),
+			BySize:    prefix == "ratelimitbysize-",
+		}
+		if reset := headerInt(h, prefix+"reset", -1); reset > 0 {
+			state.Reset = time.Duration(reset) * time.Second
+		}
+		if state.Limit >= 0 || state.Remaining >= 0 || state.Reset > 0 {
+			return state, true
+		}
+	}
+	return RateLimitState{}, false
+}
+
+// remainingRequests estimates the number of requests left before the quota is exhausted, or -1 if unknown.
+// A quota by size only converts into requests with the cost of the last one.
+func (s RateLimitState) remainingRequests() int {
+	if s.Remaining < 0 {
+		return -1
+	}
+	if !s.BySize {
+		return s.Remaining
+	}
+	if s.QueryCost > 0 {
+		return s.Remaining / s.QueryCost
+	}
+	return -1
+}
+
+// exhausted returns true if no request can be made before the quota reset.
+func (s RateLimitState) exhausted() bool {
+	return s.Remaining == 0 || s.remainingRequests() == 0
+}
+
+// parseRetryAfter reads the Retry-After header, either a number of seconds or an HTTP date.
+func parseRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryWait returns how long to wait before retrying the request which got the response:
+// the Retry-After header if any, else the time before the rate-limit reset if the quota is exhausted,
+// else the exponential backoff. Waits requested by the server are capped by retryWaitMax.
+func (c *clientImpl) retryWait(attempt int, resp *http.Response) time.Duration {
+	if wait, ok := parseRetryAfter(resp.Header, time.Now()); ok {
+		return min(wait, c.retryWaitMax)
+	}
+	if state, ok := ParseRateLimitHeaders(resp.Header); ok && state.exhausted() && state.Reset > 0 {
+		return min(state.Reset, c.retryWaitMax)
+	}
+	return c.nextBackoff(attempt)
+}
+
+// adjustLimiter slows down the limiter configured with WithRateLimiter so that the remaining quota
+// lasts until its reset. The limiter never goes faster than its initial limit.
+// A quota by size without query cost can't be counted in requests: it is left to the token limiter
+// (see pendingCall.observeQuota).
+func (c *clientImpl) adjustLimiter(h http.Header) {
+	if c.limiter == nil {
+		return
+	}
+	state, ok := ParseRateLimitHeaders(h)
+	if !ok || state.Reset <= 0 {
+		return
+	}
+	remaining := state.remainingRequests()
+	if remaining < 0 {
+		return
+	}
+
+	limit := rate.Limit(float64(max(remaining, 1)) / state.Reset.Seconds())
+	if limit > c.limiterBaseLimit {
+		limit = c.limiterBaseLimit
+	}
+	c.limiter.SetLimit(limit)
+
+	if remaining == 0 {
+		// Consume the burst, so the next request waits for the reset
+		if tokens := int(c.limiter.Tokens()); tokens > 0 {
+			c.limiter.ReserveN(time.Now(), tokens)
+		}
+	}
+	if c.verbose {
+		logger.Printf("Rate limit: %d requests remaining, reset in %v, limiter set to %.3f req/s",
+			remaining, state.Reset, float64(limit))
+	}
+}
+
+func headerInt(h http.Header, name string, defaultValue int) int {
+	value := strings.TrimSpace(h.Get(name))
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,235 @@
+package mistral_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"golang.org/x/time/rate"
+)
+
+// makeRetryAfterServer answers 429 with the given headers on the first attempt, then succeeds.
+func makeRetryAfterServer(t *testing.T, headers map[string]string, attempts *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(attempts, 1) == 1 {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`))
+	}))
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	ctx := context.Background()
+	inputMsgs := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	testCases := []struct {
+		name    string
+		headers func() map[string]string
+		waitMax time.Duration
+		minWait time.Duration
+		maxWait time.Duration
+	}{
+		{
+			name:    "should wait for the Retry-After seconds",
+			headers: func() map[string]string { return map[string]string{"Retry-After": "1"} },
+			waitMax: 5 * time.Second,
+			minWait: 900 * time.Millisecond,
+			maxWait: 3 * time.Second,
+		},
+		{
+			name: "should wait until the Retry-After date, capped by retryWaitMax",
+			headers: func() map[string]string {
+				return map[string]string{"Retry-After": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}
+			},
+			waitMax: 300 * time.Millisecond,
+			minWait: 300 * time.Millisecond,
+			maxWait: 2 * time.Second,
+		},
+		{
+			name: "should wait for the rate-limit reset when the quota is exhausted",
+			headers: func() map[string]string {
+				return map[string]string{"ratelimitbysize-remaining": "0", "ratelimitbysize-reset": "30"}
+			},
+			waitMax: 200 * time.Millisecond,
+			minWait: 200 * time.Millisecond,
+			maxWait: 2 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			var attempts int32
+			srv := makeRetryAfterServer(t, tc.headers(), &attempts)
+			defer srv.Close()
+
+			c := mistral.New("fake-api-key",
+				mistral.WithBaseApiUrl(srv.URL),
+				mistral.WithRetry(1, 1*time.Millisecond, tc.waitMax),
+			)
+
+			// When
+			start := time.Now()
+			res, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+			elapsed := time.Since(start)
+
+			// Then
+			assert.NoError(t, err)
+			assert.Equal(t, "Hello", res.AssistantMessage().Content().String())
+			assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+			assert.GreaterOrEqual(t, elapsed, tc.minWait)
+			assert.Less(t, elapsed, tc.maxWait)
+		})
+	}
+}
+
+func TestClient_RateLimiterAdjustment(t *testing.T) {
+	ctx := context.Background()
+	inputMsgs := []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")}
+
+	newServer := func(remaining *string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ratelimitbysize-limit", "1000")
+			w.Header().Set("ratelimitbysize-remaining", *remaining)
+			w.Header().Set("ratelimitbysize-query-cost", "10")
+			w.Header().Set("ratelimitbysize-reset", "10")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`))
+		}))
+	}
+
+	t.Run("should slow down the limiter when the quota runs out, then restore it", func(t *testing.T) {
+		// Given
+		remaining := "50" // 5 requests left for 10 seconds
+		srv := newServer(&remaining)
+		defer srv.Close()
+
+		limiter := rate.NewLimiter(rate.Limit(100), 10)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRateLimiter(limiter))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.5, float64(limiter.Limit()), 1e-9)
+
+		// When the quota is restored
+		remaining = "100000"
+		_, err = c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, rate.Limit(100), limiter.Limit())
+	})
+
+	t.Run("should wait for the reset when the quota is exhausted", func(t *testing.T) {
+		// Given
+		remaining := "0"
+		srv := newServer(&remaining)
+		defer srv.Close()
+
+		limiter := rate.NewLimiter(rate.Limit(100), 10)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRateLimiter(limiter))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.1, float64(limiter.Limit()), 1e-9)
+		assert.Less(t, limiter.Tokens(), 1.0)
+	})
+
+	t.Run("should not count the remaining tokens as requests without query cost", func(t *testing.T) {
+		// Given
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ratelimitbysize-remaining", "5")
+			w.Header().Set("ratelimitbysize-reset", "10")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`))
+		}))
+		defer srv.Close()
+
+		limiter := rate.NewLimiter(rate.Limit(100), 10)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRateLimiter(limiter))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, rate.Limit(100), limiter.Limit())
+	})
+
+	t.Run("should count the generic remaining quota as requests", func(t *testing.T) {
+		// Given
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-ratelimit-remaining", "5")
+			w.Header().Set("x-ratelimit-reset", "10")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`))
+		}))
+		defer srv.Close()
+
+		limiter := rate.NewLimiter(rate.Limit(100), 10)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithRateLimiter(limiter))
+
+		// When
+		_, err := c.ChatCompletion(ctx, mistral.NewChatCompletionRequest("mistral-large", inputMsgs))
+
+		// Then
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.5, float64(limiter.Limit()), 1e-9)
+	})
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	t.Run("should parse the Mistral headers", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("ratelimitbysize-limit", "2000000")
+		h.Set("ratelimitbysize-remaining", "1968000")
+		h.Set("ratelimitbysize-query-cost", "32000")
+		h.Set("ratelimitbysize-reset", "20")
+
+		state, ok := mistral.ParseRateLimitHeaders(h)
+
+		assert.True(t, ok)
+		assert.Equal(t, mistral.RateLimitState{
+			Limit:     2000000,
+			Remaining: 1968000,
+			QueryCost: 32000,
+			Reset:     20 * time.Second,
+			BySize:    true,
+		}, state)
+	})
+
+	t.Run("should parse the generic headers", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("x-ratelimit-remaining", "3")
+
+		state, ok := mistral.ParseRateLimitHeaders(h)
+
+		assert.True(t, ok)
+		assert.Equal(t, -1, state.Limit)
+		assert.Equal(t, 3, state.Remaining)
+	})
+
+	t.Run("should report missing headers", func(t *testing.T) {
+		_, ok := mistral.ParseRateLimitHeaders(http.Header{})
+
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,385 @@
+package mistral
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ChatSession is a conversation with a model: it holds the system prompt, the default options of the requests
+// and the history, so that each turn only sends the new messages. The history can be saved in a SessionStore
+// after each turn, and the session serialized as JSON and restored with RestoreChatSession.
+//
+// A ChatSession is safe for concurrent use: the turns are sent one at a time. A streamed turn only holds the session
+// until its request is sent (see SendStream).
+type ChatSession struct {
+	client       Client
+	id           string
+	model        string
+	systemPrompt string
+	options      []ChatCompletionRequestOption
+	store        SessionStore
+
+	mu       sync.Mutex
+	messages []ChatMessage
+}
+
+type SessionOption func(s *ChatSession)
+
+// WithSessionSystemPrompt sets the system prompt, sent before the history in each request. It is not part of
+// the history, so the history managers never drop it.
+func WithSessionSystemPrompt(prompt string) SessionOption {
+	return func(s *ChatSession) {
+		s.systemPrompt = prompt
+	}
+}
+
+// WithSessionRequestOptions sets the options applied to each request of the session, such as the tools
+// or the response format. They are not serialized with the session: give them again when it is restored.
+func WithSessionRequestOptions(opts ...ChatCompletionRequestOption) SessionOption {
+	return func(s *ChatSession) {
+		s.options = append(s.options, opts...)
+	}
+}
+
+// WithSessionStore saves the session in the store, with the given ID, after each turn.
+func WithSessionStore(store SessionStore, id string) SessionOption {
+	return func(s *ChatSession) {
+		s.store = store
+		s.id = id
+	}
+}
+
+// WithSessionHistory sets the messages already exchanged in the session.
+func WithSessionHistory(messages ...ChatMessage) SessionOption {
+	return func(s *ChatSession) {
+		s.messages = append([]ChatMessage(nil), messages...)
+	}
+}
+
+// NewChatSession starts a conversation with the model.
+// Available options are:
+//   - WithSessionSystemPrompt
+//   - WithSessionRequestOptions
+//   - WithSessionStore
+//   - WithSessionHistory
+func NewChatSession(client Client, model string, opts ...SessionOption) *ChatSession {
+	s := &ChatSession{client: client, model: model}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// RestoreChatSession restores a session serialized as JSON. The options are applied after it is restored:
+// the request options must be given again, since they are not serialized.
+func RestoreChatSession(client Client, data []byte, opts ...SessionOption) (*ChatSession, error) {
+	s := &ChatSession{client: client}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to restore session: %w", err)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// LoadChatSession restores the session saved in the store with the ID, and keeps saving it there after each turn.
+// It returns ErrSessionNotFound if the store has no such session.
+func LoadChatSession(ctx context.Context, client Client, store SessionStore, id string, opts ...SessionOption) (*ChatSession, error) {
+	data, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return RestoreChatSession(client, data, append([]SessionOption{WithSessionStore(store, id)}, opts...)...)
+}
+
+// ID returns the ID of the session in its store, or an empty string if it is not stored.
+func (s *ChatSession) ID() string {
+	return s.id
+}
+
+// Model returns the model of the session.
+func (s *ChatSession) Model() string {
+	return s.model
+}
+
+// SystemPrompt returns the system prompt of the session.
+func (s *ChatSession) SystemPrompt() string {
+	return s.systemPrompt
+}
+
+// Messages returns a copy of the history, without the system prompt.
+func (s *ChatSession) Messages() []ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ChatMessage(nil), s.messages...)
+}
+
+// Reset clears the history and saves the session.
+func (s *ChatSession) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	return s.save(ctx)
+}
+
+// Send sends the messages, usually a user message or the results of the tools called by the model,
+// following the history. The messages and the answer of the model are appended to the history, then the session
+// is saved. The history is left untouched when the call fails; when only the save fails, the response is returned
+// with the error.
+func (s *ChatSession) Send(ctx context.Context, messages ...ChatMessage) (*ChatCompletionResponse, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("no message to send")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.client.ChatCompletion(ctx, NewChatCompletionRequest(s.model, s.prompt(messages), s.options...))
+	if err != nil {
+		return nil, err
+	}
+	reply := res.AssistantMessage()
+	if reply == nil {
+		return nil, errors.New("the response has no message")
+	}
+
+	s.messages = append(append(s.messages, messages...), reply)
+	if err := s.save(ctx); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// SendStream is the streaming version of Send. The messages and the answer of the model are appended to the history
+// once the stream ends with a finish reason: the history is left untouched when the stream fails or is canceled.
+// If the session can't be saved, a last chunk carries the error.
+//
+// The session is released as soon as the request is sent: a turn sent while the answer is streamed doesn't see
+// the messages of this one. Cancel the context to abandon the stream before its end.
+func (s *ChatSession) SendStream(ctx context.Context, messages ...ChatMessage) (<-chan *CompletionChunk, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("no message to send")
+	}
+
+	s.mu.Lock()
+	req := NewChatCompletionStreamRequest(s.model, s.prompt(messages), s.options...)
+	chunks, err := s.client.ChatCompletionStream(ctx, req)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *CompletionChunk)
+	go func() {
+		defer close(out)
+
+		var reply streamedReply
+		for chunk := range chunks {
+			reply.add(chunk)
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// The reader is gone: drain the stream, which ends with the context
+				for range chunks {
+				}
+				return
+			}
+		}
+		if !reply.complete() {
+			return
+		}
+
+		s.mu.Lock()
+		s.messages = append(append(s.messages, messages...), reply.message())
+		err := s.save(ctx)
+		s.mu.Unlock()
+		if err != nil {
+			select {
+			case out <- &CompletionChunk{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// prompt returns the messages of the request: the system prompt, the history and the new messages.
+func (s *ChatSession) prompt(messages []ChatMessage) []ChatMessage {
+	prompt := make([]ChatMessage, 0, len(s.messages)+len(messages)+1)
+	if s.systemPrompt != "" {
+		prompt = append(prompt, NewSystemMessageFromString(s.systemPrompt))
+	}
+	prompt = append(prompt, s.messages...)
+	return append(prompt, messages...)
+}
+
+func (s *ChatSession) save(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	data, err := s.marshal()
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	if err := s.store.Save(ctx, s.id, data); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+type sessionJSON struct {
+	ID           string `json:"id,omitempty"`
+	Model        string `json:"model"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+}
+
+var _ json.Marshaler = (*ChatSession)(nil)
+var _ json.Unmarshaler = (*ChatSession)(nil)
+
+// MarshalJSON serializes the ID, the model, the system prompt and the history of the session.
+func (s *ChatSession) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.marshal()
+}
+
+func (s *ChatSession) marshal() ([]byte, error) {
+	return json.Marshal(struct {
+		sessionJSON
+		Messages []ChatMessage `json:"messages"`
+	}{
+		sessionJSON: sessionJSON{ID: s.id, Model: s.model, SystemPrompt: s.systemPrompt},
+		Messages:    s.messages,
+	})
+}
+
+func (s *ChatSession) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		sessionJSON
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	messages := make([]ChatMessage, 0, len(aux.Messages))
+	for _, msg := range aux.Messages {
+		m, err := mapToMessage(msg)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id, s.model, s.systemPrompt = aux.ID, aux.Model, aux.SystemPrompt
+	s.messages = messages
+	return nil
+}
+
+// streamedReply rebuilds the assistant message from the deltas of a stream.
+type streamedReply struct {
+	chunks    []ContentChunk
+	toolCalls []ToolCall
+	finished  bool
+	failed    bool
+}
+
+func (r *streamedReply) add(chunk *CompletionChunk) {
+	if chunk.Error != nil {
+		r.failed = true
+		return
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+	if choice.FinishReason != "" {
+		r.finished = true
+	}
+	if choice.Delta == nil {
+		return
+	}
+
+	if content := choice.Delta.Content(); content != nil {
+		if text := content.String(); text != "" {
+			r.chunks = appendChunk(r.chunks, NewTextChunk(text))
+		}
+		for _, c := range content.Chunks() {
+			r.chunks = appendChunk(r.chunks, c)
+		}
+	}
+	for _, call := range choice.Delta.ToolCalls {
+		r.addToolCall(call)
+	}
+}
+
+// addToolCall adds the tool call, or completes the one with the same index.
+func (r *streamedReply) addToolCall(call ToolCall) {
+	for i := range r.toolCalls {
+		prev := &r.toolCalls[i]
+		if prev.Index != call.Index || (call.ID != "" && prev.ID != "" && prev.ID != call.ID) {
+			continue
+		}
+		if prev.ID == "" {
+			prev.ID = call.ID
+		}
+		if prev.Function.Name == "" {
+			prev.Function.Name = call.Function.Name
+		}
+		if prev.Function.Arguments == nil {
+			prev.Function.Arguments = JsonMap{}
+		}
+		for k, v := range call.Function.Arguments {
+			prev.Function.Arguments[k] = v
+		}
+		return
+	}
+	r.toolCalls = append(r.toolCalls, call)
+}
+
+func (r *streamedReply) complete() bool {
+	return r.finished && !r.failed
+}
+
+// message returns the assistant message. Its content is a string, unless the model sent other chunks than text.
+func (r *streamedReply) message() *AssistantMessage {
+	var content Content = ContentString("")
+	switch {
+	case len(r.chunks) == 1 && r.chunks[0].Type() == ContentTypeText:
+		content = ContentString(r.chunks[0].(*TextChunk).Text)
+	case len(r.chunks) > 0:
+		content = ContentChunks(r.chunks)
+	}
+	return NewAssistantMessage(content, r.toolCalls...)
+}
+
+// appendChunk appends the chunk, merging it with the last one when both are text or thinking.
+func appendChunk(chunks []ContentChunk, chunk ContentChunk) []ContentChunk {
+	if len(chunks) > 0 {
+		switch last := chunks[len(chunks)-1].(type) {
+		case *TextChunk:
+			if c, ok := chunk.(*TextChunk); ok {
+				chunks[len(chunks)-1] = NewTextChunk(last.Text + c.Text)
+				return chunks
+			}
+		case *ThinkChunk:
+			if c, ok := chunk.(*ThinkChunk); ok {
+				merged := *last
+				merged.Thinking = append([]ContentChunk(nil), last.Thinking...)
+				for _, t := range c.Thinking {
+					merged.Thinking = appendChunk(merged.Thinking, t)
+				}
+				merged.Closed = c.Closed
+				chunks[len(chunks)-1] = &merged
+				return chunks
+			}
+		}
+	}
+	return append(chunks, chunk)
+}
@@ -0,0 +1,113 @@
+package mistral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrSessionNotFound is returned by the SessionStore when no session is saved with the ID.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore persists the chat sessions, serialized as JSON, by session ID.
+type SessionStore interface {
+	// Load returns the saved session, or ErrSessionNotFound.
+	Load(ctx context.Context, id string) ([]byte, error)
+
+	// Save saves the session, replacing the previous one with the same ID.
+	Save(ctx context.Context, id string, data []byte) error
+
+	// Delete removes the session. It doesn't fail when the session doesn't exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemorySessionStore keeps the sessions in memory, for the lifetime of the process.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string][]byte
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string][]byte)}
+}
+
+func (s *MemorySessionStore) Load(_ context.Context, id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemorySessionStore) Save(_ context.Context, id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// FileSessionStore saves each session in a JSON file of a directory, named after the session ID.
+type FileSessionStore struct {
+	dir string
+}
+
+var _ SessionStore = (*FileSessionStore)(nil)
+
+// NewFileSessionStore returns a store saving the sessions in the directory, which is created if needed.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create session dir: %w", err)
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (s *FileSessionStore) Load(_ context.Context, id string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+	return data, nil
+}
+
+func (s *FileSessionStore) Save(_ context.Context, id string, data []byte) error {
+	// The file is replaced at once, so that a crash doesn't leave a truncated session
+	path := s.path(id)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSessionStore) Delete(_ context.Context, id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete session file: %w", err)
+	}
+	return nil
+}
+
+// path returns the file of the session. The ID is escaped, so that it can't point outside the directory.
+func (s *FileSessionStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
@@ -0,0 +1,257 @@
+package mistral_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestChatSession_Send(t *testing.T) {
+	ctx := context.TODO()
+
+	// newMockClient answers each request with the given replies, in turn, and records the sent messages.
+	newMockClient := func(t *testing.T, replies ...string) (*mocks.MockClient, *[][]mistral.ChatMessage) {
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		var sent [][]mistral.ChatMessage
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, req *mistral.ChatCompletionRequest) (*mistral.ChatCompletionResponse, error) {
+				sent = append(sent, req.Messages)
+				assert.Equal(t, mistral.ToolChoiceNone, req.ToolChoice)
+				reply := replies[len(sent)-1]
+				return &mistral.ChatCompletionResponse{
+					Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString(reply)}},
+				}, nil
+			}).
+			Times(len(replies))
+		return mockClient, &sent
+	}
+
+	t.Run("should send the history and append the answers", func(t *testing.T) {
+		// Given
+		mockClient, sent := newMockClient(t, "Hello!", "Fine, thanks.")
+		s := mistral.NewChatSession(mockClient, "mistral-small-latest",
+			mistral.WithSessionSystemPrompt("You are a helpful assistant."),
+			mistral.WithSessionRequestOptions(mistral.WithToolChoice(mistral.ToolChoiceNone)))
+
+		// When
+		_, err1 := s.Send(ctx, mistral.NewUserMessageFromString("Hi!"))
+		res, err2 := s.Send(ctx, mistral.NewUserMessageFromString("How are you?"))
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.Equal(t, "Fine, thanks.", res.AssistantMessage().Content().String())
+		assert.Equal(t, []mistral.ChatMessage{
+			mistral.NewSystemMessageFromString("You are a helpful assistant."),
+			mistral.NewUserMessageFromString("Hi!"),
+			mistral.NewAssistantMessageFromString("Hello!"),
+			mistral.NewUserMessageFromString("How are you?"),
+		}, (*sent)[1])
+		assert.Equal(t, []mistral.ChatMessage{
+			mistral.NewUserMessageFromString("Hi!"),
+			mistral.NewAssistantMessageFromString("Hello!"),
+			mistral.NewUserMessageFromString("How are you?"),
+			mistral.NewAssistantMessageFromString("Fine, thanks."),
+		}, s.Messages())
+	})
+
+	t.Run("should leave the history untouched when the call fails", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("boom"))
+		s := mistral.NewChatSession(mockClient, "mistral-small-latest",
+			mistral.WithSessionHistory(mistral.NewUserMessageFromString("Hi!"), mistral.NewAssistantMessageFromString("Hello!")))
+
+		// When
+		_, err := s.Send(ctx, mistral.NewUserMessageFromString("How are you?"))
+
+		// Then
+		assert.EqualError(t, err, "boom")
+		assert.Len(t, s.Messages(), 2)
+	})
+
+	t.Run("should save the session in the store and load it back", func(t *testing.T) {
+		// Given
+		store, err := mistral.NewFileSessionStore(t.TempDir())
+		assert.NoError(t, err)
+		mockClient, sent := newMockClient(t, "Hello!", "Paris.")
+		s := mistral.NewChatSession(mockClient, "mistral-small-latest",
+			mistral.WithSessionSystemPrompt("You are a helpful assistant."),
+			mistral.WithSessionRequestOptions(mistral.WithToolChoice(mistral.ToolChoiceNone)),
+			mistral.WithSessionStore(store, "user/42"))
+		_, err = s.Send(ctx, mistral.NewUserMessageFromString("Hi!"))
+		assert.NoError(t, err)
+
+		// When
+		restored, err := mistral.LoadChatSession(ctx, mockClient, store, "user/42",
+			mistral.WithSessionRequestOptions(mistral.WithToolChoice(mistral.ToolChoiceNone)))
+		assert.NoError(t, err)
+		_, err = restored.Send(ctx, mistral.NewUserMessageFromString("Where is the Eiffel tower?"))
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "user/42", restored.ID())
+		assert.Equal(t, "mistral-small-latest", restored.Model())
+		assert.Equal(t, "You are a helpful assistant.", restored.SystemPrompt())
+		assert.Len(t, (*sent)[1], 4)
+
+		saved, err := mistral.LoadChatSession(ctx, mockClient, store, "user/42")
+		assert.NoError(t, err)
+		assert.Equal(t, restored.Messages(), saved.Messages())
+	})
+}
+
+func TestChatSession_SendStream(t *testing.T) {
+	ctx := context.TODO()
+
+	newChunk := func(content string, finishReason mistral.FinishReason) *mistral.CompletionChunk {
+		return &mistral.CompletionChunk{Choices: []mistral.CompletionResponseStreamChoice{{
+			Delta:        mistral.NewAssistantMessageFromString(content),
+			FinishReason: finishReason,
+		}}}
+	}
+	newMockClient := func(t *testing.T, chunks ...*mistral.CompletionChunk) *mocks.MockClient {
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			ChatCompletionStream(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, req *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+				assert.True(t, req.Stream)
+				ch := make(chan *mistral.CompletionChunk, len(chunks))
+				for _, chunk := range chunks {
+					ch <- chunk
+				}
+				close(ch)
+				return ch, nil
+			})
+		return mockClient
+	}
+
+	t.Run("should append the streamed answer", func(t *testing.T) {
+		// Given
+		store := mistral.NewMemorySessionStore()
+		mockClient := newMockClient(t, newChunk("Hello", ""), newChunk(" world", ""), newChunk("!", mistral.FinishReasonStop))
+		s := mistral.NewChatSession(mockClient, "mistral-small-latest", mistral.WithSessionStore(store, "s1"))
+
+		// When
+		chunks, err := s.SendStream(ctx, mistral.NewUserMessageFromString("Hi!"))
+		assert.NoError(t, err)
+		var received int
+		for range chunks {
+			received++
+		}
+
+		// Then
+		assert.Equal(t, 3, received)
+		assert.Equal(t, []mistral.ChatMessage{
+			mistral.NewUserMessageFromString("Hi!"),
+			mistral.NewAssistantMessageFromString("Hello world!"),
+		}, s.Messages())
+		_, err = store.Load(ctx, "s1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("should not append an interrupted answer", func(t *testing.T) {
+		// Given
+		mockClient := newMockClient(t, newChunk("Hello", ""), &mistral.CompletionChunk{Error: errors.New("boom")})
+		s := mistral.NewChatSession(mockClient, "mistral-small-latest")
+
+		// When
+		chunks, err := s.SendStream(ctx, mistral.NewUserMessageFromString("Hi!"))
+		assert.NoError(t, err)
+		for range chunks {
+		}
+
+		// Then
+		assert.Empty(t, s.Messages())
+	})
+
+	t.Run("should not block the next turns when the stream is abandoned", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		upstream := make(chan *mistral.CompletionChunk)
+		defer close(upstream)
+		mockClient.EXPECT().ChatCompletionStream(gomock.Any(), gomock.Any()).Return(upstream, nil)
+		mockClient.EXPECT().
+			ChatCompletion(gomock.Any(), gomock.Any()).
+			Return(&mistral.ChatCompletionResponse{
+				Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Hello")}},
+			}, nil)
+		s := mistral.NewChatSession(mockClient, "mistral-small-latest")
+
+		_, err := s.SendStream(ctx, mistral.NewUserMessageFromString("Hi!"))
+		assert.NoError(t, err)
+
+		// When
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.Send(ctx, mistral.NewUserMessageFromString("Hello?"))
+			done <- err
+		}()
+
+		// Then
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("the turn is blocked by the abandoned stream")
+		}
+	})
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	ctx := context.TODO()
+	store := mistral.NewMemorySessionStore()
+
+	_, err := store.Load(ctx, "s1")
+	assert.ErrorIs(t, err, mistral.ErrSessionNotFound)
+
+	assert.NoError(t, store.Save(ctx, "s1", []byte(`{"model":"mistral-small-latest"}`)))
+	data, err := store.Load(ctx, "s1")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"model":"mistral-small-latest"}`, string(data))
+
+	assert.NoError(t, store.Delete(ctx, "s1"))
+	_, err = store.Load(ctx, "s1")
+	assert.ErrorIs(t, err, mistral.ErrSessionNotFound)
+}
+
+func TestRestoreChatSession(t *testing.T) {
+	t.Run("should restore the history with the tool calls", func(t *testing.T) {
+		// Given
+		history := []mistral.ChatMessage{
+			mistral.NewUserMessageFromString("What's the weather in Paris?"),
+			mistral.NewAssistantMessageFromString("",
+				mistral.NewToolCall("call1", 0, "get_weather", mistral.JsonMap{"city": "Paris"})),
+			mistral.NewToolMessage("get_weather", "call1", mistral.ContentString("sunny")),
+			mistral.NewAssistantMessageFromString("It's sunny."),
+		}
+		s := mistral.NewChatSession(nil, "mistral-small-latest",
+			mistral.WithSessionSystemPrompt("You are a weather assistant."),
+			mistral.WithSessionHistory(history...))
+
+		// When
+		data, err := json.Marshal(s)
+		assert.NoError(t, err)
+		restored, err := mistral.RestoreChatSession(nil, data)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, "mistral-small-latest", restored.Model())
+		assert.Equal(t, "You are a weather assistant.", restored.SystemPrompt())
+		assert.Equal(t, history, restored.Messages())
+	})
+}
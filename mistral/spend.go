@@ -0,0 +1,245 @@
+package mistral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// ErrBudgetExceeded matches the errors of the calls rejected because their budget is spent
+// (see BudgetExceededError).
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// BudgetExceededError is returned, without calling the API, when the spend of the tag of the call, or the total spend,
+// has reached its budget. It matches ErrBudgetExceeded with errors.Is.
+type BudgetExceededError struct {
+	// Tag is the tag whose budget is spent, or empty for the total budget.
+	Tag string
+
+	Budget float64
+	Spent  float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Tag == "" {
+		return fmt.Sprintf("total budget exceeded: spent %.4f of %.4f", e.Spent, e.Budget)
+	}
+	return fmt.Sprintf("budget of %s exceeded: spent %.4f of %.4f", e.Tag, e.Spent, e.Budget)
+}
+
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+type costTagKey struct{}
+
+// WithCostTag returns a context whose calls are accounted to the tag by the SpendTracker,
+// such as a customer, a feature or a tenant.
+func WithCostTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, costTagKey{}, tag)
+}
+
+// CostTagFromContext returns the tag set with WithCostTag, or an empty string.
+func CostTagFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(costTagKey{}).(string)
+	return tag
+}
+
+// SpendTracker accumulates the cost of the calls per tag, from their UsageInfo and a PricingTable,
+// and enforces the budgets. Use it with NewSpendTracking.
+//
+// A budget only rejects the calls made once it is reached: the call which crosses it is not interrupted,
+// since its cost is only known from its response.
+type SpendTracker struct {
+	pricing     *PricingTable
+	budgets     map[string]float64
+	totalBudget float64
+
+	mu    sync.Mutex
+	spend map[string]float64
+	total float64
+}
+
+type SpendTrackerOption func(t *SpendTracker)
+
+// WithBudget sets the budget of the tag. The untagged calls are accounted to the empty tag.
+func WithBudget(tag string, budget float64) SpendTrackerOption {
+	return func(t *SpendTracker) {
+		t.budgets[tag] = budget
+	}
+}
+
+// WithTotalBudget sets the budget of all the calls, whatever their tag.
+func WithTotalBudget(budget float64) SpendTrackerOption {
+	return func(t *SpendTracker) {
+		t.totalBudget = budget
+	}
+}
+
+// NewSpendTracker returns a tracker computing the costs with the pricing table, or with DefaultPricingTable if nil.
+// Available options are:
+//   - WithBudget
+//   - WithTotalBudget
+func NewSpendTracker(pricing *PricingTable, opts ...SpendTrackerOption) *SpendTracker {
+	if pricing == nil {
+		pricing = DefaultPricingTable()
+	}
+	t := &SpendTracker{
+		pricing: pricing,
+		budgets: make(map[string]float64),
+		spend:   make(map[string]float64),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Spend returns the spend of the tag.
+func (t *SpendTracker) Spend(tag string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spend[tag]
+}
+
+// Spends returns the spend of each tag.
+func (t *SpendTracker) Spends() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return maps.Clone(t.spend)
+}
+
+// Total returns the spend of all the tags.
+func (t *SpendTracker) Total() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// Reset clears the spend of the tag, for instance at the start of a billing period.
+func (t *SpendTracker) Reset(tag string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total -= t.spend[tag]
+	delete(t.spend, tag)
+}
+
+// Record accounts the usage of the model to the tag.
+func (t *SpendTracker) Record(tag, model string, usage UsageInfo) error {
+	cost, err := t.pricing.UsageCost(model, usage)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spend[tag] += cost
+	t.total += cost
+	return nil
+}
+
+// check returns a BudgetExceededError if the budget of the tag, or the total budget, is spent.
+func (t *SpendTracker) check(tag string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if budget, ok := t.budgets[tag]; ok && t.spend[tag] >= budget {
+		return &BudgetExceededError{Tag: tag, Budget: budget, Spent: t.spend[tag]}
+	}
+	if t.totalBudget > 0 && t.total >= t.totalBudget {
+		return &BudgetExceededError{Budget: t.totalBudget, Spent: t.total}
+	}
+	return nil
+}
+
+// record accounts the usage, logging the models without price rather than failing the call which was served.
+func (t *SpendTracker) record(tag, model string, usage UsageInfo) {
+	if err := t.Record(tag, model, usage); err != nil {
+		logger.Printf("Spend of the call not tracked: %v", err)
+	}
+}
+
+type spendClientDecorator struct {
+	Client
+
+	tracker *SpendTracker
+}
+
+var _ Client = (*spendClientDecorator)(nil)
+
+// NewSpendTracking decorates a client to account the cost of the chat completions and embeddings to the tag of their
+// context (see WithCostTag), and to reject the calls once their budget is spent with a BudgetExceededError.
+// The responses served by the cache cost nothing.
+func NewSpendTracking(client Client, tracker *SpendTracker) Client {
+	return &spendClientDecorator{Client: client, tracker: tracker}
+}
+
+func (c *spendClientDecorator) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	tag := CostTagFromContext(ctx)
+	if err := c.tracker.check(tag); err != nil {
+		return nil, err
+	}
+	res, err := c.Client.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Usage != nil && !res.Metadata.FromCache {
+		c.tracker.record(tag, servingModel(res.Model, req.Model), *res.Usage)
+	}
+	return res, nil
+}
+
+func (c *spendClientDecorator) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (<-chan *CompletionChunk, error) {
+	tag := CostTagFromContext(ctx)
+	if err := c.tracker.check(tag); err != nil {
+		return nil, err
+	}
+	chunks, err := c.Client.ChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *CompletionChunk)
+	go func() {
+		defer close(out)
+		reading := true
+		for chunk := range chunks {
+			if chunk.Usage != nil && !chunk.Metadata.FromCache {
+				c.tracker.record(tag, servingModel(chunk.Model, req.Model), *chunk.Usage)
+			}
+			if !reading {
+				continue
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// The reader is gone: drain the stream, which ends with the context, still tracking its usage
+				reading = false
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (c *spendClientDecorator) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	tag := CostTagFromContext(ctx)
+	if err := c.tracker.check(tag); err != nil {
+		return nil, err
+	}
+	res, err := c.Client.Embeddings(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Metadata.FromCache {
+		c.tracker.record(tag, servingModel(res.Model, req.Model), res.Usage)
+	}
+	return res, nil
+}
+
+// servingModel returns the model reported by the response, or the one of the request.
+func servingModel(reported, requested string) string {
+	if reported != "" {
+		return reported
+	}
+	return requested
+}
@@ -0,0 +1,204 @@
+package mistral_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSpendClientDecorator(t *testing.T) {
+	pricing := mistral.NewPricingTable(map[string]mistral.ModelPrice{
+		"mistral-small": {Input: 1, Output: 2},
+		"mistral-embed": {Input: 1},
+	})
+	chatResponse := &mistral.ChatCompletionResponse{
+		Model:   "mistral-small-2506",
+		Choices: []mistral.ChatCompletionChoice{{Message: mistral.NewAssistantMessageFromString("Hello")}},
+		Usage:   &mistral.UsageInfo{PromptTokens: 1_000_000, CompletionTokens: 1_000_000},
+	}
+	req := mistral.NewChatCompletionRequest("mistral-small-latest",
+		[]mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")})
+
+	t.Run("should accumulate the spend per tag", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().ChatCompletion(gomock.Any(), gomock.Any()).Return(chatResponse, nil).Times(3)
+		mockClient.EXPECT().
+			Embeddings(gomock.Any(), gomock.Any()).
+			Return(&mistral.EmbeddingResponse{Model: "mistral-embed", Usage: mistral.UsageInfo{PromptTokens: 500_000}}, nil)
+		tracker := mistral.NewSpendTracker(pricing)
+		c := mistral.NewSpendTracking(mockClient, tracker)
+		acme := mistral.WithCostTag(context.TODO(), "acme")
+
+		// When
+		_, err1 := c.ChatCompletion(acme, req)
+		_, err2 := c.ChatCompletion(acme, req)
+		_, err3 := c.ChatCompletion(context.TODO(), req)
+		_, err4 := c.Embeddings(acme, mistral.NewEmbeddingRequest("mistral-embed", []string{"Hi!"}))
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.NoError(t, err3)
+		assert.NoError(t, err4)
+		assert.InDelta(t, 6.5, tracker.Spend("acme"), 1e-9)
+		assert.InDelta(t, 3.0, tracker.Spend(""), 1e-9)
+		assert.InDelta(t, 9.5, tracker.Total(), 1e-9)
+		assert.Len(t, tracker.Spends(), 2)
+	})
+
+	t.Run("should reject the calls once the budget is spent", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().ChatCompletion(gomock.Any(), gomock.Any()).Return(chatResponse, nil).Times(3)
+		tracker := mistral.NewSpendTracker(pricing, mistral.WithBudget("acme", 5))
+		c := mistral.NewSpendTracking(mockClient, tracker)
+		acme := mistral.WithCostTag(context.TODO(), "acme")
+
+		// When
+		_, err1 := c.ChatCompletion(acme, req)
+		_, err2 := c.ChatCompletion(acme, req) // crosses the budget
+		_, err3 := c.ChatCompletion(acme, req)
+		_, errOther := c.ChatCompletion(mistral.WithCostTag(context.TODO(), "globex"), req)
+
+		// Then
+		assert.NoError(t, err1)
+		assert.NoError(t, err2)
+		assert.ErrorIs(t, err3, mistral.ErrBudgetExceeded)
+		var exceeded *mistral.BudgetExceededError
+		assert.ErrorAs(t, err3, &exceeded)
+		assert.Equal(t, "acme", exceeded.Tag)
+		assert.InDelta(t, 6.0, exceeded.Spent, 1e-9)
+		assert.NoError(t, errOther)
+
+		// When the spend is reset
+		tracker.Reset("acme")
+
+		// Then
+		assert.InDelta(t, 3.0, tracker.Total(), 1e-9)
+	})
+
+	t.Run("should enforce the total budget and track the streams", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			ChatCompletionStream(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+				ch := make(chan *mistral.CompletionChunk, 2)
+				ch <- &mistral.CompletionChunk{Model: "mistral-small-2506"}
+				ch <- &mistral.CompletionChunk{Model: "mistral-small-2506", Usage: &mistral.UsageInfo{PromptTokens: 2_000_000}}
+				close(ch)
+				return ch, nil
+			})
+		tracker := mistral.NewSpendTracker(pricing, mistral.WithTotalBudget(2))
+		c := mistral.NewSpendTracking(mockClient, tracker)
+
+		// When
+		chunks, err := c.ChatCompletionStream(context.TODO(), req)
+		assert.NoError(t, err)
+		for range chunks {
+		}
+		_, errAfter := c.ChatCompletionStream(context.TODO(), req)
+
+		// Then
+		assert.InDelta(t, 2.0, tracker.Total(), 1e-9)
+		assert.ErrorIs(t, errAfter, mistral.ErrBudgetExceeded)
+	})
+
+	t.Run("should drain the stream and track its usage when the reader is gone", func(t *testing.T) {
+		// Given
+		ctx, cancel := context.WithCancel(context.Background())
+		upstreamDone := make(chan struct{})
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			ChatCompletionStream(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ *mistral.ChatCompletionRequest) (<-chan *mistral.CompletionChunk, error) {
+				ch := make(chan *mistral.CompletionChunk)
+				go func() {
+					defer close(upstreamDone)
+					defer close(ch)
+					ch <- &mistral.CompletionChunk{Model: "mistral-small-2506"}
+					ch <- &mistral.CompletionChunk{Model: "mistral-small-2506"}
+					ch <- &mistral.CompletionChunk{Model: "mistral-small-2506", Usage: &mistral.UsageInfo{PromptTokens: 1_000_000}}
+				}()
+				return ch, nil
+			})
+		tracker := mistral.NewSpendTracker(pricing)
+		c := mistral.NewSpendTracking(mockClient, tracker)
+
+		// When
+		chunks, err := c.ChatCompletionStream(ctx, req)
+		assert.NoError(t, err)
+		<-chunks
+		cancel()
+
+		// Then
+		select {
+		case <-upstreamDone:
+		case <-time.After(time.Second):
+			t.Fatal("the stream was not drained")
+		}
+		assert.Eventually(t, func() bool { return tracker.Total() > 0 }, time.Second, time.Millisecond)
+		assert.InDelta(t, 1.0, tracker.Total(), 1e-9)
+	})
+
+	t.Run("should not charge the cached responses", func(t *testing.T) {
+		// Given
+		cached := *chatResponse
+		cached.Metadata.FromCache = true
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().ChatCompletion(gomock.Any(), gomock.Any()).Return(&cached, nil)
+		tracker := mistral.NewSpendTracker(pricing)
+
+		// When
+		_, err := mistral.NewSpendTracking(mockClient, tracker).ChatCompletion(context.TODO(), req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Zero(t, tracker.Total())
+	})
+
+	t.Run("should only charge the embeddings of the inputs missing from the cache", func(t *testing.T) {
+		// Given
+		ctrl := gomock.NewController(t)
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().
+			Embeddings(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, req *mistral.EmbeddingRequest) (*mistral.EmbeddingResponse, error) {
+				res := &mistral.EmbeddingResponse{
+					Model: "mistral-embed",
+					Usage: mistral.UsageInfo{PromptTokens: 500_000 * len(req.Input)},
+				}
+				for i := range req.Input {
+					res.Data = append(res.Data, mistral.EmbeddingData{Index: i, Embedding: []float32{0.1}})
+				}
+				return res, nil
+			}).
+			Times(2)
+		engine, err := mistral.NewLocalFsCacheEngine(t.TempDir())
+		assert.NoError(t, err)
+		tracker := mistral.NewSpendTracker(pricing)
+		c := mistral.NewSpendTracking(mistral.NewCached(mockClient, engine), tracker)
+
+		_, err = c.Embeddings(context.TODO(), mistral.NewEmbeddingRequest("mistral-embed", []string{"hello"}))
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.5, tracker.Total(), 1e-9)
+
+		// When
+		_, err = c.Embeddings(context.TODO(), mistral.NewEmbeddingRequest("mistral-embed", []string{"hello", "world", "!"}))
+
+		// Then
+		assert.NoError(t, err)
+		assert.InDelta(t, 0.5+1.0, tracker.Total(), 1e-9, "only world and ! are fetched")
+	})
+}
@@ -0,0 +1,318 @@
+package mistral
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// Endpoint identifies a group of API endpoints sharing a rate-limit budget.
+type Endpoint string
+
+const (
+	EndpointChatCompletions Endpoint = "chat/completions"
+	EndpointEmbeddings      Endpoint = "embeddings"
+	EndpointModels          Endpoint = "models"
+)
+
+// charsPerToken is the average number of characters per token used to estimate the size of a prompt.
+const charsPerToken = 4
+
+// TokenLimiter limits the number of tokens consumed per minute.
+//
+// Before a call, the client reserves the estimated prompt tokens plus the MaxTokens of the request,
+// waiting if the budget is exhausted. Once the response is received, the reservation is reconciled
+// with the actual usage reported by the API: unused tokens are given back, and extra ones are taken
+// from the budget of the next calls.
+//
+// Each model has its own budget, and each endpoint can have an additional budget shared by all
+// its models. A call must fit in both. Requests to the models endpoints don't consume tokens:
+// they cost 1 each, so the budget of EndpointModels is a number of requests per minute.
+//
+// A TokenLimiter is safe for concurrent use and can be shared between clients.
+type TokenLimiter struct {
+	defaultBudget   int
+	modelBudgets    map[string]int
+	endpointBudgets map[Endpoint]int
+
+	mu        sync.Mutex
+	models    map[string]*tokenBucket
+	endpoints map[Endpoint]*tokenBucket
+}
+
+type TokenLimiterOption func(l *TokenLimiter)
+
+// WithModelTokenBudget sets the number of tokens per minute of a model, overriding the default budget.
+// A budget of 0 means unlimited.
+func WithModelTokenBudget(model string, tokensPerMinute int) TokenLimiterOption {
+	return func(l *TokenLimiter) {
+		l.modelBudgets[model] = tokensPerMinute
+	}
+}
+
+// WithEndpointTokenBudget sets the number of tokens per minute shared by all the models of an endpoint.
+// Endpoints have no budget by default.
+func WithEndpointTokenBudget(endpoint Endpoint, tokensPerMinute int) TokenLimiterOption {
+	return func(l *TokenLimiter) {
+		l.endpointBudgets[endpoint] = tokensPerMinute
+	}
+}
+
+// NewTokenLimiter creates a token limiter giving each model a budget of tokensPerMinute
+// (0 means unlimited, unless a budget is set with WithModelTokenBudget). Available options are:
+//   - WithModelTokenBudget
+//   - WithEndpointTokenBudget
+func NewTokenLimiter(tokensPerMinute int, opts ...TokenLimiterOption) *TokenLimiter {
+	l := &TokenLimiter{
+		defaultBudget:   tokensPerMinute,
+		modelBudgets:    make(map[string]int),
+		endpointBudgets: make(map[Endpoint]int),
+		models:          make(map[string]*tokenBucket),
+		endpoints:       make(map[Endpoint]*tokenBucket),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Reserve reserves tokens on the budgets of the endpoint and the model, waiting until they are available.
+// An empty model only uses the budget of the endpoint.
+// If the context is canceled while waiting, the tokens are given back and the context error is returned.
+func (l *TokenLimiter) Reserve(ctx context.Context, endpoint Endpoint, model string, tokens int) (*TokenReservation, error) {
+	tokens = max(tokens, 1)
+	now := time.Now()
+
+	l.mu.Lock()
+	var buckets []*tokenBucket
+	if b := l.endpointBucket(endpoint); b != nil {
+		buckets = append(buckets, b)
+	}
+	if b := l.modelBucket(model); b != nil {
+		buckets = append(buckets, b)
+	}
+	var wait time.Duration
+	for _, b := range buckets {
+		wait = max(wait, b.take(now, float64(tokens)))
+	}
+	l.mu.Unlock()
+
+	r := &TokenReservation{limiter: l, buckets: buckets, tokens: tokens, Delay: wait}
+	if wait <= 0 {
+		return r, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return r, nil
+	case <-ctx.Done():
+		r.Cancel()
+		return nil, ctx.Err()
+	}
+}
+
+// Available returns the number of tokens currently available for the model on the endpoint,
+// or -1 if unlimited. It is negative when the budget is overdrawn by reconciliations.
+func (l *TokenLimiter) Available(endpoint Endpoint, model string) int {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	available := -1
+	for _, b := range []*tokenBucket{l.endpointBucket(endpoint), l.modelBucket(model)} {
+		if b == nil {
+			continue
+		}
+		b.refill(now)
+		if tokens := int(math.Floor(b.tokens)); available == -1 || tokens < available {
+			available = tokens
+		}
+	}
+	return available
+}
+
+// endpointBucket returns the bucket of the endpoint, or nil if unlimited. It must be called with l.mu held.
+func (l *TokenLimiter) endpointBucket(endpoint Endpoint) *tokenBucket {
+	if b, ok := l.endpoints[endpoint]; ok {
+		return b
+	}
+	b := newTokenBucket(l.endpointBudgets[endpoint])
+	l.endpoints[endpoint] = b
+	return b
+}
+
+// modelBucket returns the bucket of the model, or nil if unlimited. It must be called with l.mu held.
+func (l *TokenLimiter) modelBucket(model string) *tokenBucket {
+	if model == "" {
+		return nil
+	}
+	if b, ok := l.models[model]; ok {
+		return b
+	}
+	budget, ok := l.modelBudgets[model]
+	if !ok {
+		budget = l.defaultBudget
+	}
+	b := newTokenBucket(budget)
+	l.models[model] = b
+	return b
+}
+
+// TokenReservation is a number of tokens reserved on a TokenLimiter.
+// The methods of a nil reservation do nothing.
+type TokenReservation struct {
+	limiter *TokenLimiter
+	buckets []*tokenBucket
+	tokens  int
+	done    bool
+
+	// Delay is how long Reserve waited for the tokens.
+	Delay time.Duration
+}
+
+// Tokens returns the number of tokens reserved.
+func (r *TokenReservation) Tokens() int {
+	if r == nil {
+		return 0
+	}
+	return r.tokens
+}
+
+// Reconcile adjusts the reservation to the number of tokens actually consumed:
+// the unused tokens are given back, and the extra ones are taken from the budget.
+// Only the first call to Reconcile or Cancel has an effect.
+func (r *TokenReservation) Reconcile(actualTokens int) {
+	r.adjust(actualTokens)
+}
+
+// Cancel gives the reserved tokens back, when the call didn't consume them.
+// Only the first call to Reconcile or Cancel has an effect.
+func (r *TokenReservation) Cancel() {
+	r.adjust(0)
+}
+
+// reconcileUsage reconciles the reservation with the usage reported by the API, if any.
+func (r *TokenReservation) reconcileUsage(usage *UsageInfo) {
+	if usage == nil {
+		return
+	}
+	if usage.TotalTokens > 0 {
+		r.Reconcile(usage.TotalTokens)
+	} else if usage.PromptTokens+usage.CompletionTokens > 0 {
+		r.Reconcile(usage.PromptTokens + usage.CompletionTokens)
+	}
+}
+
+// observeQuota lowers the budgets of the reservation so that the calls made until the reset of the quota
+// reported by the API don't consume more than its remaining tokens. The budgets are never raised.
+func (r *TokenReservation) observeQuota(state RateLimitState) {
+	if r == nil || state.Remaining < 0 {
+		return
+	}
+	now := time.Now()
+
+	r.limiter.mu.Lock()
+	defer r.limiter.mu.Unlock()
+
+	for _, b := range r.buckets {
+		b.limit(now, float64(state.Remaining), state.Reset)
+	}
+}
+
+func (r *TokenReservation) adjust(actualTokens int) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+
+	r.limiter.mu.Lock()
+	defer r.limiter.mu.Unlock()
+
+	if r.done {
+		return
+	}
+	r.done = true
+	diff := float64(actualTokens - r.tokens)
+	for _, b := range r.buckets {
+		b.take(now, diff)
+	}
+}
+
+// tokenBucket is a token bucket refilled continuously, which can be overdrawn:
+// the calls made while it is negative wait until it is refilled.
+type tokenBucket struct {
+	capacity float64
+	perSec   float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket creates a full bucket, or returns nil if the budget is unlimited.
+func newTokenBucket(tokensPerMinute int) *tokenBucket {
+	if tokensPerMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(tokensPerMinute),
+		perSec:   float64(tokensPerMinute) / 60,
+		tokens:   float64(tokensPerMinute),
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.capacity, b.tokens+elapsed.Seconds()*b.perSec)
+		b.last = now
+	}
+}
+
+// limit lowers the tokens of the bucket so that at most remaining tokens can be taken within the window,
+// the bucket being refilled meanwhile.
+func (b *tokenBucket) limit(now time.Time, remaining float64, window time.Duration) {
+	b.refill(now)
+	b.tokens = min(b.tokens, remaining-window.Seconds()*b.perSec)
+}
+
+// take removes n tokens from the bucket (gives them back if n is negative)
+// and returns how long to wait until the bucket is no longer overdrawn.
+func (b *tokenBucket) take(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens = min(b.capacity, b.tokens-n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.perSec * float64(time.Second))
+}
+
+// estimateChatTokens estimates the tokens of a chat completion: the prompt, the tools, and MaxTokens per completion.
+func estimateChatTokens(req *ChatCompletionRequest) int {
+	tokens := 0
+	if data, err := json.Marshal(req.Messages); err == nil {
+		tokens += estimateTextTokens(string(data))
+	}
+	if len(req.Tools) > 0 {
+		if data, err := json.Marshal(req.Tools); err == nil {
+			tokens += estimateTextTokens(string(data))
+		}
+	}
+	return tokens + req.MaxTokens*max(req.N, 1)
+}
+
+// estimateEmbeddingTokens estimates the tokens of the inputs of an embedding request.
+func estimateEmbeddingTokens(req *EmbeddingRequest) int {
+	tokens := 0
+	for _, input := range req.Input {
+		tokens += estimateTextTokens(input)
+	}
+	return tokens
+}
+
+func estimateTextTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
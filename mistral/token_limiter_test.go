@@ -0,0 +1,193 @@
+package mistral_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+func TestTokenLimiter_Reserve(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should wait for the budget to be refilled", func(t *testing.T) {
+		// Given
+		limiter := mistral.NewTokenLimiter(600) // 10 tokens per second
+		_, err := limiter.Reserve(ctx, mistral.EndpointChatCompletions, "mistral-small", 600)
+		assert.NoError(t, err)
+
+		// When
+		start := time.Now()
+		r, err := limiter.Reserve(ctx, mistral.EndpointChatCompletions, "mistral-small", 3)
+		elapsed := time.Since(start)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 3, r.Tokens())
+		assert.GreaterOrEqual(t, elapsed, 250*time.Millisecond)
+		assert.Less(t, elapsed, 2*time.Second)
+	})
+
+	t.Run("should give back the unused tokens on reconciliation", func(t *testing.T) {
+		// Given
+		limiter := mistral.NewTokenLimiter(6000)
+		r, err := limiter.Reserve(ctx, mistral.EndpointChatCompletions, "mistral-small", 5000)
+		assert.NoError(t, err)
+
+		// When
+		r.Reconcile(1000)
+		r.Reconcile(5000) // ignored
+
+		// Then
+		assert.InDelta(t, 5000, limiter.Available(mistral.EndpointChatCompletions, "mistral-small"), 10)
+	})
+
+	t.Run("should overdraw the budget when the usage exceeds the reservation", func(t *testing.T) {
+		// Given
+		limiter := mistral.NewTokenLimiter(6000)
+		r, err := limiter.Reserve(ctx, mistral.EndpointChatCompletions, "mistral-small", 5000)
+		assert.NoError(t, err)
+
+		// When
+		r.Reconcile(7000)
+
+		// Then
+		assert.InDelta(t, -1000, limiter.Available(mistral.EndpointChatCompletions, "mistral-small"), 10)
+	})
+
+	t.Run("should give back the tokens when the context is canceled", func(t *testing.T) {
+		// Given
+		limiter := mistral.NewTokenLimiter(60)
+		_, err := limiter.Reserve(ctx, mistral.EndpointChatCompletions, "mistral-small", 60)
+		assert.NoError(t, err)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		// When
+		_, err = limiter.Reserve(timeoutCtx, mistral.EndpointChatCompletions, "mistral-small", 30)
+
+		// Then
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.InDelta(t, 0, limiter.Available(mistral.EndpointChatCompletions, "mistral-small"), 1)
+	})
+
+	t.Run("should have separate budgets per model and per endpoint", func(t *testing.T) {
+		// Given
+		limiter := mistral.NewTokenLimiter(1000,
+			mistral.WithModelTokenBudget("mistral-large", 500),
+			mistral.WithModelTokenBudget("mistral-embed", 0),
+			mistral.WithEndpointTokenBudget(mistral.EndpointEmbeddings, 3000),
+		)
+
+		// When
+		_, err := limiter.Reserve(ctx, mistral.EndpointChatCompletions, "mistral-small", 800)
+		assert.NoError(t, err)
+		_, err = limiter.Reserve(ctx, mistral.EndpointEmbeddings, "mistral-embed", 2000)
+		assert.NoError(t, err)
+
+		// Then
+		assert.InDelta(t, 200, limiter.Available(mistral.EndpointChatCompletions, "mistral-small"), 5)
+		assert.InDelta(t, 500, limiter.Available(mistral.EndpointChatCompletions, "mistral-large"), 5)
+		assert.InDelta(t, 1000, limiter.Available(mistral.EndpointEmbeddings, "mistral-embed"), 5)
+		assert.Equal(t, -1, limiter.Available(mistral.EndpointModels, ""))
+	})
+}
+
+func TestClient_TokenLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reconcile the reservation with the usage of the response", func(t *testing.T) {
+		// Given
+		var maxTokens int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req mistral.ChatCompletionRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			maxTokens = req.MaxTokens
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}],
+				"usage": {"prompt_tokens": 12, "completion_tokens": 8, "total_tokens": 20}}`))
+		}))
+		defer srv.Close()
+
+		limiter := mistral.NewTokenLimiter(60000)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithTokenLimiter(limiter))
+
+		// When
+		req := mistral.NewChatCompletionRequest("mistral-small", []mistral.ChatMessage{mistral.NewUserMessageFromString("Hi!")})
+		req.MaxTokens = 30000
+		_, err := c.ChatCompletion(ctx, req)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 30000, maxTokens)
+		assert.InDelta(t, 60000-20, limiter.Available(mistral.EndpointChatCompletions, "mistral-small"), 5)
+	})
+
+	t.Run("should lower the budget to the remaining quota by size", func(t *testing.T) {
+		// Given
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ratelimitbysize-remaining", "30000")
+			w.Header().Set("ratelimitbysize-reset", "10")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data": [{"embedding": [0.1]}], "usage": {"prompt_tokens": 20, "total_tokens": 20}}`))
+		}))
+		defer srv.Close()
+
+		limiter := mistral.NewTokenLimiter(60000)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithTokenLimiter(limiter))
+
+		// When
+		_, err := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello world"}))
+
+		// Then
+		assert.NoError(t, err)
+		// 30000 tokens left until the reset, 10s during which the budget is refilled by 10000 tokens
+		assert.InDelta(t, 20000, limiter.Available(mistral.EndpointEmbeddings, "mistral-embed"), 5)
+	})
+
+	t.Run("should give back the tokens when the request fails", func(t *testing.T) {
+		// Given
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message": "bad request"}`))
+		}))
+		defer srv.Close()
+
+		limiter := mistral.NewTokenLimiter(60000)
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithTokenLimiter(limiter))
+
+		// When
+		_, err := c.Embeddings(ctx, mistral.NewEmbeddingRequest("mistral-embed", []string{"hello world"}))
+
+		// Then
+		assert.Error(t, err)
+		assert.InDelta(t, 60000, limiter.Available(mistral.EndpointEmbeddings, "mistral-embed"), 5)
+	})
+
+	t.Run("should limit the models endpoints", func(t *testing.T) {
+		// Given
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data": [{"id": "mistral-small"}]}`))
+		}))
+		defer srv.Close()
+
+		limiter := mistral.NewTokenLimiter(0, mistral.WithEndpointTokenBudget(mistral.EndpointModels, 1))
+		c := mistral.New("fake-api-key", mistral.WithBaseApiUrl(srv.URL), mistral.WithTokenLimiter(limiter))
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		// When
+		_, err1 := c.ListModels(timeoutCtx)
+		_, err2 := c.GetModel(timeoutCtx, "mistral-small")
+
+		// Then
+		assert.NoError(t, err1)
+		assert.ErrorIs(t, err2, context.DeadlineExceeded)
+	})
+}
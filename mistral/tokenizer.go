@@ -0,0 +1,349 @@
+package mistral
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TokenizerVersion is the version of the Mistral tokenizer, which sets the control tokens of the chat template.
+type TokenizerVersion int
+
+const (
+	// TokenizerV1 wraps the user messages in plain text [INST] and [/INST] markers, and has no tool calling.
+	TokenizerV1 TokenizerVersion = 1
+
+	// TokenizerV2 adds the control tokens of the instructions and of tool calling.
+	TokenizerV2 TokenizerVersion = 2
+
+	// TokenizerV3 adds the tool call IDs to the tool calls and results.
+	TokenizerV3 TokenizerVersion = 3
+
+	// TokenizerV7 adds the control tokens of the system prompts, which are no longer merged into the user messages.
+	TokenizerV7 TokenizerVersion = 7
+)
+
+func (v TokenizerVersion) String() string {
+	return fmt.Sprintf("v%d", int(v))
+}
+
+// approxCharsPerToken is the average number of characters per token of the approximate tokenizer.
+const approxCharsPerToken = 4
+
+// tokenEncoder counts the tokens of a text, without control tokens.
+type tokenEncoder interface {
+	count(text string) int
+}
+
+// Tokenizer counts the tokens of the prompts locally, before they are sent: strings, chat messages
+// with the control tokens of the chat template, and tool definitions.
+//
+// The vocabularies of Mistral are embedded in the mistral/vocab package, which registers them when imported.
+// Other tokenizer files (tekken.json or tokenizer.model.v*) are loaded with LoadTokenizerFile, NewTekkenTokenizer
+// or NewSentencePieceTokenizer. Without a vocabulary, TokenizerForModel returns an approximate tokenizer.
+type Tokenizer struct {
+	encoder tokenEncoder
+	version TokenizerVersion
+	approx  bool
+}
+
+// NewApproximateTokenizer returns a tokenizer which doesn't need a vocabulary: it splits the text as Tekken does,
+// then counts about one token per 4 characters of each piece. The control tokens are counted exactly.
+func NewApproximateTokenizer(version TokenizerVersion) *Tokenizer {
+	return &Tokenizer{encoder: approxEncoder{splitter: defaultPreTokenizer()}, version: version, approx: true}
+}
+
+// Version returns the version of the tokenizer.
+func (t *Tokenizer) Version() TokenizerVersion {
+	return t.version
+}
+
+// Approximate tells whether the counts are estimated without the vocabulary of the model.
+func (t *Tokenizer) Approximate() bool {
+	return t.approx
+}
+
+// CountTokens returns the number of tokens of the text, without control tokens.
+func (t *Tokenizer) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return t.encoder.count(text)
+}
+
+// CountTools returns the number of tokens of the tool definitions, as sent in the prompt,
+// between the [AVAILABLE_TOOLS] and [/AVAILABLE_TOOLS] control tokens.
+func (t *Tokenizer) CountTools(tools []Tool) (int, error) {
+	if len(tools) == 0 || t.version < TokenizerV2 {
+		return 0, nil
+	}
+	data, err := templateJSON(tools)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal tools: %w", err)
+	}
+	return 2 + t.CountTokens(data), nil
+}
+
+// CountRequest returns the number of tokens of the prompt of the request: its messages and its tools.
+func (t *Tokenizer) CountRequest(req *ChatCompletionRequest) (int, error) {
+	return t.CountMessages(req.Messages, req.Tools)
+}
+
+// CountMessages returns the number of tokens of the prompt made of the messages and the tools, with
+// the control tokens of the chat template: the tools are given before the last user message,
+// and the system prompts are merged into the last user message before TokenizerV7.
+// The images and audio are not counted.
+func (t *Tokenizer) CountMessages(messages []ChatMessage, tools []Tool) (int, error) {
+	var systemPrompts []string
+	lastUser := -1
+	for i, msg := range messages {
+		switch msg.Role() {
+		case RoleSystem:
+			systemPrompts = append(systemPrompts, contentText(msg.Content()))
+		case RoleUser:
+			lastUser = i
+		}
+	}
+
+	tokens := 1 // <s>
+	for i, msg := range messages {
+		switch m := msg.(type) {
+		case *SystemMessage:
+			if t.version >= TokenizerV7 {
+				tokens += 2 + t.CountTokens(contentText(m.Content())) // [SYSTEM_PROMPT] [/SYSTEM_PROMPT]
+			}
+
+		case *UserMessage:
+			if i == lastUser {
+				n, err := t.CountTools(tools)
+				if err != nil {
+					return 0, err
+				}
+				tokens += n
+			}
+			text := contentText(m.Content())
+			if i == lastUser && t.version < TokenizerV7 && len(systemPrompts) > 0 {
+				text = strings.Join(systemPrompts, "\n\n") + "\n\n" + text
+			}
+			if t.version == TokenizerV1 {
+				tokens += t.CountTokens("[INST] " + text + " [/INST]")
+			} else {
+				tokens += 2 + t.CountTokens(text) // [INST] [/INST]
+			}
+
+		case *AssistantMessage:
+			tokens += t.CountTokens(contentText(m.Content()))
+			if len(m.ToolCalls) > 0 && t.version >= TokenizerV2 {
+				data, err := templateJSON(t.toolCalls(m.ToolCalls))
+				if err != nil {
+					return 0, fmt.Errorf("failed to marshal tool calls: %w", err)
+				}
+				tokens += 1 + t.CountTokens(data) // [TOOL_CALLS]
+			}
+			if !m.Prefix {
+				tokens++ // </s>
+			}
+
+		case *ToolMessage:
+			if t.version < TokenizerV2 {
+				continue
+			}
+			result := map[string]any{"content": contentText(m.Content())}
+			if t.version >= TokenizerV3 {
+				result["call_id"] = m.ToolCallId
+			}
+			data, err := templateJSON(result)
+			if err != nil {
+				return 0, fmt.Errorf("failed to marshal tool result: %w", err)
+			}
+			tokens += 2 + t.CountTokens(data) // [TOOL_RESULTS] [/TOOL_RESULTS]
+
+		default:
+			if msg != nil && msg.Content() != nil {
+				tokens += t.CountTokens(contentText(msg.Content()))
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type templateToolCall struct {
+	ID        string  `json:"id,omitempty"`
+	Name      string  `json:"name"`
+	Arguments JsonMap `json:"arguments"`
+}
+
+func (t *Tokenizer) toolCalls(calls []ToolCall) []templateToolCall {
+	out := make([]templateToolCall, len(calls))
+	for i, call := range calls {
+		out[i] = templateToolCall{Name: call.Function.Name, Arguments: call.Function.Arguments}
+		if t.version >= TokenizerV3 {
+			out[i].ID = call.ID
+		}
+	}
+	return out
+}
+
+// contentText returns the text of the content, including the text chunks and the thinking.
+func contentText(content Content) string {
+	if content == nil {
+		return ""
+	}
+	if s := content.String(); s != "" || len(content.Chunks()) == 0 {
+		return s
+	}
+	return chunksText(content.Chunks())
+}
+
+func chunksText(chunks []ContentChunk) string {
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		switch c := chunk.(type) {
+		case *TextChunk:
+			sb.WriteString(c.Text)
+		case *ThinkChunk:
+			sb.WriteString(chunksText(c.Thinking))
+		}
+	}
+	return sb.String()
+}
+
+// templateJSON marshals the value as the chat templates do, with a space after the commas and colons.
+func templateJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	inString, escaped := false, false
+	for _, b := range data {
+		buf.WriteByte(b)
+		switch {
+		case escaped:
+			escaped = false
+		case inString && b == '\\':
+			escaped = true
+		case b == '"':
+			inString = !inString
+		case !inString && (b == ',' || b == ':'):
+			buf.WriteByte(' ')
+		}
+	}
+	return buf.String(), nil
+}
+
+// approxEncoder estimates the number of tokens from the pieces of the text.
+type approxEncoder struct {
+	splitter *preTokenizer
+}
+
+func (e approxEncoder) count(text string) int {
+	n := 0
+	for _, piece := range e.splitter.split(text) {
+		n += (len([]rune(piece)) + approxCharsPerToken - 1) / approxCharsPerToken
+	}
+	return n
+}
+
+// modelTokenizerVersions are the tokenizer versions of the models, by prefix of their ID, the most specific first.
+var modelTokenizerVersions = []struct {
+	prefix  string
+	version TokenizerVersion
+}{
+	{"open-mistral-7b", TokenizerV1},
+	{"open-mixtral-8x7b", TokenizerV1},
+	{"mistral-tiny", TokenizerV1},
+	{"mistral-small-2312", TokenizerV1},
+	{"mistral-medium-2312", TokenizerV1},
+	{"open-mixtral-8x22b", TokenizerV2},
+	{"mistral-small-2402", TokenizerV2},
+	{"mistral-large-2402", TokenizerV2},
+	{"codestral-2405", TokenizerV3},
+	{"mistral-large-2407", TokenizerV3},
+	{"open-mistral-nemo", TokenizerV3},
+	{"open-codestral-mamba", TokenizerV3},
+}
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = make(map[string]*Tokenizer)
+
+	// approximatedModels are the models reported to have an approximate tokenizer.
+	approximatedModels sync.Map
+)
+
+// RegisterTokenizer sets the tokenizer returned by TokenizerForModel for the models whose ID starts with the prefix,
+// for instance a tokenizer loaded from the tekken.json file of the model.
+func RegisterTokenizer(modelPrefix string, tokenizer *Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[modelPrefix] = tokenizer
+}
+
+// sentencePieceFileVersion matches the version suffix of the SentencePiece files, such as tokenizer.model.v3.
+var sentencePieceFileVersion = regexp.MustCompile(`\.model\.v(\d+)$`)
+
+// LoadTokenizerFile loads the tokenizer file published with the model: a Tekken tokenizer from a .json file,
+// such as tekken.json, or a SentencePiece tokenizer from a .model.v<N> file, such as tokenizer.model.v3,
+// whose suffix gives the version of the chat template.
+func LoadTokenizerFile(path string) (*Tokenizer, error) {
+	name := filepath.Base(path)
+	var version TokenizerVersion
+	switch m := sentencePieceFileVersion.FindStringSubmatch(name); {
+	case strings.HasSuffix(name, ".json"):
+	case m != nil:
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tokenizer version in %s: %w", name, err)
+		}
+		version = TokenizerVersion(n)
+	default:
+		return nil, fmt.Errorf("unknown tokenizer file %s: expected a .json or .model.v<N> file", name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokenizer file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	if version == 0 {
+		return NewTekkenTokenizer(f)
+	}
+	return NewSentencePieceTokenizer(f, version)
+}
+
+// TokenizerForModel returns the tokenizer registered with RegisterTokenizer for the model, with the longest prefix:
+// import the mistral/vocab package to register the vocabularies of the Mistral models.
+// If none is, it returns an approximate tokenizer with the version of the model: TokenizerV7 for the recent models.
+// It is logged once per model.
+func TokenizerForModel(model string) *Tokenizer {
+	tokenizersMu.RLock()
+	var best *Tokenizer
+	bestLen := -1
+	for prefix, tokenizer := range tokenizers {
+		if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best, bestLen = tokenizer, len(prefix)
+		}
+	}
+	tokenizersMu.RUnlock()
+	if best != nil {
+		return best
+	}
+
+	if _, logged := approximatedModels.LoadOrStore(model, struct{}{}); !logged {
+		logger.Printf("No tokenizer registered for model %s: the token counts are approximate", model)
+	}
+	for _, v := range modelTokenizerVersions {
+		if strings.HasPrefix(model, v.prefix) {
+			return NewApproximateTokenizer(v.version)
+		}
+	}
+	return NewApproximateTokenizer(TokenizerV7)
+}
@@ -0,0 +1,193 @@
+package mistral
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// sentencePieceType is the type of a piece of a SentencePiece model.
+type sentencePieceType int
+
+const (
+	spNormal      sentencePieceType = 1
+	spUserDefined sentencePieceType = 4
+	spUnused      sentencePieceType = 5
+	spByte        sentencePieceType = 6
+)
+
+// spaceSymbol replaces the spaces in SentencePiece.
+const spaceSymbol = "▁"
+
+type sentencePiece struct {
+	score float32
+	typ   sentencePieceType
+}
+
+// sentencePieceEncoder is the byte pair encoding of SentencePiece, the tokenizer of the v1 to v3 Mistral models.
+type sentencePieceEncoder struct {
+	pieces         map[string]sentencePiece
+	addDummyPrefix bool
+	byteFallback   bool
+}
+
+// NewSentencePieceTokenizer loads a SentencePiece tokenizer from the tokenizer.model.v1, v2 or v3 file published
+// with the model. The version of the chat template must be given, since the file doesn't tell it.
+// The text is not normalized beyond the spaces, which is what the Mistral models do.
+func NewSentencePieceTokenizer(r io.Reader, version TokenizerVersion) (*Tokenizer, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sentencepiece model: %w", err)
+	}
+	encoder := &sentencePieceEncoder{pieces: make(map[string]sentencePiece), addDummyPrefix: true}
+	if err := encoder.parseModel(data); err != nil {
+		return nil, fmt.Errorf("failed to decode sentencepiece model: %w", err)
+	}
+	return &Tokenizer{encoder: encoder, version: version}, nil
+}
+
+func (e *sentencePieceEncoder) count(text string) int {
+	text = strings.ReplaceAll(text, " ", spaceSymbol)
+	if e.addDummyPrefix {
+		text = spaceSymbol + text
+	}
+
+	symbols := make([]string, 0, utf8.RuneCountInString(text))
+	for i, r := range text {
+		symbols = append(symbols, text[i:i+utf8.RuneLen(r)])
+	}
+
+	// Merge the pair whose merge has the highest score first, until no merge is in the vocabulary
+	for len(symbols) > 1 {
+		best, bestScore := -1, float32(0)
+		for i := 0; i < len(symbols)-1; i++ {
+			piece, ok := e.pieces[symbols[i]+symbols[i+1]]
+			if !ok || (piece.typ != spNormal && piece.typ != spUserDefined) {
+				continue
+			}
+			if best < 0 || piece.score > bestScore {
+				best, bestScore = i, piece.score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	n := 0
+	for _, symbol := range symbols {
+		if _, ok := e.pieces[symbol]; ok || !e.byteFallback {
+			// An unknown symbol is a single <unk> token
+			n++
+			continue
+		}
+		n += len(symbol)
+	}
+	return n
+}
+
+// parseModel reads the pieces and the normalizer of the ModelProto protocol buffer.
+func (e *sentencePieceEncoder) parseModel(data []byte) error {
+	return readProtoFields(data, func(field int, wireType int, value []byte, _ uint64) error {
+		switch {
+		case field == 1 && wireType == protoBytes:
+			return e.parsePiece(value)
+		case field == 3 && wireType == protoBytes:
+			return readProtoFields(value, func(field int, wireType int, _ []byte, n uint64) error {
+				if field == 3 && wireType == protoVarint {
+					e.addDummyPrefix = n != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func (e *sentencePieceEncoder) parsePiece(data []byte) error {
+	var text string
+	piece := sentencePiece{typ: spNormal}
+	err := readProtoFields(data, func(field int, wireType int, value []byte, n uint64) error {
+		switch {
+		case field == 1 && wireType == protoBytes:
+			text = string(value)
+		case field == 2 && wireType == protoFixed32:
+			piece.score = math.Float32frombits(uint32(n))
+		case field == 3 && wireType == protoVarint:
+			piece.typ = sentencePieceType(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if piece.typ == spByte {
+		e.byteFallback = true
+	}
+	if piece.typ != spUnused {
+		e.pieces[text] = piece
+	}
+	return nil
+}
+
+// Protocol buffers wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var errInvalidProto = errors.New("invalid protocol buffer")
+
+// readProtoFields calls fn with each field of the protocol buffer message: value is set for the length-delimited
+// fields, n for the others.
+func readProtoFields(data []byte, fn func(field int, wireType int, value []byte, n uint64) error) error {
+	for len(data) > 0 {
+		key, size := binary.Uvarint(data)
+		if size <= 0 {
+			return errInvalidProto
+		}
+		data = data[size:]
+		field, wireType := int(key>>3), int(key&7)
+
+		var value []byte
+		var n uint64
+		switch wireType {
+		case protoVarint:
+			if n, size = binary.Uvarint(data); size <= 0 {
+				return errInvalidProto
+			}
+			data = data[size:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return errInvalidProto
+			}
+			n, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return errInvalidProto
+			}
+			n, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case protoBytes:
+			length, size := binary.Uvarint(data)
+			if size <= 0 || uint64(len(data)-size) < length {
+				return errInvalidProto
+			}
+			value, data = data[size:size+int(length)], data[size+int(length):]
+		default:
+			return errInvalidProto
+		}
+
+		if err := fn(field, wireType, value, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
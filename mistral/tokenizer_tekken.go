@@ -0,0 +1,178 @@
+package mistral
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tekkenPattern is the pattern splitting the text into pieces before the byte pair encoding.
+const tekkenPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+// lookaheadWhitespace is the alternative of the pattern which Go regular expressions don't support: it is emulated.
+const lookaheadWhitespace = `\s+(?!\S)|`
+
+// preTokenizer splits the text into pieces with a tiktoken-like pattern.
+type preTokenizer struct {
+	re *regexp.Regexp
+
+	// trimWhitespace emulates \s+(?!\S): a run of whitespace followed by a non-whitespace character leaves it its last
+	// whitespace character.
+	trimWhitespace bool
+}
+
+// defaultPreTokenizer returns the pre-tokenizer of tekkenPattern, compiled once.
+var defaultPreTokenizer = sync.OnceValue(func() *preTokenizer {
+	p, err := compilePreTokenizer(tekkenPattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+})
+
+func compilePreTokenizer(pattern string) (*preTokenizer, error) {
+	trim := strings.Contains(pattern, lookaheadWhitespace)
+	pattern = strings.Replace(pattern, lookaheadWhitespace, "", 1)
+	re, err := regexp.Compile(`^(?:` + pattern + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported tokenizer pattern: %w", err)
+	}
+	return &preTokenizer{re: re, trimWhitespace: trim}, nil
+}
+
+func (p *preTokenizer) split(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		loc := p.re.FindStringIndex(text[i:])
+		if loc == nil || loc[1] == 0 {
+			// No piece matches: take the next character alone
+			_, size := utf8.DecodeRuneInString(text[i:])
+			pieces = append(pieces, text[i:i+size])
+			i += size
+			continue
+		}
+		end := i + loc[1]
+		piece := text[i:end]
+		if p.trimWhitespace && end < len(text) && isWhitespaceRun(piece) && utf8.RuneCountInString(piece) > 1 {
+			_, size := utf8.DecodeLastRuneInString(piece)
+			end -= size
+			piece = text[i:end]
+		}
+		pieces = append(pieces, piece)
+		i = end
+	}
+	return pieces
+}
+
+// isWhitespaceRun tells whether the text is only made of whitespace, without line breaks.
+func isWhitespaceRun(text string) bool {
+	for _, r := range text {
+		if !unicode.IsSpace(r) || r == '\r' || r == '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// tekkenFile is the content of a tekken.json file.
+type tekkenFile struct {
+	Config struct {
+		Pattern                 string `json:"pattern"`
+		NumVocabTokens          int    `json:"num_vocab_tokens"`
+		DefaultVocabSize        int    `json:"default_vocab_size"`
+		DefaultNumSpecialTokens int    `json:"default_num_special_tokens"`
+		Version                 string `json:"version"`
+	} `json:"config"`
+	Vocab []struct {
+		Rank       int    `json:"rank"`
+		TokenBytes string `json:"token_bytes"`
+	} `json:"vocab"`
+}
+
+// tekkenEncoder is the byte pair encoding of Tekken, the tiktoken-based tokenizer of the recent Mistral models.
+type tekkenEncoder struct {
+	splitter *preTokenizer
+	ranks    map[string]int
+}
+
+// NewTekkenTokenizer loads a Tekken tokenizer from the tekken.json file published with the model.
+// The version of the chat template is read from the file.
+func NewTekkenTokenizer(r io.Reader) (*Tokenizer, error) {
+	var file tekkenFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode tekken file: %w", err)
+	}
+
+	pattern := file.Config.Pattern
+	if pattern == "" {
+		pattern = tekkenPattern
+	}
+	splitter, err := compilePreTokenizer(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the first ranks are used: the others are kept for the larger vocabularies
+	size := len(file.Vocab)
+	if file.Config.DefaultVocabSize > 0 {
+		size = min(size, file.Config.DefaultVocabSize-file.Config.DefaultNumSpecialTokens)
+	}
+	ranks := make(map[string]int, size)
+	for _, token := range file.Vocab[:max(size, 0)] {
+		b, err := base64.StdEncoding.DecodeString(token.TokenBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %d in tekken file: %w", token.Rank, err)
+		}
+		ranks[string(b)] = token.Rank
+	}
+
+	version := TokenizerV7
+	if v := file.Config.Version; v != "" {
+		var n int
+		if _, err := fmt.Sscanf(v, "v%d", &n); err != nil {
+			return nil, fmt.Errorf("invalid tekken version %q", v)
+		}
+		version = TokenizerVersion(n)
+	}
+
+	return &Tokenizer{encoder: &tekkenEncoder{splitter: splitter, ranks: ranks}, version: version}, nil
+}
+
+func (e *tekkenEncoder) count(text string) int {
+	n := 0
+	for _, piece := range e.splitter.split(text) {
+		n += e.countPiece(piece)
+	}
+	return n
+}
+
+// countPiece merges the bytes of the piece, the pair with the lowest rank first, until no pair is in the vocabulary.
+func (e *tekkenEncoder) countPiece(piece string) int {
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+	parts := make([]string, len(piece))
+	for i := range len(piece) {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := e.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts)
+}
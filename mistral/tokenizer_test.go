@@ -0,0 +1,318 @@
+package mistral_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// makeTekkenFile returns a tekken.json file whose vocabulary is the 256 bytes followed by the given merges.
+func makeTekkenFile(t *testing.T, version string, merges ...string) *bytes.Reader {
+	t.Helper()
+
+	type token struct {
+		Rank       int    `json:"rank"`
+		TokenBytes string `json:"token_bytes"`
+	}
+	var vocab []token
+	for b := range 256 {
+		vocab = append(vocab, token{Rank: b, TokenBytes: base64.StdEncoding.EncodeToString([]byte{byte(b)})})
+	}
+	for i, merge := range merges {
+		vocab = append(vocab, token{Rank: 256 + i, TokenBytes: base64.StdEncoding.EncodeToString([]byte(merge))})
+	}
+	data, err := json.Marshal(map[string]any{
+		"config": map[string]any{
+			"version":                    version,
+			"default_vocab_size":         len(vocab) + 10,
+			"default_num_special_tokens": 10,
+		},
+		"vocab": vocab,
+	})
+	assert.NoError(t, err)
+	return bytes.NewReader(data)
+}
+
+// makeSentencePieceModel returns a SentencePiece ModelProto with the given pieces, of the normal type.
+func makeSentencePieceModel(pieces []string, scores []float32, bytePieces ...string) *bytes.Reader {
+	var model []byte
+	appendPiece := func(piece string, score float32, typ uint64) {
+		var p []byte
+		p = binary.AppendUvarint(p, 1<<3|2)
+		p = binary.AppendUvarint(p, uint64(len(piece)))
+		p = append(p, piece...)
+		p = binary.AppendUvarint(p, 2<<3|5)
+		p = binary.LittleEndian.AppendUint32(p, math.Float32bits(score))
+		p = binary.AppendUvarint(p, 3<<3|0)
+		p = binary.AppendUvarint(p, typ)
+
+		model = binary.AppendUvarint(model, 1<<3|2)
+		model = binary.AppendUvarint(model, uint64(len(p)))
+		model = append(model, p...)
+	}
+	appendPiece("<unk>", 0, 2)
+	appendPiece("<s>", 0, 3)
+	appendPiece("</s>", 0, 3)
+	for i, piece := range pieces {
+		appendPiece(piece, scores[i], 1)
+	}
+	for _, piece := range bytePieces {
+		appendPiece(piece, 0, 6)
+	}
+	return bytes.NewReader(model)
+}
+
+func TestNewTekkenTokenizer(t *testing.T) {
+	t.Run("should merge the bytes with the lowest rank first", func(t *testing.T) {
+		// Given
+		tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v7", "he", "ll", "llo", "hello"))
+		assert.NoError(t, err)
+
+		// When
+		n := tok.CountTokens("hello world")
+
+		// Then
+		assert.Equal(t, 7, n) // "hello" + " world" in 6 bytes
+		assert.Equal(t, mistral.TokenizerV7, tok.Version())
+		assert.False(t, tok.Approximate())
+	})
+
+	t.Run("should leave the last space of a run of spaces to the next word", func(t *testing.T) {
+		// Given
+		tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v3", "  ", " b"))
+		assert.NoError(t, err)
+
+		// When
+		n := tok.CountTokens("a   b")
+
+		// Then
+		assert.Equal(t, 3, n) // "a", "  ", " b"
+		assert.Equal(t, mistral.TokenizerV3, tok.Version())
+	})
+
+	t.Run("should fail with an invalid file", func(t *testing.T) {
+		_, err := mistral.NewTekkenTokenizer(strings.NewReader("{"))
+
+		assert.ErrorContains(t, err, "failed to decode tekken file")
+	})
+}
+
+func TestNewSentencePieceTokenizer(t *testing.T) {
+	t.Run("should merge the pieces with the highest score first", func(t *testing.T) {
+		// Given
+		model := makeSentencePieceModel(
+			[]string{"▁", "h", "e", "l", "o", "▁h", "ll", "▁he", "▁hell", "▁hello"},
+			[]float32{-10, -10, -10, -10, -10, -1, -2, -3, -4, -5})
+		tok, err := mistral.NewSentencePieceTokenizer(model, mistral.TokenizerV1)
+		assert.NoError(t, err)
+
+		// When
+		n := tok.CountTokens("hello hello")
+
+		// Then
+		assert.Equal(t, 2, n)
+		assert.Equal(t, mistral.TokenizerV1, tok.Version())
+	})
+
+	t.Run("should count the bytes of the unknown characters with byte fallback", func(t *testing.T) {
+		// Given
+		model := makeSentencePieceModel([]string{"▁", "h", "i", "▁h", "▁hi"}, []float32{-10, -10, -10, -1, -2},
+			"<0xC3>", "<0xA9>")
+		tok, err := mistral.NewSentencePieceTokenizer(model, mistral.TokenizerV3)
+		assert.NoError(t, err)
+
+		// When
+		n := tok.CountTokens("hié")
+
+		// Then
+		assert.Equal(t, 3, n) // "▁hi" + the 2 bytes of "é"
+	})
+
+	t.Run("should fail with an invalid model", func(t *testing.T) {
+		_, err := mistral.NewSentencePieceTokenizer(bytes.NewReader([]byte{0x0a, 0xff}), mistral.TokenizerV1)
+
+		assert.ErrorContains(t, err, "failed to decode sentencepiece model")
+	})
+}
+
+func TestTokenizer_CountMessages(t *testing.T) {
+	tools := []mistral.Tool{
+		mistral.NewTool("get_weather", "Get the weather", mistral.PropertyDefinition{Type: "object"}),
+	}
+	messages := []mistral.ChatMessage{
+		mistral.NewSystemMessageFromString("Be brief"),
+		mistral.NewUserMessageFromString("Weather?"),
+		mistral.NewAssistantMessageFromString("",
+			mistral.NewToolCall("call1", 0, "get_weather", mistral.JsonMap{"city": "Paris"})),
+		mistral.NewToolMessage("get_weather", "call1", mistral.ContentString("sunny")),
+		mistral.NewAssistantMessageFromString("Sunny"),
+	}
+
+	t.Run("should count the control tokens of the v7 template", func(t *testing.T) {
+		// Given
+		tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v7"))
+		assert.NoError(t, err)
+		toolsTokens, err := tok.CountTools(tools)
+		assert.NoError(t, err)
+
+		// When
+		n, err := tok.CountMessages(messages, tools)
+
+		// Then
+		assert.NoError(t, err)
+		expected := 1 + // <s>
+			2 + len("Be brief") +
+			toolsTokens +
+			2 + len("Weather?") +
+			1 + len(`[{"id": "call1", "name": "get_weather", "arguments": {"city": "Paris"}}]`) + 1 +
+			2 + len(`{"call_id": "call1", "content": "sunny"}`) +
+			len("Sunny") + 1
+		assert.Equal(t, expected, n)
+		toolsJSON := `[{"type": "function", "function": {"name": "get_weather", "description": "Get the weather", ` +
+			`"parameters": {"type": "object"}}}]`
+		assert.Equal(t, 2+tok.CountTokens(toolsJSON), toolsTokens)
+	})
+
+	t.Run("should merge the system prompt into the last user message before v7", func(t *testing.T) {
+		// Given
+		tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v2"))
+		assert.NoError(t, err)
+		toolsTokens, err := tok.CountTools(tools)
+		assert.NoError(t, err)
+
+		// When
+		n, err := tok.CountMessages(messages, tools)
+
+		// Then
+		assert.NoError(t, err)
+		expected := 1 +
+			toolsTokens +
+			2 + len("Be brief\n\nWeather?") +
+			1 + len(`[{"name": "get_weather", "arguments": {"city": "Paris"}}]`) + 1 +
+			2 + len(`{"content": "sunny"}`) +
+			len("Sunny") + 1
+		assert.Equal(t, expected, n)
+	})
+
+	t.Run("should count the v1 instructions as text, without tools", func(t *testing.T) {
+		// Given
+		tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v1"))
+		assert.NoError(t, err)
+
+		// When
+		n, err := tok.CountMessages([]mistral.ChatMessage{
+			mistral.NewUserMessageFromString("Hi"),
+			mistral.NewAssistantMessageFromString("Hello"),
+		}, tools)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 1+len("[INST] Hi [/INST]")+len("Hello")+1, n)
+	})
+
+	t.Run("should not close a prefix assistant message", func(t *testing.T) {
+		// Given
+		tok, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v7"))
+		assert.NoError(t, err)
+		prefix := mistral.NewAssistantMessageFromString("Sure")
+		prefix.Prefix = true
+
+		// When
+		n, err := tok.CountMessages([]mistral.ChatMessage{mistral.NewUserMessageFromString("Hi"), prefix}, nil)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, 1+2+len("Hi")+len("Sure"), n)
+	})
+}
+
+func TestLoadTokenizerFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(t *testing.T, name string, r io.Reader) string {
+		t.Helper()
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+
+	t.Run("should load a tekken file", func(t *testing.T) {
+		// Given
+		path := writeFile(t, "tekken.json", makeTekkenFile(t, "v7", "he", "ll", "llo", "hello"))
+
+		// When
+		tok, err := mistral.LoadTokenizerFile(path)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, mistral.TokenizerV7, tok.Version())
+		assert.Equal(t, 1, tok.CountTokens("hello"))
+	})
+
+	t.Run("should load a sentencepiece file with the version of its suffix", func(t *testing.T) {
+		// Given
+		path := writeFile(t, "tokenizer.model.v3", makeSentencePieceModel([]string{"▁", "h", "i", "▁h", "▁hi"},
+			[]float32{-10, -10, -10, -1, -2}))
+
+		// When
+		tok, err := mistral.LoadTokenizerFile(path)
+
+		// Then
+		assert.NoError(t, err)
+		assert.Equal(t, mistral.TokenizerV3, tok.Version())
+		assert.Equal(t, 1, tok.CountTokens("hi"))
+	})
+
+	t.Run("should fail with an unknown file", func(t *testing.T) {
+		_, err := mistral.LoadTokenizerFile(filepath.Join(dir, "tokenizer.model"))
+
+		assert.ErrorContains(t, err, "unknown tokenizer file tokenizer.model")
+	})
+
+	t.Run("should fail with a missing file", func(t *testing.T) {
+		_, err := mistral.LoadTokenizerFile(filepath.Join(dir, "missing.json"))
+
+		assert.ErrorContains(t, err, "failed to open tokenizer file")
+	})
+}
+
+func TestTokenizerForModel(t *testing.T) {
+	t.Run("should return an approximate tokenizer with the version of the model", func(t *testing.T) {
+		assert.Equal(t, mistral.TokenizerV1, mistral.TokenizerForModel("open-mistral-7b").Version())
+		assert.Equal(t, mistral.TokenizerV3, mistral.TokenizerForModel("open-mistral-nemo-2407").Version())
+		assert.Equal(t, mistral.TokenizerV7, mistral.TokenizerForModel("mistral-large-latest").Version())
+		assert.True(t, mistral.TokenizerForModel("mistral-large-latest").Approximate())
+	})
+
+	t.Run("should return the registered tokenizer with the longest prefix", func(t *testing.T) {
+		// Given
+		short, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v7"))
+		assert.NoError(t, err)
+		long, err := mistral.NewTekkenTokenizer(makeTekkenFile(t, "v7"))
+		assert.NoError(t, err)
+		mistral.RegisterTokenizer("test-model", short)
+		mistral.RegisterTokenizer("test-model-small", long)
+
+		// Then
+		assert.Same(t, long, mistral.TokenizerForModel("test-model-small-2506"))
+		assert.Same(t, short, mistral.TokenizerForModel("test-model-large"))
+	})
+}
+
+func TestNewApproximateTokenizer(t *testing.T) {
+	tok := mistral.NewApproximateTokenizer(mistral.TokenizerV7)
+
+	assert.Equal(t, 0, tok.CountTokens(""))
+	assert.Equal(t, 4, tok.CountTokens("hello world")) // "hello" and " world", of 2 tokens each
+}
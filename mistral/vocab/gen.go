@@ -0,0 +1,71 @@
+//go:build ignore
+
+// gen downloads the tokenizer files of mistral-common and writes them, gzip compressed, to the data directory.
+//
+//	go run gen.go [-ref main]
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mistral/vocab"
+)
+
+const baseURL = "https://raw.githubusercontent.com/mistralai/mistral-common/%s/src/mistral_common/data/%s"
+
+func main() {
+	ref := flag.String("ref", "main", "git reference of mistral-common to download the files from")
+	flag.Parse()
+
+	for _, file := range vocab.Files {
+		data, err := download(fmt.Sprintf(baseURL, *ref, file.Name))
+		if err != nil {
+			log.Fatalf("failed to download %s: %v", file.Name, err)
+		}
+
+		// Check that the file is understood before embedding it
+		if file.Tekken {
+			_, err = mistral.NewTekkenTokenizer(bytes.NewReader(data))
+		} else {
+			_, err = mistral.NewSentencePieceTokenizer(bytes.NewReader(data), file.Version)
+		}
+		if err != nil {
+			log.Fatalf("invalid tokenizer file %s: %v", file.Name, err)
+		}
+
+		var buf bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := w.Write(data); err != nil {
+			log.Fatalf("failed to compress %s: %v", file.Name, err)
+		}
+		if err := w.Close(); err != nil {
+			log.Fatalf("failed to compress %s: %v", file.Name, err)
+		}
+		path := filepath.Join("data", file.Name+".gz")
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			log.Fatalf("failed to write %s: %v", path, err)
+		}
+		fmt.Printf("%s: %d bytes, %d compressed\n", file.Name, len(data), buf.Len())
+	}
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,111 @@
+// Package vocab embeds the vocabularies of the Mistral tokenizers, and registers them with mistral.RegisterTokenizer
+// when imported, so that mistral.TokenizerForModel counts the tokens exactly:
+//
+//	import _ "github.com/thomas-marquis/mistral-client/mistral/vocab"
+//
+// The vocabularies are the tokenizer files of mistral-common (https://github.com/mistralai/mistral-common,
+// Apache-2.0), gzip compressed in the data directory by go generate. They weigh several megabytes, which is why
+// they are not part of the mistral package.
+package vocab
+
+//go:generate go run gen.go
+
+import (
+	"compress/gzip"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/thomas-marquis/mistral-client/mistral"
+)
+
+// File is a tokenizer file of mistral-common, and the models it tokenizes.
+type File struct {
+	// Name is the name of the file in mistral-common.
+	Name string
+
+	// Tekken tells whether the file is a tekken.json file rather than a SentencePiece model.
+	Tekken bool
+
+	// Version is the version of the chat template of a SentencePiece model. Tekken files tell their own.
+	Version mistral.TokenizerVersion
+
+	// Models are the prefixes of the IDs of the models using the tokenizer. The empty prefix is the default
+	// tokenizer of the models without a more specific one.
+	Models []string
+}
+
+// Files are the tokenizer files embedded in the package.
+var Files = []File{
+	{
+		Name:    "tokenizer.model.v1",
+		Version: mistral.TokenizerV1,
+		Models:  []string{"open-mistral-7b", "open-mixtral-8x7b", "mistral-tiny", "mistral-small-2312", "mistral-medium-2312"},
+	},
+	{
+		Name:    "mistral_instruct_tokenizer_240216.model.v2",
+		Version: mistral.TokenizerV2,
+		Models:  []string{"open-mixtral-8x22b", "mistral-small-2402", "mistral-large-2402"},
+	},
+	{
+		Name:    "mistral_instruct_tokenizer_240323.model.v3",
+		Version: mistral.TokenizerV3,
+		Models:  []string{"codestral-2405", "mistral-large-2407", "open-codestral-mamba"},
+	},
+	{
+		Name:   "tekken_240718.json",
+		Tekken: true,
+		Models: []string{"open-mistral-nemo"},
+	},
+	{
+		Name:   "tekken_240911.json",
+		Tekken: true,
+		Models: []string{""},
+	},
+}
+
+//go:embed data
+var data embed.FS
+
+// ErrNotEmbedded is returned by Load when the file has not been generated in the data directory.
+var ErrNotEmbedded = errors.New("tokenizer file not embedded")
+
+func init() {
+	for _, file := range Files {
+		tok, err := Load(file)
+		if errors.Is(err, ErrNotEmbedded) {
+			// The models keep the approximate tokenizer, and TokenizerForModel reports it
+			continue
+		}
+		if err != nil {
+			panic(fmt.Sprintf("vocab: %v", err))
+		}
+		for _, model := range file.Models {
+			mistral.RegisterTokenizer(model, tok)
+		}
+	}
+}
+
+// Load returns the tokenizer of the embedded file.
+func Load(file File) (*mistral.Tokenizer, error) {
+	f, err := data.Open("data/" + file.Name + ".gz")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s, run go generate", ErrNotEmbedded, file.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", file.Name, err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	if file.Tekken {
+		return mistral.NewTekkenTokenizer(r)
+	}
+	return mistral.NewSentencePieceTokenizer(r, file.Version)
+}
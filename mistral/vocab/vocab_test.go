@@ -0,0 +1,33 @@
+package vocab_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/mistral-client/mistral"
+	"github.com/thomas-marquis/mistral-client/mistral/vocab"
+)
+
+func TestLoad(t *testing.T) {
+	for _, file := range vocab.Files {
+		t.Run(file.Name, func(t *testing.T) {
+			// When
+			tok, err := vocab.Load(file)
+			if errors.Is(err, vocab.ErrNotEmbedded) {
+				t.Skipf("%v", err)
+			}
+
+			// Then
+			assert.NoError(t, err)
+			assert.False(t, tok.Approximate())
+			if !file.Tekken {
+				assert.Equal(t, file.Version, tok.Version())
+			}
+			assert.Positive(t, tok.CountTokens("Hello world!"))
+			for _, model := range file.Models {
+				assert.False(t, mistral.TokenizerForModel(model+"-test").Approximate(), "model %q", model)
+			}
+		})
+	}
+}